@@ -2,14 +2,15 @@ module yap
 
 go 1.25.5
 
-require golang.org/x/crypto v0.47.0
-
 require (
-	github.com/mattn/go-sqlite3 v1.14.33 // indirect
-	github.com/x448/float16 v0.8.4 // indirect
+	github.com/mattn/go-sqlite3 v1.14.33
+	golang.org/x/crypto v0.47.0
+	golang.org/x/term v0.39.0
 )
 
+require github.com/x448/float16 v0.8.4 // indirect
+
 require (
 	github.com/fxamacker/cbor/v2 v2.9.0
-	golang.org/x/sys v0.40.0 // indirect
+	golang.org/x/sys v0.40.0
 )
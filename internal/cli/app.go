@@ -0,0 +1,223 @@
+/*
+* CLI / UX layer (thin)
+*
+* yap [global flags] <command> [command flags] [args]
+*
+* Commands are thin wrappers over the vault package. They never touch
+* db.* or raw keys directly, and every failure maps onto a stable exit
+* code (see exit.go).
+* */
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"yap/internal/config"
+	"yap/internal/crypto"
+	"yap/internal/log"
+	"yap/internal/state"
+	"yap/internal/vault"
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	// noVault commands run without a configured vault path
+	noVault bool
+	run     func(a *app, args []string) error
+}
+
+var commands = map[string]*command{}
+
+func register(c *command) {
+	commands[c.name] = c
+}
+
+type app struct {
+	cfg    *config.Config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	rng    crypto.RNG
+	store  *state.Store
+}
+
+// Run executes the CLI and returns the process exit code.
+func Run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	cfg := &config.Config{}
+
+	fs := flag.NewFlagSet("yap", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&cfg.VaultPath, "vault", "", "Path to vaultfile")
+	fs.StringVar(&cfg.RepoPath, "repo", "", "Path to git repository")
+	fs.BoolVar(&cfg.Debug, "debug", false, "Enable debug logging")
+	fs.StringVar(&cfg.ConfigFile, "config", "", "Path to config file")
+	fs.IntVar(&cfg.PasswordFD, "password-fd", -1, "Read the master password from this file descriptor")
+	fs.StringVar(&cfg.PasswordFile, "password-file", "", "Read the master password from this file (must be 0600)")
+	fs.StringVar(&cfg.Format, "format", formatTable, "Output format: table or json")
+	fs.Usage = func() { printUsage(stderr, fs) }
+
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+
+	if !validFormat(cfg.Format) {
+		fmt.Fprintf(stderr, "yap: unknown format %q (want table or json)\n", cfg.Format)
+		return ExitUsage
+	}
+
+	// Initialize logging; structured logs go with structured output
+	logMode := log.Dev
+	if cfg.Format == formatJSON {
+		logMode = log.Prod
+	}
+	log.Init(logMode, cfg.Debug)
+
+	if fs.NArg() == 0 {
+		printUsage(stderr, fs)
+		return ExitUsage
+	}
+
+	name := fs.Arg(0)
+	cmd, ok := commands[name]
+	if !ok {
+		if cfg.Format == formatJSON {
+			return newApp(cfg, stdout, stderr).fail(name,
+				fmt.Errorf("%w: unknown command %q", errUsage, name))
+		}
+		fmt.Fprintf(stderr, "yap: unknown command %q\n", name)
+		printUsage(stderr, fs)
+		return ExitUsage
+	}
+
+	if !cmd.noVault {
+		if err := config.Load(cfg); err != nil {
+			return newApp(cfg, stdout, stderr).fail(name, err)
+		}
+	}
+
+	a := newApp(cfg, stdout, stderr)
+	a.stdin = stdin
+
+	stateDir, err := state.DefaultDir()
+	if err != nil {
+		return a.fail(name, err)
+	}
+	a.store = state.NewStore(stateDir, a.rng)
+
+	if err := cmd.run(a, fs.Args()[1:]); err != nil {
+		return a.fail(name, err)
+	}
+	return ExitOK
+}
+
+func newApp(cfg *config.Config, stdout, stderr io.Writer) *app {
+	return &app{
+		cfg:    cfg,
+		stdout: stdout,
+		stderr: stderr,
+		rng:    crypto.SecureRNG{},
+	}
+}
+
+// fail reports err and returns its exit code. JSON errors go to stdout
+// so scripts read a single stream.
+func (a *app) fail(name string, err error) int {
+	if a.cfg.Format == formatJSON {
+		return renderError(a.stdout, true, name, err)
+	}
+	return renderError(a.stderr, false, name, err)
+}
+
+func printUsage(w io.Writer, fs *flag.FlagSet) {
+	fmt.Fprintln(w, "usage: yap [global flags] <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %-16s %s\n", name, commands[name].summary)
+	}
+
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "global flags:")
+	fs.PrintDefaults()
+}
+
+// newFlagSet builds a per-command flag set that reports usage errors.
+func (a *app) newFlagSet(c string) *flag.FlagSet {
+	fs := flag.NewFlagSet("yap "+c, flag.ContinueOnError)
+	fs.SetOutput(a.stderr)
+	if cmd, ok := commands[c]; ok {
+		fs.Usage = func() {
+			fmt.Fprintf(a.stderr, "usage: yap %s %s\n", c, cmd.usage)
+			fs.PrintDefaults()
+		}
+	}
+	return fs
+}
+
+// parseFlags parses args, turning flag errors into usage errors.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	return nil
+}
+
+// stringList is a flag that may be given several times.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// openVault prompts for the password and opens the configured vault
+// with trusted local state enforced.
+func (a *app) openVault() (*vault.Vault, error) {
+	v, password, err := a.openVaultPassword()
+	crypto.Wipe(password)
+	return v, err
+}
+
+// openVaultPassword is openVault for commands that need the master
+// password again after unlocking.
+// openVaultPassword also returns the password, which the caller must Wipe.
+func (a *app) openVaultPassword() (*vault.Vault, []byte, error) {
+	password, err := a.readPassword("Master password", false)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	v, err := vault.Open(a.cfg.VaultPath, password, vault.OpenContext{
+		State: a.store,
+	})
+	if err != nil {
+		crypto.Wipe(password)
+		return nil, nil, err
+	}
+	return v, password, nil
+}
+
+// commit writes a dirty vault back to its path.
+func (a *app) commit(v *vault.Vault) error {
+	if !v.CanCommit() {
+		return nil
+	}
+	return v.Commit(v.Path(), a.rng)
+}
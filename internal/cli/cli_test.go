@@ -0,0 +1,209 @@
+package cli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testEnv struct {
+	t        *testing.T
+	vault    string
+	password string
+	state    string // XDG_STATE_HOME, i.e. the simulated device
+}
+
+// newTestEnv isolates local state and writes a 0600 password file.
+func newTestEnv(t *testing.T) *testEnv {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	pw := filepath.Join(dir, "password")
+	if err := os.WriteFile(pw, []byte("correct horse battery staple\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testEnv{
+		t:        t,
+		vault:    filepath.Join(dir, "vault.yap"),
+		password: pw,
+		state:    filepath.Join(dir, "state"),
+	}
+}
+
+// run invokes the CLI against the env's vault and password file.
+func (e *testEnv) run(args ...string) (stdout, stderr string, code int) {
+	e.t.Helper()
+	return e.runInput("", args...)
+}
+
+// runInput is run with input fed to stdin.
+func (e *testEnv) runInput(input string, args ...string) (stdout, stderr string, code int) {
+	e.t.Helper()
+	e.t.Setenv("XDG_STATE_HOME", e.state)
+
+	global := []string{"-vault", e.vault, "--password-file", e.password}
+	var out, errOut bytes.Buffer
+	code = Run(append(global, args...), strings.NewReader(input), &out, &errOut)
+	return out.String(), errOut.String(), code
+}
+
+func (e *testEnv) mustRun(args ...string) string {
+	e.t.Helper()
+
+	out, errOut, code := e.run(args...)
+	if code != ExitOK {
+		e.t.Fatalf("yap %v: exit %d: %s", args, code, errOut)
+	}
+	return out
+}
+
+func TestRun_InitThenStatus(t *testing.T) {
+	env := newTestEnv(t)
+
+	out := env.mustRun("init")
+	if !strings.Contains(out, "created vault") {
+		t.Fatalf("unexpected init output: %q", out)
+	}
+
+	out = env.mustRun("status")
+	for _, want := range []string{"vault version:  1", "key epoch:      1", "last writer:"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("status missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestRun_WrongPasswordExitCode(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+
+	if err := os.WriteFile(env.password, []byte("wrong\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := env.run("open"); code != ExitAuthFailed {
+		t.Fatalf("expected exit %d, got %d", ExitAuthFailed, code)
+	}
+}
+
+func TestRun_UsageErrors(t *testing.T) {
+	env := newTestEnv(t)
+
+	if _, _, code := env.run("no-such-command"); code != ExitUsage {
+		t.Fatalf("expected exit %d for unknown command, got %d", ExitUsage, code)
+	}
+	if _, _, code := env.run("status", "--bogus"); code != ExitUsage {
+		t.Fatalf("expected exit %d for unknown flag, got %d", ExitUsage, code)
+	}
+}
+
+// Every flag a command defines appears in its usage line.
+func TestRun_UsageListsEveryFlag(t *testing.T) {
+	env := newTestEnv(t)
+	for name, cmd := range commands {
+		_, errOut, _ := env.run(name, "-h")
+		for _, line := range strings.Split(errOut, "\n") {
+			flag, ok := strings.CutPrefix(line, "  -")
+			if !ok {
+				continue
+			}
+			flag, _, _ = strings.Cut(flag, " ")
+			if !strings.Contains(cmd.usage, "--"+flag) {
+				t.Errorf("%s: usage %q lacks --%s", name, cmd.usage, flag)
+			}
+		}
+	}
+}
+
+func TestRun_InsecurePasswordFileRejected(t *testing.T) {
+	env := newTestEnv(t)
+
+	if err := os.Chmod(env.password, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, code := env.run("init"); code != ExitConfig {
+		t.Fatalf("expected exit %d, got %d", ExitConfig, code)
+	}
+}
+
+func TestLock_CountsRemovedFiles(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	for _, name := range []string{"yap-vault-1.db", "yap-vault-1.db-wal", "unrelated.db"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	env := newTestEnv(t)
+	if out := env.mustRun("lock"); !strings.Contains(out, "removed 2 ") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	if out := env.mustRun("lock"); !strings.Contains(out, "removed 0 ") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	if _, err := os.Stat(filepath.Join(tmp, "unrelated.db")); err != nil {
+		t.Fatalf("lock removed an unrelated file: %v", err)
+	}
+}
+
+func TestRotatePassword(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+	env.addEntry("GitHub", "hunter2")
+
+	newPassword := filepath.Join(t.TempDir(), "new-password")
+	if err := os.WriteFile(newPassword, []byte("new master password\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out := env.mustRun("rotate-password", "--new-password-file", newPassword)
+	if !strings.Contains(out, "key epoch 2") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+
+	if _, _, code := env.run("list"); code != ExitAuthFailed {
+		t.Fatalf("old password must fail, got exit %d", code)
+	}
+	env.password = newPassword
+	if out := env.mustRun("list"); !strings.Contains(out, "GitHub") {
+		t.Fatalf("entries lost after rotation:\n%s", out)
+	}
+}
+
+func TestRotatePassword_RejectsWeakArgonParams(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+
+	for _, args := range [][]string{
+		{"--argon-memory", "1024"},
+		{"--argon-iterations", "1"},
+		{"--argon-parallelism", "1"},
+		{"--argon-memory", "99999999999"},
+	} {
+		_, errOut, code := env.run(append([]string{"rotate-password", "--new-password-file", env.password}, args...)...)
+		if code != ExitUsage || !strings.Contains(errOut, args[0]) {
+			t.Fatalf("%v: expected a usage error, exit %d: %s", args, code, errOut)
+		}
+	}
+	if out := env.mustRun("status"); !strings.Contains(out, "key epoch:      1\n") {
+		t.Fatalf("rejected rotation changed the vault:\n%s", out)
+	}
+}
+
+func TestRekey(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+	env.addEntry("GitHub", "hunter2")
+
+	out := env.mustRun("rekey", "--rotate-entry-keys")
+	if !strings.Contains(out, "key epoch 2") {
+		t.Fatalf("unexpected output: %q", out)
+	}
+	if out := env.mustRun("show", "--reveal", "GitHub"); !strings.Contains(out, "hunter2") {
+		t.Fatalf("entry unreadable after rekey:\n%s", out)
+	}
+}
@@ -0,0 +1,660 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	ysync "yap/internal/sync"
+	"yap/internal/vault"
+)
+
+const (
+	keepLocal  = "local"
+	keepRemote = "remote"
+	keepPick   = "pick"
+)
+
+// Conflict workflow after a diverged sync
+func init() {
+	register(&command{
+		name:    "conflict",
+		usage:   "show | resolve --keep local|remote|pick | merge | abort",
+		summary: "Inspect and resolve a diverged vault",
+		run:     runConflict,
+	})
+}
+
+type entryChangeDoc struct {
+	ID     string   `json:"id"`
+	Title  string   `json:"title"`
+	Change string   `json:"change"`
+	Fields []string `json:"fields,omitempty"`
+}
+
+type conflictDoc struct {
+	LocalVersion  uint64           `json:"local_vault_version"`
+	RemoteVersion uint64           `json:"remote_vault_version"`
+	Changes       []entryChangeDoc `json:"changes"`
+}
+
+type resolvedDoc struct {
+	Kept         string `json:"kept"`
+	VaultVersion uint64 `json:"vault_version"`
+}
+
+func runConflict(a *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: conflict needs a subcommand: show, resolve, merge or abort", errUsage)
+	}
+
+	switch args[0] {
+	case "show":
+		return runConflictShow(a, args[1:])
+	case "resolve":
+		return runConflictResolve(a, args[1:])
+	case "merge":
+		return runConflictMerge(a, args[1:])
+	case "abort":
+		return runConflictAbort(a, args[1:])
+	default:
+		return fmt.Errorf("%w: unknown conflict subcommand %q", errUsage, args[0])
+	}
+}
+
+func runConflictShow(a *app, args []string) error {
+	fs := a.newFlagSet("conflict")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	local, remote, _, err := a.openConflict(false, "")
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	defer remote.Close()
+
+	changes, _, err := diffVaults(local, remote)
+	if err != nil {
+		return err
+	}
+
+	doc := conflictDoc{
+		LocalVersion:  local.VaultVersion(),
+		RemoteVersion: remote.VaultVersion(),
+		Changes:       make([]entryChangeDoc, len(changes)),
+	}
+	for i, c := range changes {
+		doc.Changes[i] = entryChangeDoc{ID: c.ID, Title: c.Title, Change: string(c.Kind), Fields: c.Fields}
+	}
+
+	return a.render("conflict", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "local version %d, remote version %d\n", doc.LocalVersion, doc.RemoteVersion)
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "entries are identical")
+			return nil
+		}
+		for _, c := range changes {
+			fmt.Fprintln(w, describeChange(c))
+		}
+		return nil
+	})
+}
+
+/*
+* resolve
+*
+* 1) open both copies (one password prompt, two across a password change)
+* 2) build the kept vault, asking per entry with --keep pick
+* 3) commit it with a version above both parents
+* 4) rebase the branch onto the remote head and commit, so a plain push
+*    fast-forwards the remote
+* */
+func runConflictResolve(a *app, args []string) error {
+	fs := a.newFlagSet("conflict")
+	keep := fs.String("keep", "", "Which side to keep: local, remote or pick")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	switch *keep {
+	case keepLocal, keepRemote, keepPick:
+	default:
+		return fmt.Errorf("%w: --keep must be local, remote or pick", errUsage)
+	}
+
+	r, err := ysync.OpenRepo(a.cfg.RepoPath, a.cfg.VaultPath)
+	if err != nil {
+		return err
+	}
+	if err := a.checkConflictCurrent(r); err != nil {
+		return err
+	}
+
+	// 1) open both copies
+	local, remote, _, err := a.openConflict(false, *keep)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	defer remote.Close()
+
+	// 2) build the kept vault
+	kept, other := local, remote
+	if *keep == keepRemote {
+		kept, other = remote, local
+	}
+	if *keep == keepPick {
+		if err := a.pickEntries(local, remote); err != nil {
+			return err
+		}
+	}
+
+	// 3) + 4)
+	return a.finishResolve(r, kept, other, *keep)
+}
+
+/*
+* merge
+*
+* Three-way merge of the folders and entries against the last common
+* version. Only fields both sides changed differently are asked about.
+* */
+func runConflictMerge(a *app, args []string) error {
+	fs := a.newFlagSet("conflict")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	r, err := ysync.OpenRepo(a.cfg.RepoPath, a.cfg.VaultPath)
+	if err != nil {
+		return err
+	}
+	if err := a.checkConflictCurrent(r); err != nil {
+		return err
+	}
+
+	// 1) open base and both copies
+	local, remote, base, err := a.openConflict(true, keepLocal)
+	if err != nil {
+		return err
+	}
+	defer local.Close()
+	defer remote.Close()
+	defer base.Close()
+
+	// 2) merge folders and entries, and ask about true conflicts
+	var (
+		folders [3][]db.Folder
+		sets    [3][]db.Entry
+	)
+	for i, v := range []*vault.Vault{base, local, remote} {
+		if folders[i], err = v.ListFolders(); err != nil {
+			return err
+		}
+		if sets[i], err = v.ListAllEntries(); err != nil {
+			return err
+		}
+	}
+	fm := ysync.MergeFolders(folders[0], folders[1], folders[2])
+	remapFolders(sets[2], fm.RemoteIDs)
+	m := ysync.ThreeWayMerge(sets[0], sets[1], sets[2])
+
+	in := bufio.NewReader(a.stdin)
+	for i, c := range fm.Conflicts {
+		useRemote, err := a.askSide(in, describeFolderConflict(c), c.FolderID)
+		if err != nil {
+			return err
+		}
+		fm.Choose(i, useRemote)
+	}
+	for i, c := range m.Conflicts {
+		useRemote, err := a.askSide(in, describeMergeConflict(c), c.EntryID)
+		if err != nil {
+			return err
+		}
+		m.Choose(i, useRemote)
+	}
+
+	// Folders first so entries can move in, then drop the emptied ones
+	entries := m.Result()
+	wantFolders := fm.Result(entries)
+	if err := local.ApplyFolders(wantFolders, a.rng); err != nil {
+		return err
+	}
+	if err := a.applyEntries(local, remote, sets[1], entries); err != nil {
+		return err
+	}
+	if err := local.PruneFolders(wantFolders); err != nil {
+		return err
+	}
+
+	// 3) + 4)
+	return a.finishResolve(r, local, remote, "merge")
+}
+
+// finishResolve commits kept above both parents and rebases it onto the
+// remote head, so a plain push fast-forwards the remote.
+func (a *app) finishResolve(r *ysync.Repo, kept, other *vault.Vault, how string) error {
+	// 3) commit above both parents
+	if err := kept.AttachState(a.store); err != nil {
+		return err
+	}
+	if err := kept.Supersede(other.Header()); err != nil {
+		return err
+	}
+	if err := kept.Commit(a.cfg.VaultPath, a.rng); err != nil {
+		return err
+	}
+
+	// 4) rebase onto the remote head
+	if err := r.ResetToRemote(); err != nil {
+		return err
+	}
+	if _, err := r.CommitVault(); err != nil {
+		return err
+	}
+	if err := ysync.ClearConflict(a.cfg.VaultPath); err != nil {
+		return err
+	}
+
+	doc := resolvedDoc{Kept: how, VaultVersion: kept.VaultVersion()}
+	return a.render("conflict_resolved", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "resolved with %s, vault version %d; run 'yap push' to publish\n", doc.Kept, doc.VaultVersion)
+		return nil
+	})
+}
+
+// applyEntries turns v, currently holding current, into want. Entries v
+// lacks are imported from other with their password history.
+func (a *app) applyEntries(v, other *vault.Vault, current, want []db.Entry) error {
+	have := make(map[string]db.Entry, len(current))
+	for _, e := range current {
+		have[e.ID] = e
+	}
+
+	for _, e := range want {
+		old, ok := have[e.ID]
+		delete(have, e.ID)
+
+		switch {
+		case !ok:
+			if err := importEntry(v, other, e, a.rng); err != nil {
+				return err
+			}
+		case len(ysync.ChangedFields(old, e)) > 0:
+			// Keep the merged updated_at: the result is no newer than its sides
+			if err := applyEntry(v, other, e, a.rng); err != nil {
+				return err
+			}
+		}
+	}
+	// Gone from the merge: purged on one side
+	for id := range have {
+		if err := v.PurgeEntry(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runConflictAbort(a *app, args []string) error {
+	fs := a.newFlagSet("conflict")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if _, err := ysync.LoadConflict(a.cfg.VaultPath); err != nil {
+		return err
+	}
+	if err := ysync.ClearConflict(a.cfg.VaultPath); err != nil {
+		return err
+	}
+
+	return a.render("conflict_aborted", nil, func(w io.Writer) error {
+		fmt.Fprintln(w, "conflict copies removed; local vault unchanged")
+		return nil
+	})
+}
+
+// saveConflict keeps both sides of a divergence for later resolution.
+func (a *app) saveConflict(r *ysync.Repo) error {
+	local, err := os.ReadFile(a.cfg.VaultPath)
+	if err != nil {
+		return err
+	}
+	remote, err := r.RemoteVault()
+	if err != nil {
+		return err
+	}
+	base, err := r.MergeBaseVault()
+	if err != nil {
+		return err
+	}
+	localPath, remotePath := ysync.ConflictPaths(a.cfg.VaultPath)
+	if err := r.Exclude(localPath, remotePath, ysync.BasePath(a.cfg.VaultPath)); err != nil {
+		return err
+	}
+	return ysync.SaveConflict(a.cfg.VaultPath, &ysync.Conflict{Local: local, Remote: remote, Base: base})
+}
+
+// checkConflictCurrent refuses to resolve against a remote that moved
+// since the conflict was recorded.
+func (a *app) checkConflictCurrent(r *ysync.Repo) error {
+	c, err := ysync.LoadConflict(a.cfg.VaultPath)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Fetch(); err != nil {
+		return err
+	}
+	remote, err := r.RemoteVault()
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(remote, c.Remote) {
+		return fmt.Errorf("%w: remote changed since the conflict was recorded; run 'yap conflict abort' and sync again",
+			yerrors.ErrDiverged)
+	}
+	return nil
+}
+
+// openConflict decrypts both saved copies, and the common base when
+// withBase is set. keep names the side that will be committed, empty
+// when nothing is. Versions are not checked against trusted state:
+// either side may legitimately be older than what this device has seen.
+// Identity still is, and the key epoch of the kept side.
+func (a *app) openConflict(withBase bool, keep string) (local, remote, base *vault.Vault, err error) {
+	c, err := ysync.LoadConflict(a.cfg.VaultPath)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if withBase && c.Base == nil {
+		return nil, nil, nil, fmt.Errorf("%w: no common version to merge from; use 'yap conflict resolve'",
+			yerrors.ErrNotFound)
+	}
+	localFile, err := vault.DecodeFile(c.Local)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	remoteFile, err := vault.DecodeFile(c.Remote)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := checkConflictEpochs(keep, localFile.Header, remoteFile.Header); err != nil {
+		return nil, nil, nil, err
+	}
+
+	// The copy on the older key is only read, never committed
+	ctx := vault.OpenContext{ExpectedVaultID: localFile.Header.VaultID}
+	rec, err := a.store.Load(ctx.ExpectedVaultID)
+	if err == nil {
+		ctx.LastSeenKeyEpoch = rec.LastSeenKeyEpoch
+	} else if !errors.Is(err, yerrors.ErrNotFound) {
+		return nil, nil, nil, err
+	}
+	older := vault.OpenContext{ExpectedVaultID: ctx.ExpectedVaultID}
+	localCtx, remoteCtx := ctx, ctx
+	switch {
+	case localFile.Header.KeyEpoch < remoteFile.Header.KeyEpoch:
+		localCtx = older
+	case remoteFile.Header.KeyEpoch < localFile.Header.KeyEpoch:
+		remoteCtx = older
+	}
+
+	var passwords [][]byte
+	defer func() {
+		for _, pw := range passwords {
+			crypto.Wipe(pw)
+		}
+	}()
+
+	localPath, remotePath := ysync.ConflictPaths(a.cfg.VaultPath)
+	if local, err = a.openConflictCopy(localPath, keepLocal, &passwords, localCtx); err != nil {
+		return nil, nil, nil, err
+	}
+	if remote, err = a.openConflictCopy(remotePath, keepRemote, &passwords, remoteCtx); err != nil {
+		local.Close()
+		return nil, nil, nil, err
+	}
+	if withBase {
+		// The base may predate a rekey; only its identity matters
+		if base, err = a.openConflictCopy(ysync.BasePath(a.cfg.VaultPath), "base", &passwords, older); err != nil {
+			local.Close()
+			remote.Close()
+			return nil, nil, nil, err
+		}
+	}
+	return local, remote, base, nil
+}
+
+// openConflictCopy opens one saved copy of a conflict. A copy from the
+// other side of a password change needs its own password, so every
+// password given so far is tried before asking for another.
+func (a *app) openConflictCopy(path, name string, passwords *[][]byte, ctx vault.OpenContext) (*vault.Vault, error) {
+	for _, pw := range *passwords {
+		v, err := vault.Open(path, pw, ctx)
+		if err == nil {
+			return v, nil
+		}
+		if !errors.Is(err, yerrors.ErrAuthFailed) {
+			return nil, fmt.Errorf("%s copy: %w", name, err)
+		}
+	}
+
+	prompt := "Master password"
+	if len(*passwords) > 0 {
+		prompt = "Master password of the " + name + " copy"
+	}
+	pw, err := a.readPassword(prompt, false)
+	if err != nil {
+		return nil, err
+	}
+	*passwords = append(*passwords, pw)
+
+	v, err := vault.Open(path, pw, ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s copy: %w", name, err)
+	}
+	return v, nil
+}
+
+// checkConflictEpochs refuses to keep the copy on the older vault key:
+// committing it would undo the rekey or password change made on the
+// other side. An empty keep commits nothing and is always allowed.
+func checkConflictEpochs(keep string, local, remote *vault.VaultHeader) error {
+	kept, other, otherName := local, remote, keepRemote
+	switch keep {
+	case "":
+		return nil
+	case keepRemote:
+		kept, other, otherName = remote, local, keepLocal
+	}
+	if kept.KeyEpoch >= other.KeyEpoch {
+		return nil
+	}
+	return fmt.Errorf("%w: the %s copy was rekeyed or had its password changed (key epoch %d, this side %d), "+
+		"so only it can be kept: run 'yap conflict resolve --keep %s' and redo this side's changes, "+
+		"or 'yap conflict abort' to keep neither",
+		yerrors.ErrInvalidVault, otherName, other.KeyEpoch, kept.KeyEpoch, otherName)
+}
+
+// diffVaults lists the differing entries without changing either side.
+// Remote folders that local has under another id are mapped onto
+// local's, so entries compare by the folder they would land in. The
+// remote folders local lacks are returned by id, mapped the same way.
+func diffVaults(local, remote *vault.Vault) ([]ysync.EntryChange, map[string]db.Folder, error) {
+	lf, err := local.ListFolders()
+	if err != nil {
+		return nil, nil, err
+	}
+	rf, err := remote.ListFolders()
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := ysync.MatchFolders(lf, rf)
+
+	have := make(map[string]bool, len(lf))
+	for _, f := range lf {
+		have[f.ID] = true
+	}
+	missing := map[string]db.Folder{}
+	for _, f := range rf {
+		if _, ok := ids[f.ID]; ok || have[f.ID] {
+			continue
+		}
+		if id, ok := ids[f.ParentID]; ok {
+			f.ParentID = id
+		}
+		missing[f.ID] = f
+	}
+
+	le, err := local.ListAllEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+	re, err := remote.ListAllEntries()
+	if err != nil {
+		return nil, nil, err
+	}
+	remapFolders(re, ids)
+	return ysync.DiffEntries(le, re), missing, nil
+}
+
+// remapFolders points entries at the folders their own were merged into.
+func remapFolders(entries []db.Entry, ids map[string]string) {
+	for i := range entries {
+		if id, ok := ids[entries[i].FolderID]; ok {
+			entries[i].FolderID = id
+		}
+	}
+}
+
+// createFolders creates folder id of missing in v, with the ancestors v
+// lacks too, parents first. Created folders are removed from missing.
+func createFolders(v *vault.Vault, missing map[string]db.Folder, id string, rng crypto.RNG) error {
+	var chain []db.Folder
+	for f, ok := missing[id]; ok; f, ok = missing[f.ParentID] {
+		chain = append(chain, f)
+	}
+	for i := len(chain) - 1; i >= 0; i-- {
+		if _, err := v.CreateFolder(chain[i], rng); err != nil {
+			return err
+		}
+		delete(missing, chain[i].ID)
+	}
+	return nil
+}
+
+// pickEntries asks, for every differing entry, which side to keep and
+// applies remote choices to local. Only the remote folders of picked
+// entries are brought over.
+func (a *app) pickEntries(local, remote *vault.Vault) error {
+	changes, missing, err := diffVaults(local, remote)
+	if err != nil {
+		return err
+	}
+
+	in := bufio.NewReader(a.stdin)
+	for _, c := range changes {
+		useRemote, err := a.askSide(in, describeChange(c), c.ID)
+		if err != nil {
+			return err
+		}
+		if !useRemote {
+			continue
+		}
+		if c.Remote != nil {
+			if err := createFolders(local, missing, c.Remote.FolderID, a.rng); err != nil {
+				return err
+			}
+		}
+
+		switch c.Kind {
+		case ysync.ChangeLocalOnly:
+			// The remote never had it; a tombstone would be pushed
+			err = local.PurgeEntry(c.ID)
+		case ysync.ChangeRemoteOnly:
+			err = importEntry(local, remote, *c.Remote, a.rng)
+		case ysync.ChangeModified:
+			err = applyEntry(local, remote, *c.Remote, a.rng)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importEntry copies e from other into v, keeping its timestamps and
+// password history.
+func importEntry(v, other *vault.Vault, e db.Entry, rng crypto.RNG) error {
+	history, err := other.PasswordHistory(e.ID)
+	if err != nil {
+		return err
+	}
+	return v.ImportEntry(e, history, rng)
+}
+
+// applyEntry rewrites e in v as merged from other, keeping its
+// updated_at and the password history of both copies.
+func applyEntry(v, other *vault.Vault, e db.Entry, rng crypto.RNG) error {
+	history, err := other.PasswordHistory(e.ID)
+	if err != nil && !errors.Is(err, yerrors.ErrNotFound) {
+		return err
+	}
+	return v.ApplyEntry(e, history, rng)
+}
+
+// askSide prints what differs and reads a local/remote choice.
+func (a *app) askSide(in *bufio.Reader, what, entryID string) (useRemote bool, err error) {
+	fmt.Fprintf(a.stderr, "%s\nkeep [l]ocal or [r]emote? ", what)
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		return false, fmt.Errorf("%w: no choice for entry %s", errUsage, entryID)
+	}
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "l", "local":
+		return false, nil
+	case "r", "remote":
+		return true, nil
+	default:
+		return false, fmt.Errorf("%w: invalid choice %q for entry %s", errUsage, strings.TrimSpace(line), entryID)
+	}
+}
+
+func describeFolderConflict(c ysync.FolderConflict) string {
+	if c.Field == "name" {
+		return fmt.Sprintf("! folder %s (%s) renamed on both sides: %q locally, %q remotely",
+			c.Local.Name, c.FolderID, c.Local.Name, c.Remote.Name)
+	}
+	return fmt.Sprintf("! folder %s (%s) moved on both sides", c.Local.Name, c.FolderID)
+}
+
+func describeMergeConflict(c ysync.MergeConflict) string {
+	switch {
+	case c.Local == nil:
+		return fmt.Sprintf("! %s (%s) deleted locally, modified remotely", c.Title, c.EntryID)
+	case c.Remote == nil:
+		return fmt.Sprintf("! %s (%s) modified locally, deleted remotely", c.Title, c.EntryID)
+	default:
+		return fmt.Sprintf("! %s (%s) %s changed on both sides", c.Title, c.EntryID, c.Field)
+	}
+}
+
+func describeChange(c ysync.EntryChange) string {
+	switch c.Kind {
+	case ysync.ChangeLocalOnly:
+		return fmt.Sprintf("+ %s (%s) only in local", c.Title, c.ID)
+	case ysync.ChangeRemoteOnly:
+		return fmt.Sprintf("- %s (%s) only in remote", c.Title, c.ID)
+	default:
+		return fmt.Sprintf("~ %s (%s) differs: %s", c.Title, c.ID, strings.Join(c.Fields, ", "))
+	}
+}
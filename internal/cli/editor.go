@@ -0,0 +1,295 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+)
+
+/*
+* Entry editing document
+*
+* 	# comment lines are ignored
+* 	title: ...
+* 	type: login|note|card|identity|ssh_key|api
+* 	username: ...
+* 	password: ...
+* 	url: ...
+* 	totp: otpauth://... or a base32 secret
+* 	favorite: yes|no
+* 	tags: a, b
+* 	field NAME [KIND]: ...   (one line per custom field)
+* 	data NAME: ...           (one line per value of the type)
+* 	notes:
+* 	<every remaining line is notes>
+*
+* Passwords, custom field values and typed values that span several
+* lines or carry surrounding spaces, like private keys, are written as a
+* Go quoted string on one line.
+*
+* The document holds plaintext, so it lives in a private 0700 directory
+* in memory ($XDG_RUNTIME_DIR, else /dev/shm) and is removed as soon as
+* the editor exits. Without either, editing is refused rather than
+* writing plaintext to a disk.
+* */
+
+const defaultEditor = "vi"
+
+// shmDir is the memory-backed fallback for the editing document.
+var shmDir = "/dev/shm"
+
+// editEntry round-trips e through $EDITOR and returns the edited copy.
+func editEntry(a *app, e *db.Entry) (*db.Entry, error) {
+	parent, err := editDir()
+	if err != nil {
+		return nil, err
+	}
+	dir, err := os.MkdirTemp(parent, "yap-edit-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "entry.txt")
+	if err := os.WriteFile(path, []byte(formatEntryDoc(e)), 0o600); err != nil {
+		return nil, err
+	}
+
+	editor := strings.Fields(os.Getenv("EDITOR"))
+	if len(editor) == 0 {
+		editor = []string{defaultEditor}
+	}
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = a.stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor failed: %w", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	edited, err := parseEntryDoc(string(data))
+	if err != nil {
+		return nil, err
+	}
+	edited.ID = e.ID
+	edited.FolderID = e.FolderID
+	edited.CreatedAt = e.CreatedAt
+	edited.UpdatedAt = e.UpdatedAt
+	edited.DeletedAt = e.DeletedAt
+	return edited, nil
+}
+
+func formatEntryDoc(e *db.Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# yap entry %s\n", e.ID)
+	fmt.Fprintln(&b, "# Lines starting with # are ignored. Everything after 'notes:' is notes.")
+	fmt.Fprintf(&b, "title: %s\n", e.Title)
+	fmt.Fprintf(&b, "type: %s\n", entryType(e))
+	fmt.Fprintf(&b, "username: %s\n", e.Username)
+	fmt.Fprintf(&b, "password: %s\n", quoteValue(e.Password))
+	fmt.Fprintf(&b, "url: %s\n", e.URL)
+	fmt.Fprintf(&b, "totp: %s\n", e.TOTP)
+	favorite := "no"
+	if e.Favorite {
+		favorite = "yes"
+	}
+	fmt.Fprintf(&b, "favorite: %s\n", favorite)
+	fmt.Fprintf(&b, "tags: %s\n", strings.Join(e.Tags, ", "))
+	fmt.Fprintln(&b, "# Custom fields: 'field NAME [KIND]: VALUE', KIND is text, hidden, url or email.")
+	for _, f := range e.Fields {
+		fmt.Fprintf(&b, "field %s [%s]: %s\n", f.Name, f.Kind, quoteValue(f.Value))
+	}
+	if fields := db.TypeFields(entryType(e)); len(fields) > 0 {
+		fmt.Fprintf(&b, "# Values of the %s type, multi-line values quoted.\n", entryType(e))
+		for _, f := range fields {
+			fmt.Fprintf(&b, "data %s: %s\n", f.Name, quoteValue(e.Data[f.Name]))
+		}
+	}
+	fmt.Fprintln(&b, "notes:")
+	if e.Notes != "" {
+		fmt.Fprintln(&b, e.Notes)
+	}
+	return b.String()
+}
+
+// editDir returns the memory-backed directory the document is kept in.
+func editDir() (string, error) {
+	for _, dir := range []string{os.Getenv("XDG_RUNTIME_DIR"), shmDir} {
+		if dir == "" {
+			continue
+		}
+		if fi, err := os.Stat(dir); err == nil && fi.IsDir() {
+			return dir, nil
+		}
+	}
+	return "", fmt.Errorf("%w: no memory-backed directory for the editor; set XDG_RUNTIME_DIR or mount %s",
+		yerrors.ErrConfig, shmDir)
+}
+
+func parseEntryDoc(doc string) (*db.Entry, error) {
+	var (
+		e     db.Entry
+		notes []string
+		seen  = map[string]bool{}
+	)
+
+	inNotes := false
+	sc := bufio.NewScanner(strings.NewReader(doc))
+	for sc.Scan() {
+		line := sc.Text()
+		if inNotes {
+			notes = append(notes, line)
+			continue
+		}
+		if strings.HasPrefix(line, "#") || strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("%w: malformed line %q", errUsage, line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if seen[key] {
+			return nil, fmt.Errorf("%w: duplicate field %q", errUsage, key)
+		}
+		seen[key] = true
+
+		if name, ok := strings.CutPrefix(key, "field "); ok {
+			f, err := parseFieldKey(name)
+			if err != nil {
+				return nil, err
+			}
+			if f.Value, err = unquoteValue(value); err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errUsage, key, err)
+			}
+			e.Fields = append(e.Fields, f)
+			continue
+		}
+		if name, ok := strings.CutPrefix(key, "data "); ok {
+			v, err := unquoteValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %s: %w", errUsage, key, err)
+			}
+			if v != "" {
+				if e.Data == nil {
+					e.Data = map[string]string{}
+				}
+				e.Data[strings.TrimSpace(name)] = v
+			}
+			continue
+		}
+
+		switch key {
+		case "title":
+			e.Title = value
+		case "type":
+			t, err := db.ParseEntryType(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %w", errUsage, err)
+			}
+			e.Type = t
+		case "username":
+			e.Username = value
+		case "password":
+			v, err := unquoteValue(value)
+			if err != nil {
+				return nil, fmt.Errorf("%w: password: %w", errUsage, err)
+			}
+			e.Password = v
+		case "url":
+			e.URL = value
+		case "totp":
+			e.TOTP = value
+		case "favorite":
+			switch strings.ToLower(value) {
+			case "yes", "true":
+				e.Favorite = true
+			case "no", "false", "":
+			default:
+				return nil, fmt.Errorf("%w: favorite must be yes or no", errUsage)
+			}
+		case "tags":
+			e.Tags = splitTags(value)
+		case "notes":
+			inNotes = true
+			if value != "" {
+				notes = append(notes, value)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unknown field %q", errUsage, key)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+
+	if e.Title == "" {
+		return nil, fmt.Errorf("%w: title must not be empty", errUsage)
+	}
+	e.Notes = strings.TrimRight(strings.Join(notes, "\n"), "\n")
+	return &e, nil
+}
+
+// parseFieldKey parses the "NAME [KIND]" part of a custom field line.
+// Without a kind the field is text.
+func parseFieldKey(key string) (db.CustomField, error) {
+	f := db.CustomField{Name: key, Kind: db.FieldText}
+	if strings.HasSuffix(key, "]") {
+		if i := strings.LastIndex(key, " ["); i >= 0 {
+			kind, err := db.ParseFieldKind(key[i+2 : len(key)-1])
+			if err != nil {
+				return f, fmt.Errorf("%w: %w", errUsage, err)
+			}
+			f.Name, f.Kind = strings.TrimSpace(key[:i]), kind
+		}
+	}
+	return f, nil
+}
+
+// splitTags splits a comma separated tag list, ignoring empty items.
+func splitTags(s string) []string {
+	var tags []string
+	for _, t := range strings.Split(s, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// entryType returns the type of e, login when unset.
+func entryType(e *db.Entry) db.EntryType {
+	if e.Type == "" {
+		return db.TypeLogin
+	}
+	return e.Type
+}
+
+// quoteValue quotes v when it would not survive a "key: value" line,
+// whose value is trimmed on parsing.
+func quoteValue(v string) string {
+	if strings.Contains(v, "\n") || strings.HasPrefix(v, `"`) || strings.TrimSpace(v) != v {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+func unquoteValue(v string) (string, error) {
+	if strings.HasPrefix(v, `"`) {
+		return strconv.Unquote(v)
+	}
+	return v, nil
+}
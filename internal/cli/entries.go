@@ -0,0 +1,726 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	ysync "yap/internal/sync"
+	"yap/internal/vault"
+)
+
+const (
+	maskedPassword     = "********"
+	defaultGenerateLen = 24
+	passwordAlphabet   = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789!@#$%^&*()-_=+[]{}:,.?"
+)
+
+// Entry management commands
+func init() {
+	register(&command{
+		name:    "add",
+		usage:   "--title TITLE [--type T [--data NAME=VALUE]... [--data-file NAME=PATH]...] [--username U] [--url URL] [--notes N] [--totp-stdin | --totp-file PATH] [--folder F] [--tag T]... [--favorite] [--field [KIND:]NAME=VALUE]... [--field-file [KIND:]NAME=PATH]... [--generate [--length N] | --password-stdin]",
+		summary: "Add an entry",
+		run:     runAdd,
+	})
+	register(&command{
+		name:    "edit",
+		usage:   "<id|title>",
+		summary: "Edit an entry in $EDITOR",
+		run:     runEdit,
+	})
+	register(&command{
+		name:    "show",
+		usage:   "[--reveal] <id|title>",
+		summary: "Show an entry, password masked unless --reveal",
+		run:     runShow,
+	})
+	register(&command{
+		name:    "rm",
+		usage:   "<id|title>",
+		summary: "Move an entry to the trash",
+		run:     runRm,
+	})
+	register(&command{
+		name:    "list",
+		usage:   "[--folder F [--recursive]] [--tag T] [--favorite] [--type T]",
+		summary: "List entries",
+		run:     runList,
+	})
+	register(&command{
+		name:    "search",
+		usage:   "<query>",
+		summary: "Search titles, usernames, URLs and tags",
+		run:     runSearch,
+	})
+}
+
+func runAdd(a *app, args []string) error {
+	fs := a.newFlagSet("add")
+	var e db.Entry
+	fs.StringVar(&e.Title, "title", "", "Entry title (required)")
+	fs.StringVar(&e.Username, "username", "", "Username")
+	fs.StringVar(&e.URL, "url", "", "URL")
+	fs.StringVar(&e.Notes, "notes", "", "Notes")
+	folder := fs.String("folder", "", "Folder path or id")
+	var tags, fields, fieldFiles stringList
+	fs.Var(&tags, "tag", "Tag the entry (repeatable)")
+	fs.BoolVar(&e.Favorite, "favorite", false, "Mark the entry as a favorite")
+	fs.Var(&fields, "field", "Custom field [KIND:]NAME=VALUE, KIND is text, url or email (repeatable)")
+	fs.Var(&fieldFiles, "field-file", "Custom field read from a file, [KIND:]NAME=PATH, KIND may also be hidden (repeatable)")
+	entryType := fs.String("type", string(db.TypeLogin), "Entry type: login, note, card, identity, ssh_key or api")
+	var data, dataFiles stringList
+	fs.Var(&data, "data", "Value of the entry type, NAME=VALUE, not for secret values (repeatable)")
+	fs.Var(&dataFiles, "data-file", "Value of the entry type read from a file, NAME=PATH (repeatable)")
+	generate := fs.Bool("generate", false, "Generate a random password")
+	length := fs.Int("length", defaultGenerateLen, "Generated password length")
+	fromStdin := fs.Bool("password-stdin", false, "Read the entry password from the first line of stdin")
+	totpStdin := fs.Bool("totp-stdin", false, "Read the TOTP secret, an otpauth:// URI or base32, from the first line of stdin")
+	totpFile := fs.String("totp-file", "", "Read the TOTP secret, an otpauth:// URI or base32, from a file")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if e.Title == "" {
+		return fmt.Errorf("%w: --title is required", errUsage)
+	}
+	if *generate && *fromStdin {
+		return fmt.Errorf("%w: --generate and --password-stdin are exclusive", errUsage)
+	}
+	if *totpStdin && (*fromStdin || *totpFile != "") {
+		return fmt.Errorf("%w: --totp-stdin excludes --password-stdin and --totp-file", errUsage)
+	}
+	e.Tags = tags
+	for _, spec := range fields {
+		f, err := parseFieldFlag(spec)
+		if err != nil {
+			return err
+		}
+		e.Fields = append(e.Fields, f)
+	}
+	for _, spec := range fieldFiles {
+		f, err := parseFieldFile(spec)
+		if err != nil {
+			return err
+		}
+		e.Fields = append(e.Fields, f)
+	}
+	var err error
+	if e.Type, err = db.ParseEntryType(*entryType); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+	if e.Data, err = parseDataFlags(e.Type, data, dataFiles); err != nil {
+		return err
+	}
+
+	// Resolve secrets before unlocking so prompts don't interleave. Only
+	// logins ask for a password.
+	if err := promptData(e.Type, &e.Data); err != nil {
+		return err
+	}
+	switch {
+	case *totpStdin:
+		otp, err := readPasswordLine(a.stdin)
+		if err != nil {
+			return err
+		}
+		e.TOTP = string(otp)
+	case *totpFile != "":
+		otp, err := os.ReadFile(*totpFile)
+		if err != nil {
+			return err
+		}
+		e.TOTP = strings.TrimSpace(string(otp))
+	}
+	var secret []byte
+	switch {
+	case *generate:
+		secret, err = generatePassword(a.rng, *length)
+	case *fromStdin:
+		secret, err = readPasswordLine(a.stdin)
+	case e.Type == db.TypeLogin:
+		secret, err = promptTTY("Entry password")
+	}
+	if err != nil {
+		return err
+	}
+	e.Password = string(secret)
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	f, err := findFolder(v, *folder)
+	if err != nil {
+		return err
+	}
+	e.FolderID = folderID(f)
+
+	id, err := v.CreateEntry(e, a.rng)
+	if err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("entry_added", mutationDoc{ID: id, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "added %s (vault version %d)\n", id, v.VaultVersion())
+		if *generate {
+			fmt.Fprintln(w, "password generated; use 'yap show --reveal' to view it")
+		}
+		return nil
+	})
+}
+
+func runEdit(a *app, args []string) error {
+	fs := a.newFlagSet("edit")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: edit takes exactly one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	edited, err := editEntry(a, e)
+	if err != nil {
+		return err
+	}
+	if len(ysync.ChangedFields(*e, *edited)) == 0 {
+		return a.render("entry_unchanged", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+			fmt.Fprintln(w, "no changes")
+			return nil
+		})
+	}
+
+	if err := v.UpdateEntry(*edited, a.rng); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("entry_updated", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "updated %s (vault version %d)\n", e.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+func runShow(a *app, args []string) error {
+	fs := a.newFlagSet("show")
+	reveal := fs.Bool("reveal", false, "Print the password in clear text")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: show takes exactly one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	tree, err := loadFolderTree(v)
+	if err != nil {
+		return err
+	}
+	folder := tree.path(e.FolderID)
+
+	return a.render("entry", toEntryDoc(*e, folder, *reveal, true), func(w io.Writer) error {
+		password := maskedPassword
+		if *reveal {
+			password = e.Password
+		}
+
+		fmt.Fprintf(w, "id:        %s\n", e.ID)
+		fmt.Fprintf(w, "title:     %s\n", e.Title)
+		if t := entryType(e); t != db.TypeLogin {
+			fmt.Fprintf(w, "type:      %s\n", t)
+		}
+		if entryType(e) == db.TypeLogin || e.Username != "" || e.Password != "" || e.URL != "" {
+			fmt.Fprintf(w, "username:  %s\n", e.Username)
+			fmt.Fprintf(w, "password:  %s\n", password)
+			fmt.Fprintf(w, "url:       %s\n", e.URL)
+		}
+		if e.TOTP != "" {
+			fmt.Fprintf(w, "totp:      %s\n", showTOTP(e.TOTP, *reveal))
+		}
+		for _, f := range db.TypeFields(entryType(e)) {
+			value, ok := e.Data[f.Name]
+			if !ok {
+				continue
+			}
+			value = showDataValue(f, value, *reveal)
+			if strings.Contains(value, "\n") {
+				fmt.Fprintf(w, "%s:\n%s\n", f.Label, strings.TrimRight(value, "\n"))
+			} else {
+				fmt.Fprintf(w, "%s: %s\n", f.Label, value)
+			}
+		}
+		if fp := db.SSHFingerprint(e.Data["public_key"]); fp != "" && entryType(e) == db.TypeSSHKey {
+			fmt.Fprintf(w, "Fingerprint: %s\n", fp)
+		}
+		fmt.Fprintf(w, "folder:    %s\n", folder)
+		if e.Favorite {
+			fmt.Fprintln(w, "favorite:  yes")
+		}
+		if len(e.Tags) > 0 {
+			fmt.Fprintf(w, "tags:      %s\n", strings.Join(e.Tags, ", "))
+		}
+		for _, f := range e.Fields {
+			value := f.Value
+			if f.Kind == db.FieldHidden && !*reveal {
+				value = maskedPassword
+			}
+			fmt.Fprintf(w, "%s (%s): %s\n", f.Name, f.Kind, value)
+		}
+		fmt.Fprintf(w, "created:   %s\n", formatTime(e.CreatedAt))
+		fmt.Fprintf(w, "updated:   %s\n", formatTime(e.UpdatedAt))
+		if e.Notes != "" {
+			fmt.Fprintf(w, "notes:\n%s\n", e.Notes)
+		}
+		return nil
+	})
+}
+
+func runRm(a *app, args []string) error {
+	fs := a.newFlagSet("rm")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: rm takes exactly one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := v.DeleteEntry(e.ID); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("entry_removed", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "moved %s to the trash (vault version %d)\n", e.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+func runList(a *app, args []string) error {
+	fs := a.newFlagSet("list")
+	folder := fs.String("folder", "", "Only list entries in this folder")
+	recursive := fs.Bool("recursive", false, "With --folder, include its subfolders")
+	tag := fs.String("tag", "", "Only list entries with this tag")
+	favorite := fs.Bool("favorite", false, "Only list favorites")
+	typeName := fs.String("type", "", "Only list entries of this type")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *recursive && *folder == "" {
+		return fmt.Errorf("%w: --recursive needs --folder", errUsage)
+	}
+	var listType db.EntryType
+	if *typeName != "" {
+		t, err := db.ParseEntryType(*typeName)
+		if err != nil {
+			return fmt.Errorf("%w: %w", errUsage, err)
+		}
+		listType = t
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	entries, err := v.ListEntries()
+	if err != nil {
+		return err
+	}
+	tree, err := loadFolderTree(v)
+	if err != nil {
+		return err
+	}
+	if *folder != "" {
+		f, err := tree.resolve(*folder)
+		if err != nil {
+			return err
+		}
+		entries = filterFolder(entries, tree, folderID(f), *recursive)
+	}
+	if *tag != "" || *favorite {
+		entries = filterMarks(entries, *tag, *favorite)
+	}
+	if listType != "" {
+		entries = filterType(entries, listType)
+	}
+	return a.renderEntryList(entries, tree)
+}
+
+// filterFolder keeps the entries directly in folderID, or anywhere below
+// it when recursive.
+func filterFolder(entries []db.Entry, tree *folderTree, folderID string, recursive bool) []db.Entry {
+	in := map[string]bool{folderID: true}
+	if recursive {
+		for _, f := range tree.walk(folderID) {
+			in[f.ID] = true
+		}
+	}
+
+	var out []db.Entry
+	for _, e := range entries {
+		if in[e.FolderID] {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// filterMarks keeps the entries carrying tag, matched case-insensitively,
+// and only favorites when favorite is set.
+func filterMarks(entries []db.Entry, tag string, favorite bool) []db.Entry {
+	var out []db.Entry
+	for _, e := range entries {
+		if favorite && !e.Favorite {
+			continue
+		}
+		if tag != "" && !hasTag(e, tag) {
+			continue
+		}
+		out = append(out, e)
+	}
+	return out
+}
+
+func filterType(entries []db.Entry, t db.EntryType) []db.Entry {
+	var out []db.Entry
+	for _, e := range entries {
+		if entryType(&e) == t {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func hasTag(e db.Entry, tag string) bool {
+	for _, t := range e.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseFieldFlag parses an add --field value, [KIND:]NAME=VALUE.
+func parseFieldFlag(spec string) (db.CustomField, error) {
+	name, value, ok := strings.Cut(spec, "=")
+	if !ok {
+		return db.CustomField{}, fmt.Errorf("%w: --field wants [KIND:]NAME=VALUE, got %q", errUsage, spec)
+	}
+	f, err := parseFieldName(name)
+	if err != nil {
+		return f, err
+	}
+	// Secrets never come from argv
+	if f.Kind == db.FieldHidden {
+		return f, fmt.Errorf("%w: hidden field %q cannot be given on the command line; "+
+			"use --field-file hidden:%s=PATH or 'yap edit'", errUsage, f.Name, f.Name)
+	}
+	f.Value = value
+	return f, nil
+}
+
+// parseFieldFile reads an add --field-file [KIND:]NAME=PATH value, less
+// its trailing newline.
+func parseFieldFile(spec string) (db.CustomField, error) {
+	name, path, ok := strings.Cut(spec, "=")
+	if !ok {
+		return db.CustomField{}, fmt.Errorf("%w: --field-file wants [KIND:]NAME=PATH, got %q", errUsage, spec)
+	}
+	f, err := parseFieldName(name)
+	if err != nil {
+		return f, err
+	}
+	value, err := os.ReadFile(path)
+	if err != nil {
+		return f, err
+	}
+	f.Value = strings.TrimRight(string(value), "\r\n")
+	return f, nil
+}
+
+// parseFieldName splits [KIND:]NAME; the kind defaults to text.
+func parseFieldName(name string) (db.CustomField, error) {
+	f := db.CustomField{Name: name, Kind: db.FieldText}
+	if kind, rest, ok := strings.Cut(name, ":"); ok {
+		k, err := db.ParseFieldKind(kind)
+		if err != nil {
+			return f, fmt.Errorf("%w: %w", errUsage, err)
+		}
+		f.Kind, f.Name = k, rest
+	}
+	return f, nil
+}
+
+// parseDataFlags reads the add --data NAME=VALUE and --data-file
+// NAME=PATH values. Secret values of typ are only taken from files. The
+// rest of the type schema is checked when the entry is written.
+func parseDataFlags(typ db.EntryType, values, files []string) (map[string]string, error) {
+	secret := map[string]bool{}
+	for _, f := range db.TypeFields(typ) {
+		secret[f.Name] = f.Secret
+	}
+
+	var data map[string]string
+	set := func(name, value string) error {
+		if data == nil {
+			data = map[string]string{}
+		}
+		if _, dup := data[name]; dup {
+			return fmt.Errorf("%w: %s given twice", errUsage, name)
+		}
+		data[name] = value
+		return nil
+	}
+
+	for _, spec := range values {
+		name, value, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: --data wants NAME=VALUE, got %q", errUsage, spec)
+		}
+		if secret[name] {
+			return nil, fmt.Errorf("%w: %s is secret and cannot be given on the command line; "+
+				"use --data-file %s=PATH", errUsage, name, name)
+		}
+		if err := set(name, value); err != nil {
+			return nil, err
+		}
+	}
+	for _, spec := range files {
+		name, path, ok := strings.Cut(spec, "=")
+		if !ok {
+			return nil, fmt.Errorf("%w: --data-file wants NAME=PATH, got %q", errUsage, spec)
+		}
+		value, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err := set(name, string(value)); err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
+
+// promptData asks on the terminal for the required single-line secret
+// values of typ that no file gave.
+func promptData(typ db.EntryType, data *map[string]string) error {
+	for _, f := range db.TypeFields(typ) {
+		if !f.Secret || !f.Required || f.Multiline || (*data)[f.Name] != "" {
+			continue
+		}
+		value, err := promptTTY(f.Label)
+		if errors.Is(err, yerrors.ErrConfig) {
+			return fmt.Errorf("%w: no terminal to ask for %s; use --data-file %s=PATH",
+				yerrors.ErrConfig, f.Name, f.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if *data == nil {
+			*data = map[string]string{}
+		}
+		(*data)[f.Name] = string(value)
+	}
+	return nil
+}
+
+// showTOTP describes a TOTP secret without printing it unless reveal.
+func showTOTP(uri string, reveal bool) string {
+	if reveal {
+		return uri
+	}
+	otp, err := crypto.ParseTOTP(uri)
+	if err != nil {
+		return maskedPassword
+	}
+	return fmt.Sprintf("%s (%s, %d digits, %ds; 'yap otp' prints the code)",
+		maskedPassword, otp.Algorithm, otp.Digits, otp.Period)
+}
+
+// showDataValue masks secret typed values unless reveal. Card numbers
+// keep their last four digits.
+func showDataValue(f db.TypeField, value string, reveal bool) string {
+	if !f.Secret || reveal {
+		return value
+	}
+	if f.Name == "number" && len(value) > 4 {
+		return "**** " + value[len(value)-4:]
+	}
+	return maskedPassword
+}
+
+func runSearch(a *app, args []string) error {
+	fs := a.newFlagSet("search")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: search takes exactly one query", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	entries, err := v.ListEntries()
+	if err != nil {
+		return err
+	}
+	tree, err := loadFolderTree(v)
+	if err != nil {
+		return err
+	}
+	return a.renderEntryList(searchEntries(entries, fs.Arg(0)), tree)
+}
+
+// searchEntries matches query case-insensitively against non-secret fields.
+func searchEntries(entries []db.Entry, query string) []db.Entry {
+	q := strings.ToLower(query)
+
+	var out []db.Entry
+	for _, e := range entries {
+		if strings.Contains(strings.ToLower(e.Title), q) ||
+			strings.Contains(strings.ToLower(e.Username), q) ||
+			strings.Contains(strings.ToLower(e.URL), q) ||
+			matchesTag(e, q) {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+func matchesTag(e db.Entry, q string) bool {
+	for _, t := range e.Tags {
+		if strings.Contains(strings.ToLower(t), q) {
+			return true
+		}
+	}
+	return false
+}
+
+// renderEntryList prints entries without secrets or notes.
+func (a *app) renderEntryList(entries []db.Entry, tree *folderTree) error {
+	docs := make([]entryDoc, len(entries))
+	for i, e := range entries {
+		docs[i] = toEntryDoc(e, tree.path(e.FolderID), false, false)
+	}
+
+	return a.render("entry_list", docs, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTITLE\tTYPE\tUSERNAME\tURL\tFOLDER\tTAGS\tUPDATED")
+		for i, e := range entries {
+			title := e.Title
+			if e.Favorite {
+				title = "* " + title
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				e.ID, title, docs[i].Type, e.Username, e.URL, docs[i].Folder, strings.Join(e.Tags, ","), formatTime(e.UpdatedAt))
+		}
+		return tw.Flush()
+	})
+}
+
+// findEntry resolves ref among the entries outside the trash.
+func findEntry(v *vault.Vault, ref string) (*db.Entry, error) {
+	entries, err := v.ListEntries()
+	if err != nil {
+		return nil, err
+	}
+	return matchEntry(entries, ref)
+}
+
+// matchEntry resolves ref as an entry id, falling back to an exact
+// case-insensitive title match. Ambiguous titles are rejected.
+func matchEntry(entries []db.Entry, ref string) (*db.Entry, error) {
+	var matches []db.Entry
+	for _, e := range entries {
+		if e.ID == ref {
+			return &e, nil
+		}
+		if strings.EqualFold(e.Title, ref) {
+			matches = append(matches, e)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("%w: no entry matches %q", yerrors.ErrNotFound, ref)
+	case 1:
+		return &matches[0], nil
+	default:
+		ids := make([]string, len(matches))
+		for i, m := range matches {
+			ids[i] = m.ID
+		}
+		return nil, fmt.Errorf("%w: %q matches several entries, use an id: %s",
+			errUsage, ref, strings.Join(ids, ", "))
+	}
+}
+
+// generatePassword draws n characters uniformly from passwordAlphabet.
+func generatePassword(rng crypto.RNG, n int) ([]byte, error) {
+	if n < 8 || n > 256 {
+		return nil, fmt.Errorf("%w: password length must be 8-256", errUsage)
+	}
+
+	// Rejection sampling avoids modulo bias
+	limit := 256 - (256 % len(passwordAlphabet))
+	out := make([]byte, 0, n)
+	buf := make([]byte, 1)
+	for len(out) < n {
+		if _, err := rng.Read(buf); err != nil {
+			return nil, err
+		}
+		if int(buf[0]) >= limit {
+			continue
+		}
+		out = append(out, passwordAlphabet[int(buf[0])%len(passwordAlphabet)])
+	}
+	return out, nil
+}
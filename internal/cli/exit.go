@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"errors"
+	yerrors "yap/internal/errors"
+)
+
+// Process exit codes. These are part of the CLI contract for scripts.
+const (
+	ExitOK          = 0
+	ExitError       = 1 // unclassified failure
+	ExitUsage       = 2 // bad command line
+	ExitAuthFailed  = 3 // wrong password
+	ExitRollback    = 4 // rollback or downgrade detected
+	ExitInvalid     = 5 // invalid or corrupt vault
+	ExitConfig      = 6 // configuration error
+	ExitNotFound    = 7 // entry or vault not found
+	ExitUnsupported = 8 // command not available
+	ExitDiverged    = 9 // local and remote vault histories diverged
+)
+
+// errUsage marks command line mistakes.
+var errUsage = errors.New("usage error")
+
+// errUnsupported marks commands that exist but cannot run yet.
+var errUnsupported = errors.New("not supported")
+
+// errorClass pairs a sentinel with its stable JSON code and exit code.
+// Order matters: the first match wins.
+type errorClass struct {
+	err  error
+	code string
+	exit int
+}
+
+var errorClasses = []errorClass{
+	{errUsage, "usage", ExitUsage},
+	{yerrors.ErrAuthFailed, "auth_failed", ExitAuthFailed},
+	{yerrors.ErrRollbackDetected, "rollback_detected", ExitRollback},
+	{yerrors.ErrInvalidVault, "invalid_vault", ExitInvalid},
+	{yerrors.ErrCorruptData, "corrupt_data", ExitInvalid},
+	{yerrors.ErrCryptoFailure, "crypto_failure", ExitInvalid},
+	{yerrors.ErrConfig, "config", ExitConfig},
+	{yerrors.ErrInvalidInput, "invalid_input", ExitUsage},
+	{yerrors.ErrNotFound, "not_found", ExitNotFound},
+	{errUnsupported, "unsupported", ExitUnsupported},
+	{yerrors.ErrDiverged, "diverged", ExitDiverged},
+}
+
+// classify maps an error onto its stable error code and exit code.
+func classify(err error) (code string, exit int) {
+	if err == nil {
+		return "", ExitOK
+	}
+	for _, c := range errorClasses {
+		if errors.Is(err, c.err) {
+			return c.code, c.exit
+		}
+	}
+	return "error", ExitError
+}
+
+// exitCode maps an error onto the exit code contract.
+func exitCode(err error) int {
+	_, exit := classify(err)
+	return exit
+}
@@ -0,0 +1,438 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/vault"
+)
+
+/*
+* Folders
+*
+* Folders are addressed by path, "Work/Email", matched name by name and
+* case-insensitively from the root, or by id. "/" is the root.
+* */
+
+const rootFolder = "/"
+
+// Folder commands
+func init() {
+	register(&command{
+		name:    "folder",
+		usage:   "add [--parents] <path> | list | rename <folder> <name> | move <folder> <parent> | rm <folder>",
+		summary: "Manage folders",
+		run:     runFolder,
+	})
+	register(&command{
+		name:    "mv",
+		usage:   "<id|title> <folder>",
+		summary: "Move an entry to a folder, / for the root",
+		run:     runMv,
+	})
+}
+
+type folderDoc struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	ParentID  string `json:"parent_id,omitempty"`
+	Entries   int    `json:"entries"`
+	CreatedAt int64  `json:"created_at"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func runFolder(a *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: folder needs a subcommand: add, list, rename, move or rm", errUsage)
+	}
+	switch args[0] {
+	case "add":
+		return runFolderAdd(a, args[1:])
+	case "list":
+		return runFolderList(a, args[1:])
+	case "rename":
+		return runFolderRename(a, args[1:])
+	case "move":
+		return runFolderMove(a, args[1:])
+	case "rm":
+		return runFolderRm(a, args[1:])
+	default:
+		return fmt.Errorf("%w: unknown folder subcommand %q", errUsage, args[0])
+	}
+}
+
+func runFolderAdd(a *app, args []string) error {
+	fs := a.newFlagSet("folder")
+	parents := fs.Bool("parents", false, "Create missing parent folders")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: folder add takes exactly one path", errUsage)
+	}
+	names := splitFolderPath(fs.Arg(0))
+	if len(names) == 0 {
+		return fmt.Errorf("%w: folder path is empty", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	tree, err := loadFolderTree(v)
+	if err != nil {
+		return err
+	}
+
+	// Walk the existing prefix, then create the rest
+	parent, i := "", 0
+	for ; i < len(names)-1; i++ {
+		f := tree.child(parent, names[i])
+		if f == nil {
+			break
+		}
+		parent = f.ID
+	}
+	if i < len(names)-1 && !*parents {
+		return fmt.Errorf("%w: folder %q does not exist; use --parents to create it",
+			yerrors.ErrNotFound, strings.Join(names[:i+1], rootFolder))
+	}
+
+	var id string
+	for ; i < len(names); i++ {
+		if id, err = v.CreateFolder(db.Folder{ParentID: parent, Name: names[i]}, a.rng); err != nil {
+			return err
+		}
+		parent = id
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("folder_added", mutationDoc{ID: id, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "added folder %s (vault version %d)\n", id, v.VaultVersion())
+		return nil
+	})
+}
+
+func runFolderList(a *app, args []string) error {
+	fs := a.newFlagSet("folder")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	tree, err := loadFolderTree(v)
+	if err != nil {
+		return err
+	}
+	entries, err := v.ListEntries()
+	if err != nil {
+		return err
+	}
+	counts := map[string]int{}
+	for _, e := range entries {
+		counts[e.FolderID]++
+	}
+
+	folders := tree.walk("")
+	docs := make([]folderDoc, len(folders))
+	for i, f := range folders {
+		docs[i] = folderDoc{
+			ID:        f.ID,
+			Path:      tree.path(f.ID),
+			ParentID:  f.ParentID,
+			Entries:   counts[f.ID],
+			CreatedAt: f.CreatedAt,
+			UpdatedAt: f.UpdatedAt,
+		}
+	}
+
+	return a.render("folder_list", docs, func(w io.Writer) error {
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tPATH\tENTRIES")
+		for _, d := range docs {
+			fmt.Fprintf(tw, "%s\t%s\t%d\n", d.ID, d.Path, d.Entries)
+		}
+		return tw.Flush()
+	})
+}
+
+func runFolderRename(a *app, args []string) error {
+	fs := a.newFlagSet("folder")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: folder rename takes a folder and a new name", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	f, err := findFolder(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return fmt.Errorf("%w: the root folder cannot be renamed", errUsage)
+	}
+	if err := v.RenameFolder(f.ID, fs.Arg(1), a.rng); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("folder_updated", mutationDoc{ID: f.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "renamed folder %s (vault version %d)\n", f.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+func runFolderMove(a *app, args []string) error {
+	fs := a.newFlagSet("folder")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: folder move takes a folder and its new parent", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	f, err := findFolder(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return fmt.Errorf("%w: the root folder cannot be moved", errUsage)
+	}
+	parent, err := findFolder(v, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := v.MoveFolder(f.ID, folderID(parent)); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("folder_updated", mutationDoc{ID: f.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "moved folder %s (vault version %d)\n", f.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+func runFolderRm(a *app, args []string) error {
+	fs := a.newFlagSet("folder")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: folder rm takes exactly one folder", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	f, err := findFolder(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if f == nil {
+		return fmt.Errorf("%w: the root folder cannot be removed", errUsage)
+	}
+	if err := v.DeleteFolder(f.ID); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("folder_removed", mutationDoc{ID: f.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "removed folder %s (vault version %d)\n", f.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+func runMv(a *app, args []string) error {
+	fs := a.newFlagSet("mv")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: mv takes an entry and a folder", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	f, err := findFolder(v, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	if err := v.MoveEntry(e.ID, folderID(f)); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("entry_updated", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "moved %s (vault version %d)\n", e.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+// folderTree indexes the decrypted folders of a vault.
+type folderTree struct {
+	byID map[string]db.Folder
+}
+
+func loadFolderTree(v *vault.Vault) (*folderTree, error) {
+	folders, err := v.ListFolders()
+	if err != nil {
+		return nil, err
+	}
+	t := &folderTree{byID: make(map[string]db.Folder, len(folders))}
+	for _, f := range folders {
+		t.byID[f.ID] = f
+	}
+	return t, nil
+}
+
+// path returns the folder path of id, "/" for the root.
+func (t *folderTree) path(id string) string {
+	var names []string
+	for id != "" {
+		f, ok := t.byID[id]
+		if !ok {
+			break
+		}
+		names = append([]string{f.Name}, names...)
+		id = f.ParentID
+	}
+	if len(names) == 0 {
+		return rootFolder
+	}
+	return strings.Join(names, rootFolder)
+}
+
+// children returns the folders directly under parentID, by name.
+func (t *folderTree) children(parentID string) []db.Folder {
+	var out []db.Folder
+	for _, f := range t.byID {
+		if f.ParentID == parentID {
+			out = append(out, f)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if !strings.EqualFold(out[i].Name, out[j].Name) {
+			return strings.ToLower(out[i].Name) < strings.ToLower(out[j].Name)
+		}
+		return out[i].ID < out[j].ID
+	})
+	return out
+}
+
+func (t *folderTree) child(parentID, name string) *db.Folder {
+	for _, f := range t.children(parentID) {
+		if strings.EqualFold(f.Name, name) {
+			return &f
+		}
+	}
+	return nil
+}
+
+// walk returns every folder below parentID, depth first, by name.
+func (t *folderTree) walk(parentID string) []db.Folder {
+	var out []db.Folder
+	for _, f := range t.children(parentID) {
+		out = append(out, f)
+		out = append(out, t.walk(f.ID)...)
+	}
+	return out
+}
+
+// resolve finds ref as a folder path or id. The root is returned as nil.
+func (t *folderTree) resolve(ref string) (*db.Folder, error) {
+	names := splitFolderPath(ref)
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	var (
+		f      *db.Folder
+		parent string
+	)
+	for _, name := range names {
+		if f = t.child(parent, name); f == nil {
+			break
+		}
+		parent = f.ID
+	}
+	if f != nil {
+		return f, nil
+	}
+	if byID, ok := t.byID[ref]; ok {
+		return &byID, nil
+	}
+	return nil, fmt.Errorf("%w: no folder matches %q", yerrors.ErrNotFound, ref)
+}
+
+// findFolder resolves ref against the folders of v. The root is nil.
+func findFolder(v *vault.Vault, ref string) (*db.Folder, error) {
+	tree, err := loadFolderTree(v)
+	if err != nil {
+		return nil, err
+	}
+	return tree.resolve(ref)
+}
+
+func folderID(f *db.Folder) string {
+	if f == nil {
+		return ""
+	}
+	return f.ID
+}
+
+// splitFolderPath splits a path on "/", ignoring empty segments.
+func splitFolderPath(p string) []string {
+	var names []string
+	for _, name := range strings.Split(p, rootFolder) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
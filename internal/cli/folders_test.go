@@ -0,0 +1,65 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFolderCommands(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+
+	if _, _, code := env.run("folder", "add", "Work/Email"); code != ExitNotFound {
+		t.Fatalf("missing parent: expected exit %d, got %d", ExitNotFound, code)
+	}
+	env.mustRun("folder", "add", "--parents", "Work/Email")
+	env.mustRun("folder", "add", "Personal")
+	if _, _, code := env.run("folder", "add", "work"); code != ExitUsage {
+		t.Fatalf("duplicate folder: expected exit %d, got %d", ExitUsage, code)
+	}
+
+	env.addEntry("GitHub", "hunter2", "--folder", "work")
+	env.addEntry("Gmail", "s3cret", "--folder", "Work/Email")
+	env.addEntry("Bank", "money")
+
+	out := env.mustRun("list", "--folder", "Work")
+	if !strings.Contains(out, "GitHub") || strings.Contains(out, "Gmail") || strings.Contains(out, "Bank") {
+		t.Fatalf("unexpected folder listing:\n%s", out)
+	}
+	out = env.mustRun("list", "--folder", "Work", "--recursive")
+	if !strings.Contains(out, "GitHub") || !strings.Contains(out, "Gmail") || strings.Contains(out, "Bank") {
+		t.Fatalf("unexpected recursive listing:\n%s", out)
+	}
+	out = env.mustRun("list", "--folder", "/")
+	if !strings.Contains(out, "Bank") || strings.Contains(out, "GitHub") {
+		t.Fatalf("unexpected root listing:\n%s", out)
+	}
+
+	env.mustRun("mv", "Bank", "Personal")
+	if out := env.mustRun("show", "Bank"); !strings.Contains(out, "folder:    Personal") {
+		t.Fatalf("entry not moved:\n%s", out)
+	}
+
+	env.mustRun("folder", "rename", "Work/Email", "Mail")
+	env.mustRun("folder", "move", "Work/Mail", "Personal")
+	if _, _, code := env.run("folder", "move", "Personal", "Personal/Mail"); code != ExitUsage {
+		t.Fatalf("cycle: expected exit %d, got %d", ExitUsage, code)
+	}
+	out = env.mustRun("folder", "list")
+	if !strings.Contains(out, "Personal/Mail") || strings.Contains(out, "Work/") {
+		t.Fatalf("unexpected folder tree:\n%s", out)
+	}
+
+	if _, _, code := env.run("folder", "rm", "Personal"); code != ExitUsage {
+		t.Fatalf("non-empty folder: expected exit %d, got %d", ExitUsage, code)
+	}
+	env.mustRun("mv", "Gmail", "/")
+	env.mustRun("folder", "rm", "Personal/Mail")
+
+	// Folder keys follow the vault key through a rekey
+	env.mustRun("rekey", "--rotate-entry-keys")
+	out = env.mustRun("list", "--folder", "Personal")
+	if !strings.Contains(out, "Bank") {
+		t.Fatalf("folder lost after rekey:\n%s", out)
+	}
+}
@@ -0,0 +1,227 @@
+package cli
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+	ysync "yap/internal/sync"
+	"yap/internal/vault"
+)
+
+// Password history and repository history maintenance
+func init() {
+	register(&command{
+		name: "history",
+		usage: "[list] [--reveal] <id|title> | restore <id|title> <N> | limit [N]" +
+			" | purge [--keep-from VERSION | --squash] [--yes] [--remote NAME] [--branch NAME]",
+		summary: "List or restore old passwords of an entry; purge drops old vault ciphertexts from Git",
+		run:     runHistory,
+	})
+}
+
+type purgeDoc struct {
+	Remote      string `json:"remote"`
+	Branch      string `json:"branch"`
+	OldHead     string `json:"old_head"`
+	NewHead     string `json:"new_head"`
+	Kept        int    `json:"kept_commits"`
+	Dropped     int    `json:"dropped_commits"`
+	KeepFrom    uint64 `json:"keep_from_version"`
+	PushCommand string `json:"push_command"`
+}
+
+func runHistory(a *app, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: history needs an entry or a subcommand: list, restore, limit or purge", errUsage)
+	}
+
+	// Anything else is an entry, listed
+	switch args[0] {
+	case "list":
+		return runHistoryList(a, args[1:])
+	case "restore":
+		return runHistoryRestore(a, args[1:])
+	case "limit":
+		return runHistoryLimit(a, args[1:])
+	case "purge":
+		return runHistoryPurge(a, args[1:])
+	default:
+		return runHistoryList(a, args)
+	}
+}
+
+/*
+* purge
+*
+* 1) require local and remote to agree, with the vault committed
+* 2) pick the oldest commit to keep (default: first at the current key epoch)
+* 3) build the new history and decrypt the vault at its head
+* 4) print the force push and ask before running it
+* 5) push with a lease on the old remote head, then prune local objects
+*
+* Other clones still hold the old history and must be cloned again.
+* */
+func runHistoryPurge(a *app, args []string) error {
+	fs := a.newFlagSet("history")
+	remote, branch := syncFlags(fs)
+	keepFrom := fs.Uint64("keep-from", 0, "Keep commits from this vault version on (default: since the last rekey)")
+	squash := fs.Bool("squash", false, "Replace the whole history with one commit")
+	yes := fs.Bool("yes", false, "Do not ask before force pushing")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: history purge takes no arguments", errUsage)
+	}
+	if *squash && *keepFrom != 0 {
+		return fmt.Errorf("%w: --keep-from and --squash are exclusive", errUsage)
+	}
+
+	r, err := ysync.OpenRepo(a.cfg.RepoPath, a.cfg.VaultPath)
+	if err != nil {
+		return err
+	}
+	r.Remote = *remote
+	if *branch != "" {
+		r.Branch = *branch
+	}
+
+	// 1) local and remote must agree
+	if _, err := ysync.LoadConflict(a.cfg.VaultPath); err == nil {
+		return fmt.Errorf("%w: a conflict is pending; run 'yap conflict resolve' first", yerrors.ErrDiverged)
+	}
+	exists, err := r.Fetch()
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: %s/%s does not exist", yerrors.ErrNotFound, r.Remote, r.Branch)
+	}
+	st, err := r.Status()
+	if err != nil {
+		return err
+	}
+	if st.VaultChanged || st.Ahead > 0 || st.Behind > 0 {
+		return fmt.Errorf("%w: local and %s/%s differ; run 'yap sync' first",
+			yerrors.ErrDiverged, r.Remote, r.Branch)
+	}
+
+	// 2) oldest commit to keep
+	history, err := r.VaultHistory()
+	if err != nil {
+		return err
+	}
+	head := history[len(history)-1]
+	if head.VaultVersion == 0 {
+		return fmt.Errorf("%w: %s/%s has no vault file", yerrors.ErrNotFound, r.Remote, r.Branch)
+	}
+
+	from := 0
+	switch {
+	case *squash:
+		from = len(history) - 1
+	case *keepFrom != 0:
+		if *keepFrom > head.VaultVersion {
+			return fmt.Errorf("%w: --keep-from %d is newer than vault version %d",
+				errUsage, *keepFrom, head.VaultVersion)
+		}
+		for from < len(history) && history[from].VaultVersion < *keepFrom {
+			from++
+		}
+	default:
+		from = len(history) - 1
+		for from > 0 && history[from-1].KeyEpoch == head.KeyEpoch {
+			from--
+		}
+	}
+
+	doc := purgeDoc{
+		Remote:   r.Remote,
+		Branch:   r.Branch,
+		OldHead:  st.Head,
+		NewHead:  st.Head,
+		Kept:     len(history) - from,
+		Dropped:  from,
+		KeepFrom: history[from].VaultVersion,
+	}
+	if from == 0 {
+		return a.renderPurge(doc)
+	}
+
+	// 3) rewrite and verify the new head
+	newHead, err := r.RewriteHistory(history, from, *squash)
+	if err != nil {
+		return err
+	}
+	data, err := r.VaultAt(newHead)
+	if err != nil {
+		return err
+	}
+	vf, err := vault.DecodeFile(data)
+	if err != nil {
+		return err
+	}
+	password, err := a.readPassword("Master password", false)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(password)
+	if _, err := vault.Verify(data, password, vault.OpenContext{
+		ExpectedVaultID: vf.Header.VaultID,
+		State:           a.store,
+	}); err != nil {
+		return fmt.Errorf("rewritten head does not open, nothing pushed: %w", err)
+	}
+	doc.NewHead = newHead
+
+	// 4) show the force push
+	pushArgs := append([]string{"git", "-C", r.Dir()}, r.ForcePushArgs(newHead, st.RemoteHead)...)
+	doc.PushCommand = strings.Join(pushArgs, " ")
+
+	fmt.Fprintf(a.stderr, "keeping %d of %d commits (vault version %d onward)\n",
+		doc.Kept, len(history), doc.KeepFrom)
+	fmt.Fprintf(a.stderr, "will run: %s\n", doc.PushCommand)
+	if !*yes {
+		if err := a.confirm("force push the rewritten history?"); err != nil {
+			return err
+		}
+	}
+
+	// 5) push and adopt
+	if err := r.ForcePush(newHead, st.RemoteHead); err != nil {
+		return err
+	}
+	if err := r.AdoptRewrite(newHead); err != nil {
+		return fmt.Errorf("remote rewritten but local update failed: %w", err)
+	}
+	return a.renderPurge(doc)
+}
+
+// confirm asks a yes/no question on stdin; anything but yes aborts.
+func (a *app) confirm(question string) error {
+	fmt.Fprintf(a.stderr, "%s [y/N] ", question)
+	line, _ := bufio.NewReader(a.stdin).ReadString('\n')
+
+	switch strings.ToLower(strings.TrimSpace(line)) {
+	case "y", "yes":
+		return nil
+	default:
+		return fmt.Errorf("%w: aborted", errUsage)
+	}
+}
+
+func (a *app) renderPurge(doc purgeDoc) error {
+	return a.render("history_purged", doc, func(w io.Writer) error {
+		if doc.Dropped == 0 {
+			fmt.Fprintf(w, "nothing to purge on %s/%s\n", doc.Remote, doc.Branch)
+			return nil
+		}
+		fmt.Fprintf(w, "dropped %d commits, kept %d; %s/%s is now %s\n",
+			doc.Dropped, doc.Kept, doc.Remote, doc.Branch, doc.NewHead)
+		fmt.Fprintln(w, "other clones still hold the old history and must be cloned again")
+		return nil
+	})
+}
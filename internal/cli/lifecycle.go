@@ -0,0 +1,397 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/keys"
+	ysync "yap/internal/sync"
+	"yap/internal/vault"
+)
+
+// Vault lifecycle commands
+func init() {
+	register(&command{
+		name:    "init",
+		usage:   "[--padding pow2|bucket|none] [--padding-size BYTES]",
+		summary: "Create a new vault at -vault",
+		run:     runInit,
+	})
+	register(&command{
+		name:    "open",
+		usage:   "",
+		summary: "Unlock and verify the vault, recording it as trusted state",
+		run:     runOpen,
+	})
+	register(&command{
+		name:    "status",
+		usage:   "",
+		summary: "Show vault versions, key epoch and last writer",
+		run:     runStatus,
+	})
+	register(&command{
+		name:    "lock",
+		usage:   "",
+		summary: "Remove decrypted working copies left by older versions of yap",
+		noVault: true,
+		run:     runLock,
+	})
+	register(&command{
+		name:    "rotate-password",
+		usage:   "[--new-password-file PATH] [--argon-memory KIB] [--argon-iterations N] [--argon-parallelism N]",
+		summary: "Change the master password",
+		run:     runRotatePassword,
+	})
+	register(&command{
+		name:    "rekey",
+		usage:   "[--rotate-entry-keys] [--batch N]",
+		summary: "Generate a new vault key and re-encrypt all entry keys",
+		run:     runRekey,
+	})
+}
+
+func runInit(a *app, args []string) error {
+	fs := a.newFlagSet("init")
+	def := vault.DefaultPadding()
+	scheme := fs.String("padding", def.Scheme, "Payload padding: pow2, bucket or none")
+	size := fs.Uint("padding-size", uint(def.Size), "Smallest padded size (pow2) or bucket size, in bytes")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	if *size > 1<<32-1 {
+		return fmt.Errorf("%w: --padding-size too large", errUsage)
+	}
+	padding := vault.PaddingParams{Scheme: *scheme, Size: uint32(*size)}
+	if padding.Scheme == vault.PaddingNone {
+		padding.Size = 0
+	}
+	if err := padding.Validate(); err != nil {
+		return fmt.Errorf("%w: %w", errUsage, err)
+	}
+
+	device, err := a.store.Device()
+	if err != nil {
+		return err
+	}
+
+	password, err := a.readPassword("New master password", true)
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(password)
+
+	header, err := vault.Create(a.cfg.VaultPath, password, vault.CreateOptions{
+		Device:  *device,
+		Padding: &padding,
+		RNG:     a.rng,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := a.store.Save(header.VaultID, header.VaultVersion, header.KeyEpoch); err != nil {
+		return fmt.Errorf("vault created but local state update failed: %w", err)
+	}
+
+	return a.render("vault_created", vaultDoc{
+		Path:         a.cfg.VaultPath,
+		VaultID:      header.VaultID,
+		VaultVersion: header.VaultVersion,
+		KeyEpoch:     header.KeyEpoch,
+	}, func(w io.Writer) error {
+		fmt.Fprintf(w, "created vault %s at %s\n", header.VaultID, a.cfg.VaultPath)
+		fmt.Fprintln(w, "there is no password recovery: losing the master password loses the vault")
+		return nil
+	})
+}
+
+func runOpen(a *app, args []string) error {
+	fs := a.newFlagSet("open")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	return a.render("vault_opened", vaultDoc{
+		Path:         v.Path(),
+		VaultID:      v.ID(),
+		VaultVersion: v.VaultVersion(),
+		KeyEpoch:     v.KeyEpoch(),
+	}, func(w io.Writer) error {
+		fmt.Fprintf(w, "vault %s opened (version %d, key epoch %d)\n",
+			v.ID(), v.VaultVersion(), v.KeyEpoch())
+		return nil
+	})
+}
+
+func runStatus(a *app, args []string) error {
+	fs := a.newFlagSet("status")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	h := v.Header()
+	meta := v.Metadata()
+	ids, err := v.ListEntryIDs()
+	if err != nil {
+		return err
+	}
+
+	doc := statusDoc{
+		Path:               v.Path(),
+		VaultID:            v.ID(),
+		VaultVersion:       h.VaultVersion,
+		KeyEpoch:           h.KeyEpoch,
+		CreatedAt:          h.CreatedAt,
+		LastModified:       h.LastModified,
+		CreatedBy:          meta.CreatedBy,
+		LastWriter:         meta.LastWriter,
+		LastWriterDeviceID: meta.DeviceID,
+		EntryCount:         len(ids),
+		SchemaVersion:      v.StoredSchemaVersion(),
+		Padding:            vault.PaddingNone,
+	}
+	if h.Padding != nil {
+		doc.Padding, doc.PaddingSize = h.Padding.Scheme, h.Padding.Size
+	}
+	if device, err := a.store.Device(); err == nil {
+		doc.Device = &deviceDoc{ID: device.ID, Label: device.Label}
+	}
+
+	return a.render("status", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "vault:          %s\n", doc.Path)
+		fmt.Fprintf(w, "vault id:       %s\n", doc.VaultID)
+		fmt.Fprintf(w, "vault version:  %d\n", doc.VaultVersion)
+		fmt.Fprintf(w, "key epoch:      %d\n", doc.KeyEpoch)
+		fmt.Fprintf(w, "created:        %s by %s\n", formatTime(doc.CreatedAt), doc.CreatedBy)
+		fmt.Fprintf(w, "last modified:  %s\n", formatTime(doc.LastModified))
+		fmt.Fprintf(w, "last writer:    %s (%s)\n", doc.LastWriter, doc.LastWriterDeviceID)
+		fmt.Fprintf(w, "entries:        %d\n", doc.EntryCount)
+		if doc.SchemaVersion < db.SchemaVersion {
+			fmt.Fprintf(w, "schema:         %d (upgraded to %d on the next change)\n", doc.SchemaVersion, db.SchemaVersion)
+		} else {
+			fmt.Fprintf(w, "schema:         %d\n", doc.SchemaVersion)
+		}
+		if doc.PaddingSize != 0 {
+			fmt.Fprintf(w, "padding:        %s (%d bytes)\n", doc.Padding, doc.PaddingSize)
+		} else {
+			fmt.Fprintf(w, "padding:        %s\n", doc.Padding)
+		}
+		if doc.Device != nil {
+			fmt.Fprintf(w, "this device:    %s (%s)\n", doc.Device.Label, doc.Device.ID)
+		}
+		return nil
+	})
+}
+
+// runLock removes decrypted SQLite working copies. The database is now
+// kept in memory, but older versions wrote it to the temp directory and a
+// crashed session could leave it there.
+func runLock(a *app, args []string) error {
+	fs := a.newFlagSet("lock")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	matches, err := filepath.Glob(filepath.Join(os.TempDir(), "yap-vault-*.db*"))
+	if err != nil {
+		return err
+	}
+
+	removed := 0
+	for _, m := range matches {
+		// Another process may have removed it since the glob
+		switch err := os.Remove(m); {
+		case err == nil:
+			removed++
+		case !errors.Is(err, os.ErrNotExist):
+			return err
+		}
+	}
+
+	return a.render("locked", map[string]int{"removed": removed}, func(w io.Writer) error {
+		fmt.Fprintf(w, "locked: removed %d decrypted working file(s)\n", removed)
+		return nil
+	})
+}
+
+func runRotatePassword(a *app, args []string) error {
+	fs := a.newFlagSet("rotate-password")
+	newPasswordFile := fs.String("new-password-file", "", "Read the new master password from this file (must be 0600)")
+	memory := fs.Uint("argon-memory", 0, "Argon2id memory in KiB (default: keep current)")
+	iterations := fs.Uint("argon-iterations", 0, "Argon2id iterations (default: keep current)")
+	parallelism := fs.Uint("argon-parallelism", 0, "Argon2id parallelism (default: keep current)")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	// Zero keeps the current value; anything else must meet the floors
+	// the key derivation enforces
+	switch {
+	case *memory != 0 && (*memory < keys.DefaultArgonMemory || *memory > math.MaxUint32):
+		return fmt.Errorf("%w: --argon-memory must be between %d and %d KiB",
+			errUsage, keys.DefaultArgonMemory, uint32(math.MaxUint32))
+	case *iterations != 0 && (*iterations < keys.DefaultArgonIterations || *iterations > math.MaxUint32):
+		return fmt.Errorf("%w: --argon-iterations must be at least %d", errUsage, keys.DefaultArgonIterations)
+	case *parallelism != 0 && (*parallelism < keys.DefaultArgonParallelism || *parallelism > 255):
+		return fmt.Errorf("%w: --argon-parallelism must be between %d and 255", errUsage, keys.DefaultArgonParallelism)
+	}
+
+	// Unlocking verifies the current password
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	var newPassword []byte
+	if *newPasswordFile != "" {
+		newPassword, err = readPasswordFile(*newPasswordFile)
+	} else {
+		newPassword, err = a.promptNewPassword()
+	}
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(newPassword)
+
+	kdf := v.Header().KDF
+	params := crypto.Argon2Params{
+		Memory:      kdf.Memory,
+		Iterations:  kdf.Iterations,
+		Parallelism: kdf.Parallelism,
+		KeyLength:   keys.DefaultArgonKeyLength,
+	}
+	if *memory != 0 {
+		params.Memory = uint32(*memory)
+	}
+	if *iterations != 0 {
+		params.Iterations = uint32(*iterations)
+	}
+	if *parallelism != 0 {
+		params.Parallelism = uint8(*parallelism)
+	}
+
+	if err := v.RotatePassword(v.Path(), newPassword, params, a.rng); err != nil {
+		return err
+	}
+
+	return a.render("password_rotated", vaultDoc{
+		Path:         v.Path(),
+		VaultID:      v.ID(),
+		VaultVersion: v.VaultVersion(),
+		KeyEpoch:     v.KeyEpoch(),
+	}, func(w io.Writer) error {
+		fmt.Fprintf(w, "master password changed (vault version %d, key epoch %d)\n", v.VaultVersion(), v.KeyEpoch())
+		return nil
+	})
+}
+
+// promptNewPassword asks for a new master password on the terminal.
+// The scripted sources hold the current password, so they never apply.
+func (a *app) promptNewPassword() ([]byte, error) {
+	pw, err := promptTTY("New master password")
+	if err != nil {
+		return nil, err
+	}
+	again, err := promptTTY("Confirm new master password")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pw, again) {
+		return nil, fmt.Errorf("%w: passwords do not match", errUsage)
+	}
+	return pw, nil
+}
+
+type rekeyDoc struct {
+	vaultDoc
+	Entries int  `json:"entries"`
+	Rekeyed int  `json:"rekeyed"`
+	Resumed bool `json:"resumed"`
+}
+
+func runRekey(a *app, args []string) error {
+	fs := a.newFlagSet("rekey")
+	rotate := fs.Bool("rotate-entry-keys", false, "Also replace every entry key and re-encrypt all fields")
+	batch := fs.Int("batch", 100, "Entries between resumable checkpoints")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("%w: --batch must be positive", errUsage)
+	}
+
+	v, password, err := a.openVaultPassword()
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(password)
+	defer v.Close()
+
+	// Keep the journal out of Git when the vault lives in a work tree
+	if r, err := ysync.OpenRepo(a.cfg.RepoPath, v.Path()); err == nil {
+		if err := r.Exclude(vault.RekeyJournalPath(v.Path())); err != nil {
+			return err
+		}
+	} else if !errors.Is(err, yerrors.ErrConfig) {
+		return err
+	}
+
+	res, err := v.Rekey(v.Path(), password, vault.RekeyOptions{
+		RotateEntryKeys: *rotate,
+		BatchSize:       *batch,
+		Progress: func(done, total int) error {
+			if a.cfg.Format == formatTable && (done%*batch == 0 || done == total) {
+				fmt.Fprintf(a.stderr, "rekey: %d/%d entries\n", done, total)
+			}
+			return nil
+		},
+	}, a.rng)
+	if err != nil {
+		return fmt.Errorf("%w (rerun 'yap rekey' to resume)", err)
+	}
+
+	doc := rekeyDoc{
+		vaultDoc: vaultDoc{
+			Path:         v.Path(),
+			VaultID:      v.ID(),
+			VaultVersion: v.VaultVersion(),
+			KeyEpoch:     v.KeyEpoch(),
+		},
+		Entries: res.Total,
+		Rekeyed: res.Rekeyed,
+		Resumed: res.Resumed,
+	}
+	return a.render("rekeyed", doc, func(w io.Writer) error {
+		if res.Resumed {
+			fmt.Fprintln(w, "resumed an interrupted rekey")
+		}
+		fmt.Fprintf(w, "new vault key in place: %d entries, key epoch %d, vault version %d\n",
+			res.Total, v.KeyEpoch(), v.VaultVersion())
+		return nil
+	})
+}
+
+func formatTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+// One-time code command
+func init() {
+	register(&command{
+		name:    "otp",
+		usage:   "[--at UNIX] <id|title>",
+		summary: "Print the current TOTP code of an entry",
+		run:     runOTP,
+	})
+}
+
+type otpDoc struct {
+	ID        string `json:"id"`
+	Code      string `json:"code"`
+	Remaining int    `json:"remaining"` // seconds the code stays valid
+	Period    int    `json:"period"`
+	Digits    int    `json:"digits"`
+	Algorithm string `json:"algorithm"`
+}
+
+func runOTP(a *app, args []string) error {
+	fs := a.newFlagSet("otp")
+	at := fs.Int64("at", 0, "Compute the code at this Unix time instead of now")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: otp takes exactly one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if e.TOTP == "" {
+		return fmt.Errorf("%w: %s has no TOTP secret; set one with 'yap edit'", yerrors.ErrNotFound, e.Title)
+	}
+	otp, err := crypto.ParseTOTP(e.TOTP)
+	if err != nil {
+		return fmt.Errorf("%w: %w", yerrors.ErrCorruptData, err)
+	}
+
+	now := time.Now()
+	if *at != 0 {
+		now = time.Unix(*at, 0)
+	}
+	code, err := otp.Code(now)
+	if err != nil {
+		return err
+	}
+
+	doc := otpDoc{
+		ID:        e.ID,
+		Code:      code,
+		Remaining: otp.Remaining(now),
+		Period:    otp.Period,
+		Digits:    otp.Digits,
+		Algorithm: otp.Algorithm,
+	}
+	return a.render("otp", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "%s (%ds left)\n", doc.Code, doc.Remaining)
+		return nil
+	})
+}
@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+// base32 of the RFC 6238 SHA1 test secret "12345678901234567890"
+const rfcTOTPSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestOTPCommand(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+
+	// The secret never goes through argv
+	env.addEntry("GitHub", "hunter2", "--totp-file", writeTemp(t, strings.ToLower(rfcTOTPSecret)+"\n"))
+	if _, errOut, code := env.runInput("otpauth://totp/AWS:root?secret="+rfcTOTPSecret+"&algorithm=SHA256&digits=8&period=60\n",
+		"add", "--title", "AWS", "--generate", "--totp-stdin"); code != ExitOK {
+		t.Fatalf("add with --totp-stdin: exit %d: %s", code, errOut)
+	}
+	env.addEntry("Bank", "money")
+
+	if out := env.mustRun("otp", "--at", "59", "GitHub"); out != "287082 (1s left)\n" {
+		t.Fatalf("unexpected code: %q", out)
+	}
+
+	stdout, _, code := env.run("--format", "json", "otp", "--at", "59", "AWS")
+	if code != ExitOK {
+		t.Fatalf("otp failed with %d", code)
+	}
+	var doc otpDoc
+	decodeDocument(t, stdout, &doc)
+	if doc.Digits != 8 || doc.Algorithm != "SHA256" || doc.Remaining != 1 || len(doc.Code) != 8 {
+		t.Fatalf("unexpected otp document %+v", doc)
+	}
+
+	if _, _, code := env.run("otp", "Bank"); code != ExitNotFound {
+		t.Fatalf("entry without totp: expected exit %d, got %d", ExitNotFound, code)
+	}
+	if _, _, code := env.runInput("otpauth://totp/x?secret="+rfcTOTPSecret+"&digits=7\n",
+		"add", "--title", "x", "--generate", "--totp-stdin"); code != ExitUsage {
+		t.Fatalf("7 digits: expected exit %d, got %d", ExitUsage, code)
+	}
+	if _, _, code := env.run("add", "--title", "x", "--generate", "--totp", rfcTOTPSecret); code != ExitUsage {
+		t.Fatalf("--totp on argv: expected exit %d, got %d", ExitUsage, code)
+	}
+
+	out := env.mustRun("show", "GitHub")
+	if strings.Contains(out, rfcTOTPSecret) || !strings.Contains(out, "SHA1, 6 digits, 30s") {
+		t.Fatalf("totp secret not masked:\n%s", out)
+	}
+	if out := env.mustRun("show", "--reveal", "GitHub"); !strings.Contains(out, "otpauth://totp/?") {
+		t.Fatalf("totp not revealed:\n%s", out)
+	}
+}
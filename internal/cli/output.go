@@ -0,0 +1,196 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"yap/internal/db"
+)
+
+/*
+* Output formats
+*
+* table (default)  human readable text
+* json             one versioned document per invocation on stdout:
+*
+* 	{"version": 1, "kind": "entry_list", "data": [...]}
+* 	{"version": 1, "kind": "error", "error": {"code": "auth_failed", "exit_code": 3, "message": "..."}}
+*
+* Field names and error codes are stable within a version. Any breaking
+* change bumps outputVersion.
+* */
+
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+
+	outputVersion = 1
+)
+
+type document struct {
+	Version int       `json:"version"`
+	Kind    string    `json:"kind"`
+	Data    any       `json:"data,omitempty"`
+	Error   *errorDoc `json:"error,omitempty"`
+}
+
+type errorDoc struct {
+	Code     string `json:"code"`
+	ExitCode int    `json:"exit_code"`
+	Message  string `json:"message"`
+}
+
+type entryDoc struct {
+	ID        string     `json:"id"`
+	Title     string     `json:"title"`
+	Username  string     `json:"username"`
+	Password  string     `json:"password,omitempty"` // only with --reveal
+	URL       string     `json:"url"`
+	Notes     string     `json:"notes,omitempty"`
+	TOTP      string     `json:"totp,omitempty"` // otpauth URI, only with --reveal
+	HasTOTP   bool       `json:"has_totp"`
+	Type      string     `json:"type"`
+	Data      []dataDoc  `json:"data,omitempty"` // secret values only with --reveal
+	Folder    string     `json:"folder"`         // folder path, "/" at the root
+	Favorite  bool       `json:"favorite"`
+	Tags      []string   `json:"tags"`
+	Fields    []fieldDoc `json:"fields,omitempty"` // hidden values only with --reveal
+	CreatedAt int64      `json:"created_at"`
+	UpdatedAt int64      `json:"updated_at"`
+}
+
+type fieldDoc struct {
+	Name  string `json:"name"`
+	Kind  string `json:"kind"`
+	Value string `json:"value,omitempty"`
+}
+
+// dataDoc is one value of a typed entry.
+type dataDoc struct {
+	Name   string `json:"name"`
+	Label  string `json:"label"`
+	Secret bool   `json:"secret,omitempty"`
+	Value  string `json:"value,omitempty"`
+}
+
+type mutationDoc struct {
+	ID           string `json:"id"`
+	VaultVersion uint64 `json:"vault_version"`
+}
+
+type vaultDoc struct {
+	Path         string `json:"path"`
+	VaultID      string `json:"vault_id"`
+	VaultVersion uint64 `json:"vault_version"`
+	KeyEpoch     uint64 `json:"key_epoch"`
+}
+
+type deviceDoc struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type statusDoc struct {
+	Path               string     `json:"path"`
+	VaultID            string     `json:"vault_id"`
+	VaultVersion       uint64     `json:"vault_version"`
+	KeyEpoch           uint64     `json:"key_epoch"`
+	CreatedAt          int64      `json:"created_at"`
+	LastModified       int64      `json:"last_modified"`
+	CreatedBy          string     `json:"created_by"`
+	LastWriter         string     `json:"last_writer"`
+	LastWriterDeviceID string     `json:"last_writer_device_id"`
+	EntryCount         int        `json:"entry_count"`
+	SchemaVersion      uint32     `json:"schema_version"`
+	Padding            string     `json:"padding"`
+	PaddingSize        uint32     `json:"padding_size,omitempty"`
+	Device             *deviceDoc `json:"device,omitempty"`
+}
+
+func toEntryDoc(e db.Entry, folder string, reveal bool, withNotes bool) entryDoc {
+	d := entryDoc{
+		ID:        e.ID,
+		Title:     e.Title,
+		Username:  e.Username,
+		URL:       e.URL,
+		Type:      string(entryType(&e)),
+		HasTOTP:   e.TOTP != "",
+		Folder:    folder,
+		Favorite:  e.Favorite,
+		Tags:      e.Tags,
+		CreatedAt: e.CreatedAt,
+		UpdatedAt: e.UpdatedAt,
+	}
+	if reveal {
+		d.Password = e.Password
+		d.TOTP = e.TOTP
+	}
+	if d.Tags == nil {
+		d.Tags = []string{}
+	}
+	if withNotes {
+		d.Notes = e.Notes
+		for _, f := range db.TypeFields(entryType(&e)) {
+			value, ok := e.Data[f.Name]
+			if !ok {
+				continue
+			}
+			dd := dataDoc{Name: f.Name, Label: f.Label, Secret: f.Secret, Value: value}
+			if f.Secret && !reveal {
+				dd.Value = ""
+			}
+			d.Data = append(d.Data, dd)
+		}
+		for _, f := range e.Fields {
+			fd := fieldDoc{Name: f.Name, Kind: string(f.Kind), Value: f.Value}
+			if f.Kind == db.FieldHidden && !reveal {
+				fd.Value = ""
+			}
+			d.Fields = append(d.Fields, fd)
+		}
+	}
+	return d
+}
+
+func validFormat(f string) bool {
+	return f == formatTable || f == formatJSON
+}
+
+// render writes data as a JSON document of the given kind, or calls
+// table to print the human readable form.
+func (a *app) render(kind string, data any, table func(w io.Writer) error) error {
+	if a.cfg.Format == formatJSON {
+		return writeDocument(a.stdout, document{
+			Version: outputVersion,
+			Kind:    kind,
+			Data:    data,
+		})
+	}
+	return table(a.stdout)
+}
+
+// renderError reports err as text or a JSON document and returns its exit code.
+func renderError(w io.Writer, asJSON bool, name string, err error) int {
+	code, exit := classify(err)
+	if asJSON {
+		writeDocument(w, document{
+			Version: outputVersion,
+			Kind:    "error",
+			Error: &errorDoc{
+				Code:     code,
+				ExitCode: exit,
+				Message:  err.Error(),
+			},
+		})
+		return exit
+	}
+
+	fmt.Fprintf(w, "yap %s: %v\n", name, err)
+	return exit
+}
+
+func writeDocument(w io.Writer, doc document) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+)
+
+func decodeDocument(t *testing.T, out string, data any) document {
+	t.Helper()
+
+	doc := document{Data: data}
+	if err := json.Unmarshal([]byte(out), &doc); err != nil {
+		t.Fatalf("invalid json output: %v\n%s", err, out)
+	}
+	if doc.Version != outputVersion {
+		t.Fatalf("unexpected document version %d", doc.Version)
+	}
+	return doc
+}
+
+func TestJSONFormat_ListAndShow(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+	env.addEntry("GitHub", "hunter2", "--username", "octocat")
+
+	var list []entryDoc
+	doc := decodeDocument(t, env.mustRun("--format", "json", "list"), &list)
+	if doc.Kind != "entry_list" || len(list) != 1 || list[0].Title != "GitHub" {
+		t.Fatalf("unexpected list document: %+v %+v", doc, list)
+	}
+	if list[0].Password != "" {
+		t.Fatal("list must never include passwords")
+	}
+
+	var entry entryDoc
+	decodeDocument(t, env.mustRun("--format", "json", "show", "GitHub"), &entry)
+	if entry.Password != "" {
+		t.Fatal("show without --reveal must omit the password")
+	}
+	decodeDocument(t, env.mustRun("--format", "json", "show", "--reveal", "GitHub"), &entry)
+	if entry.Password != "hunter2" {
+		t.Fatalf("unexpected revealed password %q", entry.Password)
+	}
+}
+
+func TestJSONFormat_Status(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+
+	var status statusDoc
+	doc := decodeDocument(t, env.mustRun("--format", "json", "status"), &status)
+	if doc.Kind != "status" || status.VaultVersion != 1 || status.LastWriter == "" {
+		t.Fatalf("unexpected status document: %+v", status)
+	}
+}
+
+func TestJSONFormat_ErrorCodes(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+
+	if err := os.WriteFile(env.password, []byte("wrong\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	out, _, code := env.run("--format", "json", "list")
+	doc := decodeDocument(t, out, nil)
+	if doc.Kind != "error" || doc.Error == nil {
+		t.Fatalf("expected error document, got %+v", doc)
+	}
+	if doc.Error.Code != "auth_failed" || doc.Error.ExitCode != code || code != ExitAuthFailed {
+		t.Fatalf("unexpected error mapping: %+v (exit %d)", doc.Error, code)
+	}
+}
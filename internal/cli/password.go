@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	yerrors "yap/internal/errors"
+
+	"golang.org/x/term"
+)
+
+const maxPasswordLen = 4096
+
+/*
+* Password sources, in order of precedence
+* 1) --password-fd N   first line read from an inherited descriptor
+* 2) --password-file   first line of a 0600 file
+* 3) controlling TTY   no-echo prompt on /dev/tty
+*
+* Passwords are never read from argv or the environment.
+* */
+
+// readPassword obtains a password using the configured source.
+// When confirm is set and the source is interactive, the password is
+// asked twice and must match.
+func (a *app) readPassword(prompt string, confirm bool) ([]byte, error) {
+	switch {
+	case a.cfg.PasswordFD >= 0:
+		f := os.NewFile(uintptr(a.cfg.PasswordFD), "password-fd")
+		if f == nil {
+			return nil, fmt.Errorf("%w: invalid --password-fd %d", yerrors.ErrConfig, a.cfg.PasswordFD)
+		}
+		return readPasswordLine(f)
+
+	case a.cfg.PasswordFile != "":
+		return readPasswordFile(a.cfg.PasswordFile)
+	}
+
+	pw, err := promptTTY(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if !confirm {
+		return pw, nil
+	}
+
+	again, err := promptTTY("Confirm " + prompt)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(pw, again) {
+		return nil, fmt.Errorf("%w: passwords do not match", errUsage)
+	}
+	return pw, nil
+}
+
+func readPasswordFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: password file: %w", yerrors.ErrConfig, err)
+	}
+	// Same rule as the config file
+	if info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf(
+			"%w: password file %s must not be group/world readable",
+			yerrors.ErrConfig, path,
+		)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: password file: %w", yerrors.ErrConfig, err)
+	}
+	defer f.Close()
+
+	return readPasswordLine(f)
+}
+
+// readPasswordLine reads up to the first newline, stripping CR/LF.
+func readPasswordLine(r io.Reader) ([]byte, error) {
+	line, err := bufio.NewReaderSize(io.LimitReader(r, maxPasswordLen+2), maxPasswordLen+2).ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return nil, fmt.Errorf("password read failed: %w", err)
+	}
+	line = bytes.TrimRight(line, "\r\n")
+	if len(line) == 0 {
+		return nil, fmt.Errorf("%w: empty password", errUsage)
+	}
+	if len(line) > maxPasswordLen {
+		return nil, fmt.Errorf("%w: password too long", errUsage)
+	}
+	return line, nil
+}
+
+func promptTTY(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, fmt.Errorf(
+			"%w: no terminal for password prompt; use --password-fd or --password-file",
+			yerrors.ErrConfig,
+		)
+	}
+	defer tty.Close()
+
+	fmt.Fprintf(tty, "%s: ", prompt)
+	pw, err := term.ReadPassword(int(tty.Fd()))
+	fmt.Fprintln(tty)
+	if err != nil {
+		return nil, fmt.Errorf("password prompt failed: %w", err)
+	}
+	if len(pw) == 0 {
+		return nil, fmt.Errorf("%w: empty password", errUsage)
+	}
+	return pw, nil
+}
@@ -0,0 +1,184 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	yerrors "yap/internal/errors"
+)
+
+/*
+* Password history
+*
+* Old passwords are numbered from 1, the most recent. Restoring one makes
+* it the current password; the password it replaces goes to the history
+* like any other change, so a restore can itself be undone.
+* */
+
+type passwordVersionDoc struct {
+	N         int    `json:"n"`
+	ChangedAt int64  `json:"changed_at"`
+	Password  string `json:"password,omitempty"` // only with --reveal
+}
+
+type historyDoc struct {
+	ID       string               `json:"id"`
+	Limit    int                  `json:"limit"`
+	Versions []passwordVersionDoc `json:"versions"`
+}
+
+type historyLimitDoc struct {
+	Limit        int    `json:"limit"`
+	VaultVersion uint64 `json:"vault_version,omitempty"`
+}
+
+func runHistoryList(a *app, args []string) error {
+	fs := a.newFlagSet("history")
+	reveal := fs.Bool("reveal", false, "Print old passwords in clear text")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: history takes exactly one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	versions, err := v.PasswordHistory(e.ID)
+	if err != nil {
+		return err
+	}
+	limit, err := v.HistoryLimit()
+	if err != nil {
+		return err
+	}
+
+	doc := historyDoc{ID: e.ID, Limit: limit, Versions: make([]passwordVersionDoc, len(versions))}
+	for i, pv := range versions {
+		doc.Versions[i] = passwordVersionDoc{N: i + 1, ChangedAt: pv.ChangedAt}
+		if *reveal {
+			doc.Versions[i].Password = pv.Password
+		}
+	}
+
+	return a.render("password_history", doc, func(w io.Writer) error {
+		if len(doc.Versions) == 0 {
+			fmt.Fprintf(w, "no old passwords for %s (keeping %d)\n", e.Title, limit)
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "N\tREPLACED\tPASSWORD")
+		for _, d := range doc.Versions {
+			password := maskedPassword
+			if *reveal {
+				password = d.Password
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\n", d.N, formatTime(d.ChangedAt), password)
+		}
+		return tw.Flush()
+	})
+}
+
+func runHistoryRestore(a *app, args []string) error {
+	fs := a.newFlagSet("history")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return fmt.Errorf("%w: history restore takes an entry and a version number", errUsage)
+	}
+	n, err := strconv.Atoi(fs.Arg(1))
+	if err != nil || n < 1 {
+		return fmt.Errorf("%w: version number must be 1 or more, as listed by 'yap history'", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findEntry(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	versions, err := v.PasswordHistory(e.ID)
+	if err != nil {
+		return err
+	}
+	if n > len(versions) {
+		return fmt.Errorf("%w: %s has %d old passwords", yerrors.ErrNotFound, e.Title, len(versions))
+	}
+
+	if versions[n-1].Password == e.Password {
+		return a.render("entry_unchanged", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+			fmt.Fprintln(w, "no changes")
+			return nil
+		})
+	}
+	e.Password = versions[n-1].Password
+	if err := v.UpdateEntry(*e, a.rng); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("entry_updated", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "restored password %d of %s (vault version %d)\n", n, e.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+func runHistoryLimit(a *app, args []string) error {
+	fs := a.newFlagSet("history")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%w: history limit takes at most one number", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if fs.NArg() == 0 {
+		limit, err := v.HistoryLimit()
+		if err != nil {
+			return err
+		}
+		return a.render("history_limit", historyLimitDoc{Limit: limit}, func(w io.Writer) error {
+			fmt.Fprintf(w, "keeping %d old passwords per entry\n", limit)
+			return nil
+		})
+	}
+
+	limit, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || limit < 0 {
+		return fmt.Errorf("%w: history limit must be 0 or more", errUsage)
+	}
+	if err := v.SetHistoryLimit(limit); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	doc := historyLimitDoc{Limit: limit, VaultVersion: v.VaultVersion()}
+	return a.render("history_limit", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "keeping %d old passwords per entry (vault version %d)\n", limit, v.VaultVersion())
+		return nil
+	})
+}
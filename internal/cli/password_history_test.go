@@ -0,0 +1,56 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHistory(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+	env.addEntry("GitHub", "first")
+
+	// The editor sets the password to $NEW_PASSWORD
+	script := filepath.Join(t.TempDir(), "editor.sh")
+	body := "#!/bin/sh\nsed -i \"s/^password:.*/password: $NEW_PASSWORD/\" \"$1\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", script)
+	for _, pw := range []string{"second", "third"} {
+		t.Setenv("NEW_PASSWORD", pw)
+		env.mustRun("edit", "GitHub")
+	}
+
+	out := env.mustRun("history", "GitHub")
+	if strings.Contains(out, "second") || !strings.Contains(out, "1  ") || !strings.Contains(out, "2  ") {
+		t.Fatalf("unexpected masked history:\n%s", out)
+	}
+	out = env.mustRun("history", "list", "--reveal", "GitHub")
+	if strings.Index(out, "second") > strings.Index(out, "first") || strings.Contains(out, "third") {
+		t.Fatalf("history not newest first:\n%s", out)
+	}
+
+	env.mustRun("history", "restore", "GitHub", "2")
+	if out := env.mustRun("show", "--reveal", "GitHub"); !strings.Contains(out, "password:  first") {
+		t.Fatalf("password not restored:\n%s", out)
+	}
+	// The restore is itself in the history
+	if out := env.mustRun("history", "--reveal", "GitHub"); !strings.Contains(out, "third") {
+		t.Fatalf("replaced password not kept:\n%s", out)
+	}
+	if _, _, code := env.run("history", "restore", "GitHub", "9"); code != ExitNotFound {
+		t.Fatalf("missing version: expected exit %d, got %d", ExitNotFound, code)
+	}
+
+	env.mustRun("history", "limit", "1")
+	if out := env.mustRun("history", "limit"); !strings.Contains(out, "keeping 1 old") {
+		t.Fatalf("limit not stored:\n%s", out)
+	}
+	out = env.mustRun("history", "--reveal", "GitHub")
+	if !strings.Contains(out, "third") || strings.Contains(out, "second") {
+		t.Fatalf("history not trimmed to the limit:\n%s", out)
+	}
+}
@@ -0,0 +1,322 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+	ysync "yap/internal/sync"
+	"yap/internal/vault"
+)
+
+// Git sync commands
+func init() {
+	register(&command{
+		name:    "pull",
+		usage:   "[--remote NAME] [--branch NAME]",
+		summary: "Fetch, verify and fast-forward to the remote vault",
+		run:     runPull,
+	})
+	register(&command{
+		name:    "push",
+		usage:   "[--remote NAME] [--branch NAME]",
+		summary: "Commit the vault file and push it",
+		run:     runPush,
+	})
+	register(&command{
+		name:    "remote-status",
+		usage:   "[--remote NAME] [--branch NAME]",
+		summary: "Compare the remote vault version without unlocking",
+		run:     runRemoteStatus,
+	})
+	register(&command{
+		name:    "sync",
+		usage:   "[--remote NAME] [--branch NAME]",
+		summary: "Commit, pull and push the vault file",
+		run:     runSync,
+	})
+}
+
+type syncDoc struct {
+	Remote       string `json:"remote"`
+	Branch       string `json:"branch"`
+	Head         string `json:"head"`
+	Committed    bool   `json:"committed"`
+	Pulled       bool   `json:"pulled"`
+	Pushed       bool   `json:"pushed"`
+	VaultVersion uint64 `json:"vault_version,omitempty"`
+}
+
+type remoteStatusDoc struct {
+	Remote             string `json:"remote"`
+	Branch             string `json:"branch"`
+	Relation           string `json:"relation"`
+	LocalVaultID       string `json:"local_vault_id,omitempty"`
+	LocalVaultVersion  uint64 `json:"local_vault_version,omitempty"`
+	LocalKeyEpoch      uint64 `json:"local_key_epoch,omitempty"`
+	RemoteVaultID      string `json:"remote_vault_id,omitempty"`
+	RemoteVaultVersion uint64 `json:"remote_vault_version,omitempty"`
+	RemoteKeyEpoch     uint64 `json:"remote_key_epoch,omitempty"`
+	TrustedVersion     uint64 `json:"trusted_vault_version,omitempty"`
+	TrustedKeyEpoch    uint64 `json:"trusted_key_epoch,omitempty"`
+}
+
+// syncFlags registers the remote and branch overrides shared by all
+// sync commands.
+func syncFlags(fs *flag.FlagSet) (remote, branch *string) {
+	remote = fs.String("remote", ysync.DefaultRemote, "Git remote name")
+	branch = fs.String("branch", "", "Branch to sync (default: current branch)")
+	return remote, branch
+}
+
+// openRepo parses the sync flags and opens the repository holding the vault.
+func (a *app) openRepo(name string, args []string) (*ysync.Repo, error) {
+	fs := a.newFlagSet(name)
+	remote, branch := syncFlags(fs)
+	if err := parseFlags(fs, args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() != 0 {
+		return nil, fmt.Errorf("%w: %s takes no arguments", errUsage, name)
+	}
+
+	r, err := ysync.OpenRepo(a.cfg.RepoPath, a.cfg.VaultPath)
+	if err != nil {
+		return nil, err
+	}
+	r.Remote = *remote
+	if *branch != "" {
+		r.Branch = *branch
+	}
+	return r, nil
+}
+
+func runPull(a *app, args []string) error {
+	r, err := a.openRepo("pull", args)
+	if err != nil {
+		return err
+	}
+
+	doc := syncDoc{Remote: r.Remote, Branch: r.Branch}
+	if doc.Committed, err = r.CommitVault(); err != nil {
+		return err
+	}
+	if doc.Pulled, doc.VaultVersion, err = a.pull(r); err != nil {
+		return err
+	}
+	return a.renderSync("pulled", r, doc)
+}
+
+func runPush(a *app, args []string) error {
+	r, err := a.openRepo("push", args)
+	if err != nil {
+		return err
+	}
+
+	doc := syncDoc{Remote: r.Remote, Branch: r.Branch}
+	if doc.Committed, err = r.CommitVault(); err != nil {
+		return err
+	}
+	if doc.Pushed, err = push(r); err != nil {
+		return err
+	}
+	return a.renderSync("pushed", r, doc)
+}
+
+func runRemoteStatus(a *app, args []string) error {
+	r, err := a.openRepo("remote-status", args)
+	if err != nil {
+		return err
+	}
+	if _, err := r.Fetch(); err != nil {
+		return err
+	}
+	rs, err := r.DetectRemote(a.cfg.VaultPath, a.store)
+	if err != nil {
+		return err
+	}
+
+	doc := remoteStatusDoc{Remote: r.Remote, Branch: r.Branch, Relation: string(rs.Relation)}
+	if rs.Local != nil {
+		doc.LocalVaultID = rs.Local.VaultID
+		doc.LocalVaultVersion = rs.Local.VaultVersion
+		doc.LocalKeyEpoch = rs.Local.KeyEpoch
+	}
+	if rs.Remote != nil {
+		doc.RemoteVaultID = rs.Remote.VaultID
+		doc.RemoteVaultVersion = rs.Remote.VaultVersion
+		doc.RemoteKeyEpoch = rs.Remote.KeyEpoch
+	}
+	if rs.Trusted != nil {
+		doc.TrustedVersion = rs.Trusted.LastSeenVaultVersion
+		doc.TrustedKeyEpoch = rs.Trusted.LastSeenKeyEpoch
+	}
+
+	return a.render("remote_status", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "remote:    %s/%s is %s\n", doc.Remote, doc.Branch, doc.Relation)
+		if rs.Local != nil {
+			fmt.Fprintf(w, "local:     version %d, key epoch %d\n", doc.LocalVaultVersion, doc.LocalKeyEpoch)
+		}
+		if rs.Remote != nil {
+			fmt.Fprintf(w, "remote:    version %d, key epoch %d\n", doc.RemoteVaultVersion, doc.RemoteKeyEpoch)
+		}
+		if rs.Trusted != nil {
+			fmt.Fprintf(w, "trusted:   version %d, key epoch %d\n", doc.TrustedVersion, doc.TrustedKeyEpoch)
+		}
+		if rs.Relation == ysync.RelationRollback {
+			fmt.Fprintln(w, "warning:   the remote vault is older than one this machine already opened; it may have been rolled back")
+		}
+		return nil
+	})
+}
+
+func runSync(a *app, args []string) error {
+	r, err := a.openRepo("sync", args)
+	if err != nil {
+		return err
+	}
+
+	doc := syncDoc{Remote: r.Remote, Branch: r.Branch}
+	if doc.Committed, err = r.CommitVault(); err != nil {
+		return err
+	}
+	if doc.Pulled, doc.VaultVersion, err = a.pull(r); err != nil {
+		return err
+	}
+	if doc.Pushed, err = push(r); err != nil {
+		return err
+	}
+	return a.renderSync("synced", r, doc)
+}
+
+/*
+* pull: fetch -> decrypt -> verify -> apply
+*
+* The remote vault is fully opened against trusted local state before the
+* branch moves, so a rolled back or foreign vault never replaces ours.
+* */
+func (a *app) pull(r *ysync.Repo) (bool, uint64, error) {
+	if _, err := ysync.LoadConflict(a.cfg.VaultPath); err == nil {
+		return false, 0, fmt.Errorf("%w: a conflict is pending; run 'yap conflict resolve' first", yerrors.ErrDiverged)
+	}
+
+	// 1) fetch
+	exists, err := r.Fetch()
+	if err != nil || !exists {
+		return false, 0, err
+	}
+
+	st, err := r.Status()
+	if err != nil {
+		return false, 0, err
+	}
+	if st.Behind == 0 {
+		return false, 0, nil
+	}
+
+	// 2) cheap header check before asking for the password
+	rs, err := r.DetectRemote(a.cfg.VaultPath, a.store)
+	if err != nil {
+		return false, 0, err
+	}
+	switch rs.Relation {
+	case ysync.RelationForeign:
+		return false, 0, fmt.Errorf("%w: %s/%s holds a different vault", yerrors.ErrInvalidVault, r.Remote, r.Branch)
+	case ysync.RelationRollback:
+		return false, 0, fmt.Errorf("%w: %s/%s holds an older vault than this machine already opened",
+			yerrors.ErrRollbackDetected, r.Remote, r.Branch)
+	case ysync.RelationDiverged:
+		if err := a.saveConflict(r); err != nil {
+			return false, 0, err
+		}
+		return false, 0, fmt.Errorf("%w: local and %s/%s both have new vault versions; "+
+			"both were saved, see 'yap conflict show'", yerrors.ErrDiverged, r.Remote, r.Branch)
+	case ysync.RelationEqual:
+		// Same vault committed on both sides; adopt the remote history
+		if st.Diverged() {
+			return false, 0, r.ResetToRemote()
+		}
+	case ysync.RelationMissing:
+		return false, 0, fmt.Errorf("%w: %s/%s has no vault file", yerrors.ErrNotFound, r.Remote, r.Branch)
+	}
+
+	// 3) decrypt and verify against the local vault identity
+	data, err := r.RemoteVault()
+	if err != nil {
+		return false, 0, err
+	}
+
+	ctx := vault.OpenContext{State: a.store}
+	if rs.Local != nil {
+		ctx.ExpectedVaultID = rs.Local.VaultID
+	}
+
+	password, err := a.readPassword("Master password", false)
+	if err != nil {
+		return false, 0, err
+	}
+	defer crypto.Wipe(password)
+	header, err := vault.Verify(data, password, ctx)
+	if err != nil {
+		return false, 0, err
+	}
+
+	// 4) apply, then trust the new version
+	if err := r.FastForward(); err != nil {
+		return false, 0, err
+	}
+	if err := a.store.Save(header.VaultID, header.VaultVersion, header.KeyEpoch); err != nil {
+		return false, 0, fmt.Errorf("local state update failed: %w", err)
+	}
+	return true, header.VaultVersion, nil
+}
+
+// push publishes local commits, if any.
+func push(r *ysync.Repo) (bool, error) {
+	if _, err := r.Fetch(); err != nil {
+		return false, err
+	}
+
+	st, err := r.Status()
+	if err != nil {
+		return false, err
+	}
+	if st.Behind > 0 {
+		return false, fmt.Errorf("%w: %s/%s has vault versions not pulled yet",
+			yerrors.ErrDiverged, r.Remote, r.Branch)
+	}
+	if st.Ahead == 0 {
+		return false, nil
+	}
+
+	if err := r.Push(); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (a *app) renderSync(kind string, r *ysync.Repo, doc syncDoc) error {
+	st, err := r.Status()
+	if err != nil {
+		return err
+	}
+	doc.Head = st.Head
+
+	return a.render(kind, doc, func(w io.Writer) error {
+		switch {
+		case !doc.Committed && !doc.Pulled && !doc.Pushed:
+			fmt.Fprintf(w, "up to date with %s/%s\n", doc.Remote, doc.Branch)
+			return nil
+		case doc.Committed:
+			fmt.Fprintln(w, "committed vault")
+		}
+		if doc.Pulled {
+			fmt.Fprintf(w, "pulled vault version %d from %s/%s\n", doc.VaultVersion, doc.Remote, doc.Branch)
+		}
+		if doc.Pushed {
+			fmt.Fprintf(w, "pushed to %s/%s\n", doc.Remote, doc.Branch)
+		}
+		return nil
+	})
+}
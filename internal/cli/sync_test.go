@@ -0,0 +1,496 @@
+package cli
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// newSyncPair returns two devices sharing a password and a bare remote,
+// each with its own clone and local state.
+func newSyncPair(t *testing.T) (*testEnv, *testEnv) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+
+	git := func(dir string, args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	remote := filepath.Join(t.TempDir(), "remote.git")
+	git(t.TempDir(), "init", "--quiet", "--bare", "-b", "main", remote)
+
+	clone := func() string {
+		dir := t.TempDir()
+		git(dir, "init", "--quiet", "-b", "main")
+		git(dir, "remote", "add", "origin", remote)
+		return filepath.Join(dir, "vault.yap")
+	}
+
+	a := newTestEnv(t)
+	a.vault = clone()
+	b := *a
+	b.vault = clone()
+	b.state = filepath.Join(t.TempDir(), "state")
+	return a, &b
+}
+
+func TestSync_PushThenPull(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.addEntry("GitHub", "hunter2")
+	if out := a.mustRun("sync"); !strings.Contains(out, "pushed to origin/main") {
+		t.Fatalf("unexpected sync output:\n%s", out)
+	}
+
+	if out := b.mustRun("pull"); !strings.Contains(out, "pulled vault version 2") {
+		t.Fatalf("unexpected pull output:\n%s", out)
+	}
+	if out := b.mustRun("list"); !strings.Contains(out, "GitHub") {
+		t.Fatalf("pulled vault missing entry:\n%s", out)
+	}
+
+	// Nothing left to do on either side
+	if out := a.mustRun("sync"); !strings.Contains(out, "up to date") {
+		t.Fatalf("expected up to date, got:\n%s", out)
+	}
+}
+
+func TestSync_DivergenceExitCode(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.addEntry("From A", "a")
+	a.mustRun("push")
+	b.addEntry("From B", "b")
+
+	if _, _, code := b.run("sync"); code != ExitDiverged {
+		t.Fatalf("expected exit %d, got %d", ExitDiverged, code)
+	}
+	if _, _, code := b.run("push"); code != ExitDiverged {
+		t.Fatalf("expected exit %d, got %d", ExitDiverged, code)
+	}
+}
+
+func TestRemoteStatus_NoPassword(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+	a.addEntry("GitHub", "hunter2")
+	a.mustRun("push")
+
+	// A missing password file proves the remote is never decrypted
+	b.password = filepath.Join(t.TempDir(), "absent")
+
+	var doc remoteStatusDoc
+	out := b.mustRun("--format", "json", "remote-status")
+	decodeDocument(t, out, &doc)
+	if doc.Relation != "ahead" || doc.RemoteVaultVersion != 2 || doc.LocalVaultVersion != 1 {
+		t.Fatalf("unexpected remote status %+v", doc)
+	}
+}
+
+func TestRemoteStatus_WarnsOnRollback(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	a.addEntry("GitHub", "hunter2")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	// The remote is reset to version 1 and b loses its vault file, so
+	// only trusted state remembers version 2
+	dir := filepath.Dir(a.vault)
+	for _, args := range [][]string{{"reset", "--quiet", "--hard", "HEAD~1"}, {"push", "--quiet", "--force", "origin", "main"}} {
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	if err := os.Remove(b.vault); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.mustRun("remote-status")
+	if !strings.Contains(out, "is rollback") || !strings.Contains(out, "may have been rolled back") {
+		t.Fatalf("expected a rollback warning:\n%s", out)
+	}
+}
+
+func TestConflict_ShowAndResolvePick(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.addEntry("From A", "a")
+	a.mustRun("push")
+	b.addEntry("From B", "b")
+
+	if _, _, code := b.run("sync"); code != ExitDiverged {
+		t.Fatalf("expected exit %d, got %d", ExitDiverged, code)
+	}
+	// Further syncs are refused until the conflict is resolved
+	if _, _, code := b.run("pull"); code != ExitDiverged {
+		t.Fatalf("expected exit %d, got %d", ExitDiverged, code)
+	}
+
+	var doc conflictDoc
+	decodeDocument(t, b.mustRun("--format", "json", "conflict", "show"), &doc)
+	if len(doc.Changes) != 2 ||
+		doc.Changes[0].Title != "From A" || doc.Changes[0].Change != "remote_only" ||
+		doc.Changes[1].Title != "From B" || doc.Changes[1].Change != "local_only" {
+		t.Fatalf("unexpected conflict %+v", doc)
+	}
+
+	// Keep both entries
+	out, errOut, code := b.runInput("r\nl\n", "conflict", "resolve", "--keep", "pick")
+	if code != ExitOK {
+		t.Fatalf("resolve: exit %d: %s", code, errOut)
+	}
+	if !strings.Contains(out, "vault version 3") {
+		t.Fatalf("resolution must supersede both parents:\n%s", out)
+	}
+
+	b.mustRun("push")
+	a.mustRun("pull")
+	out = a.mustRun("list")
+	if !strings.Contains(out, "From A") || !strings.Contains(out, "From B") {
+		t.Fatalf("resolved vault missing entries:\n%s", out)
+	}
+}
+
+// After a local rekey only the local copy can be kept.
+func TestConflict_ResolveAcrossRekey(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.addEntry("From A", "a")
+	a.mustRun("push")
+	b.mustRun("rekey")
+	b.run("sync")
+
+	// Conflict copies and the rekey journal never show up in Git
+	dir := filepath.Dir(b.vault)
+	if out, err := exec.Command("git", "-C", dir, "status", "--porcelain", "--untracked-files=all").CombinedOutput(); err != nil || len(out) != 0 {
+		t.Fatalf("unexpected git status: %v: %s", err, out)
+	}
+	if out, err := exec.Command("git", "-C", dir, "check-ignore", "vault.yap.rekey").CombinedOutput(); err != nil {
+		t.Fatalf("rekey journal not excluded: %v: %s", err, out)
+	}
+
+	_, errOut, code := b.run("conflict", "resolve", "--keep", "remote")
+	if code != ExitInvalid || !strings.Contains(errOut, "--keep local") {
+		t.Fatalf("expected keeping the old key refused with advice, exit %d: %s", code, errOut)
+	}
+	if _, errOut, code := b.run("conflict", "merge"); code != ExitOK {
+		t.Fatalf("merge: exit %d: %s", code, errOut)
+	}
+	b.mustRun("push")
+
+	a.mustRun("pull")
+	if out := a.mustRun("list"); !strings.Contains(out, "From A") {
+		t.Fatalf("merged vault missing entry:\n%s", out)
+	}
+}
+
+// Picking the remote side of a local-only entry removes it for good,
+// leaving no tombstone to push.
+func TestConflict_PickRemovesLocalOnly(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.addEntry("From A", "a")
+	a.mustRun("push")
+	b.addEntry("From B", "b")
+	b.run("sync")
+
+	if _, errOut, code := b.runInput("r\nr\n", "conflict", "resolve", "--keep", "pick"); code != ExitOK {
+		t.Fatalf("resolve: exit %d: %s", code, errOut)
+	}
+	if out := b.mustRun("list"); !strings.Contains(out, "From A") || strings.Contains(out, "From B") {
+		t.Fatalf("unexpected picked entries:\n%s", out)
+	}
+	if out := b.mustRun("trash"); !strings.Contains(out, "trash is empty") {
+		t.Fatalf("local-only entry left in the trash:\n%s", out)
+	}
+}
+
+func TestConflict_ResolveKeepRemote(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.addEntry("From A", "a")
+	a.mustRun("push")
+	b.addEntry("From B", "b")
+	b.run("sync")
+
+	b.mustRun("conflict", "resolve", "--keep", "remote")
+	if _, _, code := b.run("conflict", "show"); code != ExitNotFound {
+		t.Fatalf("conflict should be cleared, got exit %d", code)
+	}
+
+	out := b.mustRun("list")
+	if !strings.Contains(out, "From A") || strings.Contains(out, "From B") {
+		t.Fatalf("expected remote entries only:\n%s", out)
+	}
+	b.mustRun("push")
+}
+
+func TestConflict_PickRemoteKeepsHistory(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.addEntry("Shared", "s0")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	// The editor sets the password to $NEW_PASSWORD
+	script := filepath.Join(t.TempDir(), "editor.sh")
+	body := "#!/bin/sh\nsed -i \"s/^password:.*/password: $NEW_PASSWORD/\" \"$1\"\n"
+	if err := os.WriteFile(script, []byte(body), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", script)
+	for _, pw := range []string{"a1", "a2"} {
+		t.Setenv("NEW_PASSWORD", pw)
+		a.mustRun("edit", "Shared")
+	}
+	a.mustRun("push")
+	t.Setenv("NEW_PASSWORD", "b1")
+	b.mustRun("edit", "Shared")
+	b.run("sync")
+
+	if _, errOut, code := b.runInput("r\n", "conflict", "resolve", "--keep", "pick"); code != ExitOK {
+		t.Fatalf("resolve: exit %d: %s", code, errOut)
+	}
+	out := b.mustRun("history", "--reveal", "Shared")
+	for _, pw := range []string{"s0", "a1", "b1"} {
+		if !strings.Contains(out, "  "+pw+"\n") {
+			t.Fatalf("old password %s missing from the picked entry:\n%s", pw, out)
+		}
+	}
+	b.mustRun("push")
+}
+
+func TestConflict_Merge(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.addEntry("Shared", "s")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.addEntry("From A", "a")
+	script := filepath.Join(t.TempDir(), "editor.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\nsed -i 's/^password:.*/password: a2/' \"$1\"\n"), 0o700); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("EDITOR", script)
+	a.mustRun("edit", "From A")
+	a.mustRun("push")
+	b.addEntry("From B", "b")
+	b.mustRun("rm", "Shared")
+	b.run("sync")
+
+	// No field conflicts: both additions and the deletion merge cleanly
+	out, errOut, code := b.run("conflict", "merge")
+	if code != ExitOK {
+		t.Fatalf("merge: exit %d: %s", code, errOut)
+	}
+	if !strings.Contains(out, "vault version 5") {
+		t.Fatalf("merge must supersede both parents:\n%s", out)
+	}
+
+	out = b.mustRun("list")
+	if !strings.Contains(out, "From A") || !strings.Contains(out, "From B") || strings.Contains(out, "Shared") {
+		t.Fatalf("unexpected merged entries:\n%s", out)
+	}
+	// Entries from the remote keep their password history
+	if out := b.mustRun("history", "--reveal", "From A"); !strings.Contains(out, "  a\n") {
+		t.Fatalf("remote password history lost:\n%s", out)
+	}
+	b.mustRun("push")
+}
+
+// Folders created on both sides under the same name merge into one.
+func TestConflict_MergeFolders(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.mustRun("folder", "add", "Work")
+	a.addEntry("From A", "a", "--folder", "Work")
+	a.mustRun("push")
+	b.mustRun("folder", "add", "--parents", "work/Email")
+	b.addEntry("From B", "b", "--folder", "work/Email")
+	b.run("sync")
+
+	if _, errOut, code := b.run("conflict", "merge"); code != ExitOK {
+		t.Fatalf("merge: exit %d: %s", code, errOut)
+	}
+
+	var folders []folderDoc
+	decodeDocument(t, b.mustRun("--format", "json", "folder", "list"), &folders)
+	if len(folders) != 2 || folders[1].Path != "work/Email" {
+		t.Fatalf("unexpected merged folders %+v", folders)
+	}
+	out := b.mustRun("list", "--folder", "Work", "--recursive")
+	if !strings.Contains(out, "From A") || !strings.Contains(out, "From B") {
+		t.Fatalf("entries not in the merged folder:\n%s", out)
+	}
+	b.mustRun("push")
+}
+
+// Showing and picking read the remote folders without importing them;
+// only the folders of picked entries are created.
+func TestConflict_PickImportsOnlyUsedFolders(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.mustRun("folder", "add", "--parents", "Work/Team")
+	a.mustRun("folder", "add", "Empty")
+	a.addEntry("From A", "a", "--folder", "Work/Team")
+	a.mustRun("push")
+	b.mustRun("folder", "add", "Local")
+	b.run("sync")
+
+	b.mustRun("conflict", "show")
+	if _, errOut, code := b.runInput("r\n", "conflict", "resolve", "--keep", "pick"); code != ExitOK {
+		t.Fatalf("resolve: exit %d: %s", code, errOut)
+	}
+
+	var folders []folderDoc
+	decodeDocument(t, b.mustRun("--format", "json", "folder", "list"), &folders)
+	var paths []string
+	for _, f := range folders {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	if want := []string{"Local", "Work", "Work/Team"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got folders %v, want %v", paths, want)
+	}
+	if out := b.mustRun("list", "--folder", "Work/Team"); !strings.Contains(out, "From A") {
+		t.Fatalf("picked entry not in its folder:\n%s", out)
+	}
+}
+
+// Renames, moves and deletions on either side merge against the base.
+func TestConflict_MergeFolderChanges(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	for _, name := range []string{"Work", "Home", "Old", "Keep"} {
+		a.mustRun("folder", "add", name)
+	}
+	a.mustRun("push")
+	b.mustRun("pull")
+
+	a.mustRun("folder", "rename", "Work", "Job")
+	a.mustRun("folder", "rm", "Old")
+	a.mustRun("folder", "move", "Keep", "Home")
+	a.mustRun("push")
+	b.mustRun("folder", "rename", "Home", "House")
+	b.mustRun("folder", "move", "Work", "House")
+	b.mustRun("folder", "rm", "Keep")
+	b.mustRun("folder", "add", "Extra")
+	b.run("sync")
+
+	if _, errOut, code := b.run("conflict", "merge"); code != ExitOK {
+		t.Fatalf("merge: exit %d: %s", code, errOut)
+	}
+
+	var folders []folderDoc
+	decodeDocument(t, b.mustRun("--format", "json", "folder", "list"), &folders)
+	var paths []string
+	for _, f := range folders {
+		paths = append(paths, f.Path)
+	}
+	sort.Strings(paths)
+	if want := []string{"Extra", "House", "House/Job"}; !reflect.DeepEqual(paths, want) {
+		t.Fatalf("got folders %v, want %v", paths, want)
+	}
+	b.mustRun("push")
+}
+
+func TestHistoryPurge(t *testing.T) {
+	a, b := newSyncPair(t)
+
+	a.mustRun("init")
+	a.addEntry("Old", "leaked")
+	a.mustRun("push")
+	a.mustRun("rekey")
+	a.addEntry("New", "fresh")
+	a.mustRun("push")
+
+	dir := filepath.Dir(a.vault)
+	commits := func() string {
+		t.Helper()
+		out, err := exec.Command("git", "-C", dir, "rev-list", "--count", "origin/main").CombinedOutput()
+		if err != nil {
+			t.Fatalf("rev-list: %v: %s", err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	if n := commits(); n != "2" {
+		t.Fatalf("expected 2 commits before purge, got %s", n)
+	}
+
+	// Declining leaves the remote alone
+	_, errOut, code := a.runInput("n\n", "history", "purge")
+	if code != ExitUsage || !strings.Contains(errOut, "will run: git -C "+dir+" push --force-with-lease=refs/heads/main:") {
+		t.Fatalf("expected the force push to be shown then aborted, exit %d:\n%s", code, errOut)
+	}
+	if n := commits(); n != "2" {
+		t.Fatalf("declined purge rewrote history: %s commits", n)
+	}
+
+	// Default keeps only commits since the rekey
+	if _, errOut, code := a.runInput("y\n", "history", "purge"); code != ExitOK {
+		t.Fatalf("purge: exit %d: %s", code, errOut)
+	}
+	if n := commits(); n != "1" {
+		t.Fatalf("expected 1 commit after purge, got %s", n)
+	}
+	if out := a.mustRun("history", "purge", "--squash"); !strings.Contains(out, "nothing to purge") {
+		t.Fatalf("expected nothing left to purge:\n%s", out)
+	}
+
+	// A fresh clone gets the rekeyed vault only
+	b.mustRun("pull")
+	if out := b.mustRun("list"); !strings.Contains(out, "Old") || !strings.Contains(out, "New") {
+		t.Fatalf("purged remote vault missing entries:\n%s", out)
+	}
+}
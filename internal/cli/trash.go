@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"yap/internal/db"
+	"yap/internal/vault"
+)
+
+/*
+* Trash
+*
+* rm moves entries to the trash. They stay out of list, show and search
+* until restored, and are purged on the first commit after the retention
+* period, or by empty.
+* */
+func init() {
+	register(&command{
+		name:    "trash",
+		usage:   "[list] | restore <id|title> | empty [--yes] [<id|title>] | retention [DAYS]",
+		summary: "List, restore or purge removed entries",
+		run:     runTrash,
+	})
+}
+
+type trashedDoc struct {
+	ID        string `json:"id"`
+	Title     string `json:"title"`
+	Type      string `json:"type"`
+	DeletedAt int64  `json:"deleted_at"`
+}
+
+type trashDoc struct {
+	RetentionDays int          `json:"retention_days"`
+	Entries       []trashedDoc `json:"entries"`
+}
+
+type trashEmptiedDoc struct {
+	Purged       int    `json:"purged"`
+	VaultVersion uint64 `json:"vault_version"`
+}
+
+type trashRetentionDoc struct {
+	RetentionDays int    `json:"retention_days"`
+	VaultVersion  uint64 `json:"vault_version,omitempty"`
+}
+
+func runTrash(a *app, args []string) error {
+	if len(args) == 0 {
+		return runTrashList(a, args)
+	}
+
+	switch args[0] {
+	case "list":
+		return runTrashList(a, args[1:])
+	case "restore":
+		return runTrashRestore(a, args[1:])
+	case "empty":
+		return runTrashEmpty(a, args[1:])
+	case "retention":
+		return runTrashRetention(a, args[1:])
+	default:
+		return fmt.Errorf("%w: unknown trash subcommand %q", errUsage, args[0])
+	}
+}
+
+func runTrashList(a *app, args []string) error {
+	fs := a.newFlagSet("trash")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("%w: trash list takes no arguments", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	entries, err := v.ListTrash()
+	if err != nil {
+		return err
+	}
+	days, err := v.TrashRetention()
+	if err != nil {
+		return err
+	}
+
+	doc := trashDoc{RetentionDays: days, Entries: make([]trashedDoc, len(entries))}
+	for i, e := range entries {
+		doc.Entries[i] = trashedDoc{ID: e.ID, Title: e.Title, Type: string(e.Type), DeletedAt: e.DeletedAt}
+	}
+
+	return a.render("trash", doc, func(w io.Writer) error {
+		if len(doc.Entries) == 0 {
+			fmt.Fprintln(w, "trash is empty")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tTITLE\tTYPE\tDELETED")
+		for _, d := range doc.Entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", d.ID, d.Title, d.Type, formatTime(d.DeletedAt))
+		}
+		return tw.Flush()
+	})
+}
+
+func runTrashRestore(a *app, args []string) error {
+	fs := a.newFlagSet("trash")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("%w: trash restore takes exactly one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	e, err := findTrashed(v, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := v.RestoreEntry(e.ID); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	return a.render("entry_restored", mutationDoc{ID: e.ID, VaultVersion: v.VaultVersion()}, func(w io.Writer) error {
+		fmt.Fprintf(w, "restored %s (vault version %d)\n", e.ID, v.VaultVersion())
+		return nil
+	})
+}
+
+// runTrashEmpty purges one trashed entry, or all of them.
+func runTrashEmpty(a *app, args []string) error {
+	fs := a.newFlagSet("trash")
+	yes := fs.Bool("yes", false, "Do not ask before purging")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%w: trash empty takes at most one entry", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	var purged int
+	if fs.NArg() == 1 {
+		e, err := findTrashed(v, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		if !*yes {
+			if err := a.confirm(fmt.Sprintf("purge %s for good?", e.Title)); err != nil {
+				return err
+			}
+		}
+		if err := v.PurgeEntry(e.ID); err != nil {
+			return err
+		}
+		purged = 1
+	} else {
+		entries, err := v.ListTrash()
+		if err != nil {
+			return err
+		}
+		if len(entries) > 0 && !*yes {
+			if err := a.confirm(fmt.Sprintf("purge %d entries for good?", len(entries))); err != nil {
+				return err
+			}
+		}
+		if purged, err = v.EmptyTrash(); err != nil {
+			return err
+		}
+	}
+	if purged > 0 {
+		if err := a.commit(v); err != nil {
+			return err
+		}
+	}
+
+	doc := trashEmptiedDoc{Purged: purged, VaultVersion: v.VaultVersion()}
+	return a.render("trash_emptied", doc, func(w io.Writer) error {
+		if purged == 0 {
+			fmt.Fprintln(w, "trash is empty")
+			return nil
+		}
+		fmt.Fprintf(w, "purged %d entries (vault version %d)\n", purged, v.VaultVersion())
+		return nil
+	})
+}
+
+func runTrashRetention(a *app, args []string) error {
+	fs := a.newFlagSet("trash")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if fs.NArg() > 1 {
+		return fmt.Errorf("%w: trash retention takes at most one number of days", errUsage)
+	}
+
+	v, err := a.openVault()
+	if err != nil {
+		return err
+	}
+	defer v.Close()
+
+	if fs.NArg() == 0 {
+		days, err := v.TrashRetention()
+		if err != nil {
+			return err
+		}
+		return a.render("trash_retention", trashRetentionDoc{RetentionDays: days}, func(w io.Writer) error {
+			fmt.Fprintln(w, describeRetention(days))
+			return nil
+		})
+	}
+
+	days, err := strconv.Atoi(fs.Arg(0))
+	if err != nil || days < 0 {
+		return fmt.Errorf("%w: trash retention must be 0 or more days", errUsage)
+	}
+	if err := v.SetTrashRetention(days); err != nil {
+		return err
+	}
+	if err := a.commit(v); err != nil {
+		return err
+	}
+
+	doc := trashRetentionDoc{RetentionDays: days, VaultVersion: v.VaultVersion()}
+	return a.render("trash_retention", doc, func(w io.Writer) error {
+		fmt.Fprintf(w, "%s (vault version %d)\n", describeRetention(days), v.VaultVersion())
+		return nil
+	})
+}
+
+func describeRetention(days int) string {
+	if days == 0 {
+		return "keeping trashed entries until the trash is emptied"
+	}
+	return fmt.Sprintf("purging trashed entries after %d days", days)
+}
+
+// findTrashed resolves ref among the trashed entries.
+func findTrashed(v *vault.Vault, ref string) (*db.Entry, error) {
+	entries, err := v.ListTrash()
+	if err != nil {
+		return nil, err
+	}
+	return matchEntry(entries, ref)
+}
@@ -0,0 +1,51 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	env := newTestEnv(t)
+	env.mustRun("init")
+	env.addEntry("GitHub", "hunter2")
+	env.addEntry("Email", "hunter3")
+	env.addEntry("Bank", "hunter4")
+
+	env.mustRun("rm", "GitHub")
+	env.mustRun("rm", "Email")
+	if out := env.mustRun("list"); strings.Contains(out, "GitHub") {
+		t.Fatalf("trashed entry still listed:\n%s", out)
+	}
+	if _, _, code := env.run("show", "GitHub"); code != ExitNotFound {
+		t.Fatalf("show trashed entry: expected exit %d, got %d", ExitNotFound, code)
+	}
+
+	var trash trashDoc
+	doc := decodeDocument(t, env.mustRun("--format", "json", "trash"), &trash)
+	if doc.Kind != "trash" || len(trash.Entries) != 2 || trash.RetentionDays != 30 {
+		t.Fatalf("unexpected trash document: %+v %+v", doc, trash)
+	}
+
+	env.mustRun("trash", "restore", "GitHub")
+	if out := env.mustRun("show", "--reveal", "GitHub"); !strings.Contains(out, "hunter2") {
+		t.Fatalf("entry not restored:\n%s", out)
+	}
+	if _, _, code := env.run("trash", "restore", "Bank"); code != ExitNotFound {
+		t.Fatalf("restore live entry: expected exit %d, got %d", ExitNotFound, code)
+	}
+
+	// empty asks first
+	if _, _, code := env.runInput("n\n", "trash", "empty"); code != ExitUsage {
+		t.Fatalf("declined empty: expected exit %d, got %d", ExitUsage, code)
+	}
+	env.mustRun("trash", "empty", "--yes")
+	if out := env.mustRun("trash", "list"); !strings.Contains(out, "trash is empty") {
+		t.Fatalf("trash not emptied:\n%s", out)
+	}
+
+	env.mustRun("trash", "retention", "0")
+	if out := env.mustRun("trash", "retention"); !strings.Contains(out, "until the trash is emptied") {
+		t.Fatalf("retention not stored:\n%s", out)
+	}
+}
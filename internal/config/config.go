@@ -5,4 +5,11 @@ type Config struct {
 	RepoPath string
 	Debug bool
 	ConfigFile string
+
+	// Output format: "table" or "json"
+	Format string
+
+	// Master password source, never the password itself
+	PasswordFD   int
+	PasswordFile string
 }
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"os"
+	yerrors "yap/internal/errors"
 )
 
 
@@ -10,13 +11,14 @@ func Load(cfg *Config) error {
 	if cfg.ConfigFile != "" {
 		info, err := os.Stat(cfg.ConfigFile)
 		if err != nil {
-			return fmt.Errorf("config file error: %w", err)
+			return fmt.Errorf("%w: config file error: %w", yerrors.ErrConfig, err)
 		}
 
 		// Enforce 0600 permissions
 		if info.Mode().Perm()&0077 != 0 {
 			return fmt.Errorf(
-				"config file %s must not be group/world readable",
+				"%w: config file %s must not be group/world readable",
+				yerrors.ErrConfig,
 				cfg.ConfigFile,
 			)
 		}
@@ -25,7 +27,7 @@ func Load(cfg *Config) error {
 	}
 
 	if cfg.VaultPath == "" {
-		return fmt.Errorf("vault path is required")
+		return fmt.Errorf("%w: vault path is required", yerrors.ErrConfig)
 	}
 
 	return nil
@@ -23,6 +23,24 @@ func Hash(data []byte) ([]byte, error) {
 	return h.Sum(nil), nil
 }
 
+// MAC computes a keyed BLAKE2b-256 tag.
+func MAC(key []byte, data []byte) ([]byte, error) {
+	if len(key) == 0 || len(key) > 64 {
+		return nil, fmt.Errorf("blake2b mac key must be 1-64 bytes")
+	}
+
+	h, err := blake2b.New(HashSize, key)
+	if err != nil {
+		return nil, fmt.Errorf("blake2b init failed: %w", err)
+	}
+
+	if _, err := h.Write(data); err != nil {
+		return nil, fmt.Errorf("blake2b write failed: %w", err)
+	}
+
+	return h.Sum(nil), nil
+}
+
 // Usage pattern
 //
 // Generating nonce safely
@@ -33,3 +33,18 @@ func TestHash_Length(t *testing.T) {
 		t.Fatalf("expected %d-byte hash, got %d", HashSize, len(h1))
 	}
 }
+
+func TestMAC_KeyMatters(t *testing.T) {
+	m1, err := MAC([]byte("key-1"), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m2, err := MAC([]byte("key-2"), []byte("data"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(m1) == string(m2) {
+		t.Fatal("different keys produced same mac")
+	}
+}
@@ -0,0 +1,128 @@
+/*
+* Secret - key material with a bounded lifetime
+*
+* Keys live outside the Go heap, in memory that is locked (where the OS
+* allows it) so it is never written to swap. Destroy zeroes and releases
+* it; every key has exactly one owner responsible for calling it.
+*
+* A finalizer destroys secrets that are dropped without Destroy, but code
+* must not rely on it: the key then lives until the next GC.
+*
+* Bytes returned by Bytes alias the locked memory and must not be used
+* after Destroy. Copies made by callers (AEAD inputs, CBOR) are their
+* responsibility; use Wipe on them.
+* */
+package crypto
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+type Secret struct {
+	mu     sync.Mutex
+	buf    []byte // len(buf) bytes of key material inside mem
+	mem    []byte // whole allocation, page aligned when locked
+	locked bool
+}
+
+// NewSecret allocates a zeroed secret of n bytes.
+func NewSecret(n int) (*Secret, error) {
+	if n <= 0 {
+		return nil, fmt.Errorf("secret size must be positive")
+	}
+
+	mem, locked, err := allocSecret(n)
+	if err != nil {
+		return nil, fmt.Errorf("secret allocation failed: %w", err)
+	}
+
+	s := &Secret{buf: mem[:n:n], mem: mem, locked: locked}
+	runtime.SetFinalizer(s, (*Secret).Destroy)
+	return s, nil
+}
+
+// NewSecretFrom moves b into a new secret and wipes b.
+func NewSecretFrom(b []byte) (*Secret, error) {
+	defer Wipe(b)
+
+	s, err := NewSecret(len(b))
+	if err != nil {
+		return nil, err
+	}
+	copy(s.buf, b)
+	return s, nil
+}
+
+// RandomSecret returns a secret of n bytes read from rng.
+func RandomSecret(rng RNG, n int) (*Secret, error) {
+	s, err := NewSecret(n)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := rng.Read(s.buf); err != nil {
+		s.Destroy()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Bytes returns the key material, or nil once destroyed.
+func (s *Secret) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf
+}
+
+// Len returns the key size, 0 once destroyed.
+func (s *Secret) Len() int {
+	return len(s.Bytes())
+}
+
+// Locked reports whether the memory is locked against swapping.
+func (s *Secret) Locked() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.locked
+}
+
+// Equal compares two secrets in constant time.
+func (s *Secret) Equal(other *Secret) bool {
+	a, b := s.Bytes(), other.Bytes()
+	if a == nil || b == nil || len(a) != len(b) {
+		return false
+	}
+	var v byte
+	for i := range a {
+		v |= a[i] ^ b[i]
+	}
+	return v == 0
+}
+
+// Destroy zeroes and releases the secret. It is safe to call more than
+// once and on nil.
+func (s *Secret) Destroy() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.mem == nil {
+		return
+	}
+	Wipe(s.mem)
+	freeSecret(s.mem, s.locked)
+	s.buf, s.mem, s.locked = nil, nil, false
+	runtime.SetFinalizer(s, nil)
+}
+
+// Wipe zeroes b in place.
+func Wipe(b []byte) {
+	clear(b)
+	runtime.KeepAlive(b)
+}
@@ -0,0 +1,11 @@
+//go:build !unix
+
+package crypto
+
+// allocSecret falls back to the Go heap where memory cannot be locked.
+// Secrets are still wiped on Destroy.
+func allocSecret(n int) ([]byte, bool, error) {
+	return make([]byte, n), false, nil
+}
+
+func freeSecret([]byte, bool) {}
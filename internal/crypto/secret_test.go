@@ -0,0 +1,69 @@
+package crypto
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSecret_FromWipesSource(t *testing.T) {
+	src := []byte("0123456789abcdef0123456789abcdef")
+	s, err := NewSecretFrom(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Destroy()
+
+	if !bytes.Equal(s.Bytes(), []byte("0123456789abcdef0123456789abcdef")) {
+		t.Fatal("secret does not hold the source bytes")
+	}
+	if !bytes.Equal(src, make([]byte, len(src))) {
+		t.Fatal("source was not wiped")
+	}
+}
+
+func TestSecret_DestroyReleases(t *testing.T) {
+	s, err := RandomSecret(SecureRNG{}, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(s.Bytes(), make([]byte, 32)) {
+		t.Fatal("random secret is all zero")
+	}
+
+	s.Destroy()
+	s.Destroy() // idempotent
+	if s.Bytes() != nil || s.Len() != 0 {
+		t.Fatal("destroyed secret still exposes key material")
+	}
+
+	var nilSecret *Secret
+	nilSecret.Destroy()
+	if nilSecret.Bytes() != nil {
+		t.Fatal("nil secret returned bytes")
+	}
+}
+
+func TestSecret_Equal(t *testing.T) {
+	a, _ := NewSecretFrom([]byte("same key"))
+	b, _ := NewSecretFrom([]byte("same key"))
+	c, _ := NewSecretFrom([]byte("diff key"))
+	defer a.Destroy()
+	defer b.Destroy()
+	defer c.Destroy()
+
+	if !a.Equal(b) || a.Equal(c) {
+		t.Fatal("unexpected Equal result")
+	}
+	b.Destroy()
+	if a.Equal(b) {
+		t.Fatal("destroyed secret compared equal")
+	}
+}
+
+func TestWipe(t *testing.T) {
+	b := []byte("hunter2")
+	Wipe(b)
+	if !bytes.Equal(b, make([]byte, 7)) {
+		t.Fatal("Wipe left data behind")
+	}
+}
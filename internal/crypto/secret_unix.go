@@ -0,0 +1,31 @@
+//go:build unix
+
+package crypto
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// allocSecret maps anonymous pages for n bytes and tries to lock them.
+// Locking can fail under a low RLIMIT_MEMLOCK; the secret is still
+// usable and wiped, just not pinned.
+func allocSecret(n int) ([]byte, bool, error) {
+	page := os.Getpagesize()
+	size := (n + page - 1) / page * page
+
+	mem, err := unix.Mmap(-1, 0, size, unix.PROT_READ|unix.PROT_WRITE, unix.MAP_ANON|unix.MAP_PRIVATE)
+	if err != nil {
+		return nil, false, err
+	}
+	locked := unix.Mlock(mem) == nil
+	return mem, locked, nil
+}
+
+func freeSecret(mem []byte, locked bool) {
+	if locked {
+		unix.Munlock(mem)
+	}
+	unix.Munmap(mem)
+}
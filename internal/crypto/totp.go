@@ -0,0 +1,201 @@
+/*
+* TOTP - time-based one-time passwords (RFC 6238)
+*
+* A TOTP is HOTP (RFC 4226) over the number of periods since the Unix
+* epoch. Secrets come either as a raw base32 string, as printed under
+* most QR codes, or as an otpauth:// URI:
+*
+* 	otpauth://totp/Issuer:account?secret=BASE32&issuer=Issuer
+* 		&algorithm=SHA1|SHA256|SHA512&digits=6|8&period=30
+*
+* Missing parameters take the RFC defaults: SHA1, 6 digits, 30 seconds.
+* URI returns the canonical form, which is what gets stored.
+*/
+package crypto
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	TOTPDefaultAlgorithm = "SHA1"
+	TOTPDefaultDigits    = 6
+	TOTPDefaultPeriod    = 30
+)
+
+type TOTP struct {
+	Secret    []byte
+	Algorithm string // SHA1, SHA256 or SHA512
+	Digits    int    // 6 or 8
+	Period    int    // seconds
+	Issuer    string
+	Account   string
+}
+
+// ParseTOTP accepts an otpauth://totp/ URI or a raw base32 secret.
+func ParseTOTP(s string) (*TOTP, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(strings.ToLower(s), "otpauth:") {
+		secret, err := decodeBase32Secret(s)
+		if err != nil {
+			return nil, err
+		}
+		return &TOTP{
+			Secret:    secret,
+			Algorithm: TOTPDefaultAlgorithm,
+			Digits:    TOTPDefaultDigits,
+			Period:    TOTPDefaultPeriod,
+		}, nil
+	}
+
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("totp: invalid uri: %w", err)
+	}
+	if !strings.EqualFold(u.Host, "totp") {
+		return nil, fmt.Errorf("totp: only otpauth://totp/ is supported, got %q", u.Host)
+	}
+	q := u.Query()
+
+	t := &TOTP{
+		Algorithm: TOTPDefaultAlgorithm,
+		Digits:    TOTPDefaultDigits,
+		Period:    TOTPDefaultPeriod,
+		Issuer:    q.Get("issuer"),
+	}
+	label := strings.TrimPrefix(u.Path, "/")
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		if t.Issuer == "" {
+			t.Issuer = strings.TrimSpace(issuer)
+		}
+		label = account
+	}
+	t.Account = strings.TrimSpace(label)
+
+	if t.Secret, err = decodeBase32Secret(q.Get("secret")); err != nil {
+		return nil, err
+	}
+	if v := q.Get("algorithm"); v != "" {
+		t.Algorithm = strings.ToUpper(v)
+	}
+	if v := q.Get("digits"); v != "" {
+		if t.Digits, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("totp: invalid digits %q", v)
+		}
+	}
+	if v := q.Get("period"); v != "" {
+		if t.Period, err = strconv.Atoi(v); err != nil {
+			return nil, fmt.Errorf("totp: invalid period %q", v)
+		}
+	}
+	if err := t.validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *TOTP) validate() error {
+	if _, err := totpHash(t.Algorithm); err != nil {
+		return err
+	}
+	if t.Digits != 6 && t.Digits != 8 {
+		return fmt.Errorf("totp: digits must be 6 or 8, got %d", t.Digits)
+	}
+	if t.Period <= 0 || t.Period > 3600 {
+		return fmt.Errorf("totp: period must be 1-3600 seconds, got %d", t.Period)
+	}
+	return nil
+}
+
+// decodeBase32Secret decodes a base32 secret, ignoring case, spaces,
+// dashes and missing padding.
+func decodeBase32Secret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.NewReplacer(" ", "", "-", "").Replace(s))
+	s = strings.TrimRight(s, "=")
+	if s == "" {
+		return nil, fmt.Errorf("totp: secret is empty")
+	}
+	secret, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("totp: secret is not base32")
+	}
+	return secret, nil
+}
+
+func totpHash(algorithm string) (func() hash.Hash, error) {
+	switch algorithm {
+	case "SHA1":
+		return sha1.New, nil
+	case "SHA256":
+		return sha256.New, nil
+	case "SHA512":
+		return sha512.New, nil
+	default:
+		return nil, fmt.Errorf("totp: unsupported algorithm %q (SHA1, SHA256, SHA512)", algorithm)
+	}
+}
+
+// URI returns t as a canonical otpauth URI.
+func (t *TOTP) URI() string {
+	label := t.Account
+	if t.Issuer != "" {
+		label = t.Issuer + ":" + t.Account
+	}
+
+	q := url.Values{}
+	q.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(t.Secret))
+	if t.Issuer != "" {
+		q.Set("issuer", t.Issuer)
+	}
+	q.Set("algorithm", t.Algorithm)
+	q.Set("digits", strconv.Itoa(t.Digits))
+	q.Set("period", strconv.Itoa(t.Period))
+
+	u := url.URL{Scheme: "otpauth", Host: "totp", Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// Code returns the code valid at now.
+func (t *TOTP) Code(now time.Time) (string, error) {
+	if err := t.validate(); err != nil {
+		return "", err
+	}
+	h, _ := totpHash(t.Algorithm)
+	counter := uint64(now.Unix()) / uint64(t.Period)
+	return hotp(h, t.Secret, counter, t.Digits), nil
+}
+
+// Remaining returns the seconds the code valid at now stays valid.
+func (t *TOTP) Remaining(now time.Time) int {
+	return t.Period - int(uint64(now.Unix())%uint64(t.Period))
+}
+
+// hotp computes an RFC 4226 code with dynamic truncation.
+func hotp(h func() hash.Hash, secret []byte, counter uint64, digits int) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], counter)
+
+	mac := hmac.New(h, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for range digits {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
@@ -0,0 +1,89 @@
+package crypto
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B
+func TestTOTP_RFC6238Vectors(t *testing.T) {
+	secrets := map[string]string{
+		"SHA1":   "12345678901234567890",
+		"SHA256": "12345678901234567890123456789012",
+		"SHA512": "1234567890123456789012345678901234567890123456789012345678901234",
+	}
+	tests := []struct {
+		unix int64
+		want map[string]string
+	}{
+		{59, map[string]string{"SHA1": "94287082", "SHA256": "46119246", "SHA512": "90693936"}},
+		{1111111109, map[string]string{"SHA1": "07081804", "SHA256": "68084774", "SHA512": "25091201"}},
+		{1234567890, map[string]string{"SHA1": "89005924", "SHA256": "91819424", "SHA512": "93441116"}},
+		{20000000000, map[string]string{"SHA1": "65353130", "SHA256": "77737706", "SHA512": "47863826"}},
+	}
+
+	for _, tt := range tests {
+		for alg, want := range tt.want {
+			otp := &TOTP{Secret: []byte(secrets[alg]), Algorithm: alg, Digits: 8, Period: 30}
+			got, err := otp.Code(time.Unix(tt.unix, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != want {
+				t.Fatalf("%s at %d: got %s, want %s", alg, tt.unix, got, want)
+			}
+		}
+	}
+}
+
+func TestParseTOTP(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	raw, err := ParseTOTP(strings.ToLower(secret[:8]) + " " + secret[8:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(raw.Secret) != "12345678901234567890" || raw.Algorithm != "SHA1" || raw.Digits != 6 || raw.Period != 30 {
+		t.Fatalf("unexpected raw secret %+v", raw)
+	}
+	if code, _ := raw.Code(time.Unix(59, 0)); code != "287082" {
+		t.Fatalf("unexpected 6 digit code %s", code)
+	}
+
+	uri, err := ParseTOTP("otpauth://totp/ACME%20Co:alice@example.com?secret=" + secret +
+		"&algorithm=sha256&digits=8&period=60")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if uri.Issuer != "ACME Co" || uri.Account != "alice@example.com" || uri.Algorithm != "SHA256" ||
+		uri.Digits != 8 || uri.Period != 60 {
+		t.Fatalf("unexpected uri %+v", uri)
+	}
+	if r := uri.Remaining(time.Unix(125, 0)); r != 55 {
+		t.Fatalf("unexpected remaining %d", r)
+	}
+
+	again, err := ParseTOTP(uri.URI())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.URI() != uri.URI() || string(again.Secret) != string(uri.Secret) {
+		t.Fatalf("canonical uri does not round trip: %s", uri.URI())
+	}
+
+	for _, bad := range []string{
+		"",
+		"not base32!",
+		"otpauth://hotp/x?secret=" + secret,
+		"otpauth://totp/x",
+		"otpauth://totp/x?secret=" + secret + "&algorithm=MD5",
+		"otpauth://totp/x?secret=" + secret + "&digits=7",
+		"otpauth://totp/x?secret=" + secret + "&period=0",
+	} {
+		if _, err := ParseTOTP(bad); err == nil {
+			t.Fatalf("%q accepted", bad)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"time"
 	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
 	"yap/internal/keys"
 )
 
@@ -15,62 +16,147 @@ type Entry struct {
 	Password  string
 	URL       string
 	Notes     string
+	TOTP      string            // canonical otpauth URI, "" for none
+	Type      EntryType         // empty means login on write
+	Data      map[string]string // typed values, by TypeFields name
+	FolderID  string            // empty at the root
+	Favorite  bool
+	Tags      []string
+	Fields    []CustomField
 	CreatedAt int64
 	UpdatedAt int64
+	DeletedAt int64 // when it went to the trash, 0 if it is not there
 }
 
+// normalizeExtras validates and normalizes the tags, custom fields and
+// typed values of entry before they are written.
+func normalizeExtras(entry *Entry) error {
+	tags, err := NormalizeTags(entry.Tags)
+	if err != nil {
+		return err
+	}
+	entry.Tags = tags
+	if err := validateFields(entry.Fields); err != nil {
+		return err
+	}
+	if entry.TOTP != "" {
+		otp, err := crypto.ParseTOTP(entry.TOTP)
+		if err != nil {
+			return fmt.Errorf("%w: %w", yerrors.ErrInvalidInput, err)
+		}
+		entry.TOTP = otp.URI()
+	}
+	return normalizeEntryData(entry)
+}
+
+// CreateEntry stores a new entry, created and updated now.
 func CreateEntry(
 	db *sql.DB,
 	vaultID string,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 	entry Entry,
 	rng crypto.RNG,
 ) error {
-	if entry.ID == "" {
-		return fmt.Errorf("entry id required")
-	}
-
 	now := time.Now().Unix()
 	entry.CreatedAt = now
 	entry.UpdatedAt = now
+	return createEntry(db, vaultID, vaultKey, entry, nil, rng)
+}
+
+// ImportEntry stores an entry copied from another copy of the vault,
+// keeping its timestamps and the newest password history versions the
+// limit allows. Zero timestamps mean now.
+func ImportEntry(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	entry Entry,
+	history []PasswordVersion,
+	rng crypto.RNG,
+) error {
+	now := time.Now().Unix()
+	if entry.CreatedAt == 0 {
+		entry.CreatedAt = now
+	}
+	if entry.UpdatedAt == 0 {
+		entry.UpdatedAt = now
+	}
+	return createEntry(db, vaultID, vaultKey, entry, history, rng)
+}
+
+func createEntry(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	entry Entry,
+	history []PasswordVersion,
+	rng crypto.RNG,
+) error {
+	if entry.ID == "" {
+		return fmt.Errorf("entry id required")
+	}
+	if err := checkFolderParent(db, entry.FolderID); err != nil {
+		return err
+	}
+	if err := normalizeExtras(&entry); err != nil {
+		return err
+	}
+	historyLimit, err := GetHistoryLimit(db)
+	if err != nil {
+		return err
+	}
+	history = history[:min(len(history), historyLimit)]
 
 	entryKey, err := keys.GenerateEntryKey(rng)
 	if err != nil {
 		return fmt.Errorf("entry key generation failed: %w", err)
 	}
+	defer entryKey.Destroy()
+
 	// encrypt entry key
-	encEntryKey, err := EncryptField(entryKey, vaultKey, vaultID, entry.ID, "entry_key", rng)
+	encEntryKey, err := sealEntryKey(entryKey, vaultKey, vaultID, entry.ID, rng)
 	if err != nil {
 		return err
 	}
 
 	// encrypt fields
-	title, err := EncryptField([]byte(entry.Title), entryKey, vaultID, entry.ID, "title", rng)
+	title, err := EncryptField([]byte(entry.Title), entryKey.Bytes(), vaultID, entry.ID, "title", rng)
+	if err != nil {
+		return err
+	}
+	username, err := EncryptField([]byte(entry.Username), entryKey.Bytes(), vaultID, entry.ID, "username", rng)
+	if err != nil {
+		return err
+	}
+	password, err := EncryptField([]byte(entry.Password), entryKey.Bytes(), vaultID, entry.ID, "password", rng)
 	if err != nil {
 		return err
 	}
-	username, err := EncryptField([]byte(entry.Username), entryKey, vaultID, entry.ID, "username", rng)
+	url, err := EncryptField([]byte(entry.URL), entryKey.Bytes(), vaultID, entry.ID, "url", rng)
 	if err != nil {
 		return err
 	}
-	password, err := EncryptField([]byte(entry.Password), entryKey, vaultID, entry.ID, "password", rng)
+	notes, err := EncryptField([]byte(entry.Notes), entryKey.Bytes(), vaultID, entry.ID, "notes", rng)
 	if err != nil {
 		return err
 	}
-	url, err := EncryptField([]byte(entry.URL), entryKey, vaultID, entry.ID, "url", rng)
+	totp, err := EncryptField([]byte(entry.TOTP), entryKey.Bytes(), vaultID, entry.ID, "totp", rng)
 	if err != nil {
 		return err
 	}
-	notes, err := EncryptField([]byte(entry.Notes), entryKey, vaultID, entry.ID, "notes", rng)
+
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	_, err = db.Exec(`
+	if _, err := tx.Exec(`
 		INSERT INTO entries (
 			id, title, username, password, url, notes,
-			created_at, updated_at, entry_key
-		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			created_at, updated_at, entry_key, folder_id, favorite, type, totp,
+			deleted_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 		entry.ID,
 		title,
 		username,
@@ -80,29 +166,48 @@ func CreateEntry(
 		entry.CreatedAt,
 		entry.UpdatedAt,
 		encEntryKey,
-	)
+		nullableID(entry.FolderID),
+		entry.Favorite,
+		string(entry.Type),
+		totp,
+		nullableTime(entry.DeletedAt),
+	); err != nil {
+		return err
+	}
+	if err := writeEntryExtras(tx, vaultID, entryKey, entry, rng); err != nil {
+		return err
+	}
+	if err := insertHistory(tx, vaultID, entryKey, entry.ID, history, rng); err != nil {
+		return err
+	}
 
-	return err
+	return tx.Commit()
 }
 
 func GetEntry(
 	db *sql.DB,
 	vaultID string,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 	entryID string,
 ) (*Entry, error) {
 
 	row := db.QueryRow(`
 		SELECT title, username, password, url, notes,
-		       created_at, updated_at, entry_key
+		       created_at, updated_at, entry_key, folder_id, favorite, type, totp,
+		       deleted_at
 		FROM entries WHERE id = ?`,
 		entryID,
 	)
 
 	var (
 		titleEnc, usernameEnc, passwordEnc, urlEnc, notesEnc []byte
+		totpEnc                                              []byte // NULL before schema 5
 		entryKeyEnc                                           []byte
 		createdAt, updatedAt                                  int64
+		folderID                                              sql.NullString
+		favorite                                              bool
+		entryType                                             string
+		deletedAt                                             sql.NullInt64
 	)
 
 	if err := row.Scan(
@@ -114,133 +219,238 @@ func GetEntry(
 		&createdAt,
 		&updatedAt,
 		&entryKeyEnc,
-	); err != nil {
+		&folderID,
+		&favorite,
+		&entryType,
+		&totpEnc,
+		&deletedAt,
+	); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: entry %s", yerrors.ErrNotFound, entryID)
+	} else if err != nil {
 		return nil, err
 	}
 
 	// 1. Decrypt Entry Key
-	entryKey, err := DecryptField(
-		entryKeyEnc,
-		vaultKey,
-		vaultID,
-		entryID,
-		"entry_key",
-	)
+	entryKey, err := openEntryKey(entryKeyEnc, vaultKey, vaultID, entryID)
 	if err != nil {
 		return nil, err
 	}
+	defer entryKey.Destroy()
 
 	// 2. Decrypt fields
-	title, err := DecryptField(titleEnc, entryKey, vaultID, entryID, "title")
+	title, err := DecryptField(titleEnc, entryKey.Bytes(), vaultID, entryID, "title")
 	if err != nil {
 		return nil, err
 	}
-	username, err := DecryptField(usernameEnc, entryKey, vaultID, entryID, "username")
+	username, err := DecryptField(usernameEnc, entryKey.Bytes(), vaultID, entryID, "username")
 	if err != nil {
 		return nil, err
 	}
-	password, err := DecryptField(passwordEnc, entryKey, vaultID, entryID, "password")
+	password, err := DecryptField(passwordEnc, entryKey.Bytes(), vaultID, entryID, "password")
 	if err != nil {
 		return nil, err
 	}
-	url, err := DecryptField(urlEnc, entryKey, vaultID, entryID, "url")
+	url, err := DecryptField(urlEnc, entryKey.Bytes(), vaultID, entryID, "url")
 	if err != nil {
 		return nil, err
 	}
-	notes, err := DecryptField(notesEnc, entryKey, vaultID, entryID, "notes")
+	notes, err := DecryptField(notesEnc, entryKey.Bytes(), vaultID, entryID, "notes")
 	if err != nil {
 		return nil, err
 	}
+	var totp []byte
+	if totpEnc != nil {
+		if totp, err = DecryptField(totpEnc, entryKey.Bytes(), vaultID, entryID, "totp"); err != nil {
+			return nil, err
+		}
+	}
 
-	return &Entry{
+	entry := &Entry{
 		ID:        entryID,
 		Title:     string(title),
 		Username:  string(username),
 		Password:  string(password),
 		URL:       string(url),
 		Notes:     string(notes),
+		TOTP:      string(totp),
+		Type:      EntryType(entryType),
+		FolderID:  folderID.String,
+		Favorite:  favorite,
 		CreatedAt: createdAt,
 		UpdatedAt: updatedAt,
-	}, nil
+		DeletedAt: deletedAt.Int64,
+	}
+
+	// 3. Decrypt tags, custom fields and typed values
+	extras, err := loadEntryExtras(db, entryID)
+	if err != nil {
+		return nil, err
+	}
+	if err := extras.decrypt(entry, entryKey, vaultID); err != nil {
+		return nil, err
+	}
+	return entry, nil
 }
 
+// UpdateEntry rewrites an entry and stamps it as updated now.
 func UpdateEntry(
 	db *sql.DB,
 	vaultID string,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 	entry Entry,
 	rng crypto.RNG,
 ) error {
+	entry.UpdatedAt = time.Now().Unix()
+	return ApplyEntry(db, vaultID, vaultKey, entry, nil, rng)
+}
 
-	now := time.Now().Unix()
-	entry.UpdatedAt = now
+// ApplyEntry rewrites an entry keeping entry.UpdatedAt, for results of
+// a merge that are no newer than the sides they come from. A zero
+// UpdatedAt means now. history, the password history of the entry in
+// the other copy, is merged into this one's.
+func ApplyEntry(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	entry Entry,
+	history []PasswordVersion,
+	rng crypto.RNG,
+) error {
+	if entry.UpdatedAt == 0 {
+		entry.UpdatedAt = time.Now().Unix()
+	}
+
+	if err := checkFolderParent(db, entry.FolderID); err != nil {
+		return err
+	}
+	if err := normalizeExtras(&entry); err != nil {
+		return err
+	}
 
-	// Load encrypted entry key
-	var entryKeyEnc []byte
+	// Load encrypted entry key and the password being replaced
+	var entryKeyEnc, oldPasswordEnc []byte
 	if err := db.QueryRow(
-		`SELECT entry_key FROM entries WHERE id = ?`,
+		`SELECT entry_key, password FROM entries WHERE id = ?`,
 		entry.ID,
-	).Scan(&entryKeyEnc); err != nil {
+	).Scan(&entryKeyEnc, &oldPasswordEnc); err == sql.ErrNoRows {
+		return fmt.Errorf("%w: entry %s", yerrors.ErrNotFound, entry.ID)
+	} else if err != nil {
 		return err
 	}
 
-	entryKey, err := DecryptField(
-		entryKeyEnc,
-		vaultKey,
-		vaultID,
-		entry.ID,
-		"entry_key",
-	)
+	entryKey, err := openEntryKey(entryKeyEnc, vaultKey, vaultID, entry.ID)
+	if err != nil {
+		return err
+	}
+	defer entryKey.Destroy()
+
+	oldPassword, err := DecryptField(oldPasswordEnc, entryKey.Bytes(), vaultID, entry.ID, "password")
+	if err != nil {
+		return err
+	}
+	defer crypto.Wipe(oldPassword)
+	historyLimit, err := GetHistoryLimit(db)
 	if err != nil {
 		return err
 	}
 
 	// Encrypt updated fields
-	title, err := EncryptField([]byte(entry.Title), entryKey, vaultID, entry.ID, "title", rng)
+	title, err := EncryptField([]byte(entry.Title), entryKey.Bytes(), vaultID, entry.ID, "title", rng)
+	if err != nil {
+		return err
+	}
+	username, err := EncryptField([]byte(entry.Username), entryKey.Bytes(), vaultID, entry.ID, "username", rng)
 	if err != nil {
 		return err
 	}
-	username, err := EncryptField([]byte(entry.Username), entryKey, vaultID, entry.ID, "username", rng)
+	password, err := EncryptField([]byte(entry.Password), entryKey.Bytes(), vaultID, entry.ID, "password", rng)
 	if err != nil {
 		return err
 	}
-	password, err := EncryptField([]byte(entry.Password), entryKey, vaultID, entry.ID, "password", rng)
+	url, err := EncryptField([]byte(entry.URL), entryKey.Bytes(), vaultID, entry.ID, "url", rng)
 	if err != nil {
 		return err
 	}
-	url, err := EncryptField([]byte(entry.URL), entryKey, vaultID, entry.ID, "url", rng)
+	notes, err := EncryptField([]byte(entry.Notes), entryKey.Bytes(), vaultID, entry.ID, "notes", rng)
 	if err != nil {
 		return err
 	}
-	notes, err := EncryptField([]byte(entry.Notes), entryKey, vaultID, entry.ID, "notes", rng)
+	totp, err := EncryptField([]byte(entry.TOTP), entryKey.Bytes(), vaultID, entry.ID, "totp", rng)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	_, err = db.Exec(`
+	if _, err := tx.Exec(`
 		UPDATE entries SET
-			title = ?, username = ?, password = ?, url = ?, notes = ?,
-			updated_at = ?
+			title = ?, username = ?, password = ?, url = ?, notes = ?, totp = ?,
+			folder_id = ?, favorite = ?, type = ?, updated_at = ?, deleted_at = ?
 		WHERE id = ?`,
 		title,
 		username,
 		password,
 		url,
 		notes,
+		totp,
+		nullableID(entry.FolderID),
+		entry.Favorite,
+		string(entry.Type),
 		entry.UpdatedAt,
+		nullableTime(entry.DeletedAt),
 		entry.ID,
-	)
+	); err != nil {
+		return err
+	}
+	if err := writeEntryExtras(tx, vaultID, entryKey, entry, rng); err != nil {
+		return err
+	}
+	var replaced string
+	if len(oldPassword) > 0 && string(oldPassword) != entry.Password {
+		replaced = string(oldPassword)
+	}
+	if len(history) > 0 {
+		if err := mergeHistory(tx, vaultID, entryKey, entry.ID, history, replaced, historyLimit, rng); err != nil {
+			return err
+		}
+	} else if replaced != "" {
+		if err := recordPassword(tx, vaultID, entryKey, entry.ID, replaced, historyLimit, rng); err != nil {
+			return err
+		}
+	}
 
-	return err
+	return tx.Commit()
 }
 
-func DeleteEntry(db *sql.DB, entryID string) error {
-	_, err := db.Exec(`DELETE FROM entries WHERE id = ?`, entryID)
-	return err
+// MoveEntry puts an entry in a folder, or at the root for "". Only the
+// plaintext folder reference changes; no field is re-encrypted.
+func MoveEntry(db *sql.DB, entryID, folderID string) error {
+	if err := checkFolderParent(db, folderID); err != nil {
+		return err
+	}
+	res, err := db.Exec(`UPDATE entries SET folder_id = ?, updated_at = ? WHERE id = ?`,
+		nullableID(folderID), time.Now().Unix(), entryID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: entry %s", yerrors.ErrNotFound, entryID)
+	}
+	return nil
 }
 
+// ListEntryIDs returns the entries not in the trash, most recently
+// updated first.
 func ListEntryIDs(db *sql.DB) ([]string, error) {
-	rows, err := db.Query(`SELECT id FROM entries ORDER BY updated_at DESC`)
+	rows, err := db.Query(`SELECT id FROM entries WHERE deleted_at IS NULL ORDER BY updated_at DESC`)
 	if err != nil {
 		return nil, err
 	}
@@ -256,3 +466,11 @@ func ListEntryIDs(db *sql.DB) ([]string, error) {
 	}
 	return ids, nil
 }
+
+// nullableTime stores a zero timestamp as NULL.
+func nullableTime(t int64) any {
+	if t == 0 {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,86 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+func TestEntry_TOTP(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	// Raw secrets are stored as a canonical URI, encrypted
+	const secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+	if err := CreateEntry(conn, folderTestVaultID, key, Entry{ID: "e", Title: "t", TOTP: strings.ToLower(secret)}, rng); err != nil {
+		t.Fatal(err)
+	}
+	e, err := GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(e.TOTP, "otpauth://totp/") || !strings.Contains(e.TOTP, "secret="+secret) {
+		t.Fatalf("unexpected stored totp %q", e.TOTP)
+	}
+	var enc []byte
+	if err := conn.QueryRow(`SELECT totp FROM entries WHERE id = 'e'`).Scan(&enc); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, []byte(secret)) {
+		t.Fatal("totp secret stored in plaintext")
+	}
+
+	e.TOTP = "otpauth://totp/x?secret=" + secret + "&algorithm=MD5"
+	if err := UpdateEntry(conn, folderTestVaultID, key, *e, rng); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("invalid totp accepted: %v", err)
+	}
+
+	// Entries from before schema 5 have no totp
+	if _, err := conn.Exec(`UPDATE entries SET totp = NULL`); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = GetEntry(conn, folderTestVaultID, key, "e"); err != nil || e.TOTP != "" {
+		t.Fatalf("NULL totp: %+v, %v", e, err)
+	}
+	newKey, err := crypto.RandomSecret(rng, crypto.XChaChaKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newKey.Destroy()
+	if _, err := RekeyEntry(conn, folderTestVaultID, key, newKey, "e", true, rng); err != nil {
+		t.Fatalf("rekey with NULL totp: %v", err)
+	}
+}
+
+// Merge results keep the updated_at they were given; edits are stamped.
+func TestApplyEntry_KeepsUpdatedAt(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	if err := CreateEntry(conn, folderTestVaultID, key, Entry{ID: "e", Title: "t"}, rng); err != nil {
+		t.Fatal(err)
+	}
+	if err := ApplyEntry(conn, folderTestVaultID, key, Entry{ID: "e", Title: "merged", UpdatedAt: 1000}, nil, rng); err != nil {
+		t.Fatal(err)
+	}
+	e, err := GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Title != "merged" || e.UpdatedAt != 1000 {
+		t.Fatalf("unexpected applied entry %+v", e)
+	}
+
+	if err := UpdateEntry(conn, folderTestVaultID, key, *e, rng); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = GetEntry(conn, folderTestVaultID, key, "e"); err != nil {
+		t.Fatal(err)
+	}
+	if e.UpdatedAt == 1000 {
+		t.Fatal("update not stamped")
+	}
+}
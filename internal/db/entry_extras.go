@@ -0,0 +1,274 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+/*
+* Tags, custom fields and typed values
+*
+* All live in their own tables, one row per value, and are encrypted
+* under the entry key like the entry columns:
+*
+* 	entry_tags.tag      column "tag"
+* 	entry_fields.name   column "field_name"
+* 	entry_fields.value  column "field:" || name
+* 	entry_data.value    column "data:" || name   (see entry_types.go)
+*
+* The value AAD carries the decrypted field name, so a value cannot be
+* moved onto another field of the same entry. Names are unique within an
+* entry for that reason. The field kind only tells clients how to show
+* the value and is stored in clear.
+*
+* Rows are rewritten as a whole on every update; position keeps the
+* order the user gave.
+* */
+
+type FieldKind string
+
+const (
+	FieldText   FieldKind = "text"
+	FieldHidden FieldKind = "hidden" // masked unless revealed
+	FieldURL    FieldKind = "url"
+	FieldEmail  FieldKind = "email"
+)
+
+var fieldKinds = []FieldKind{FieldText, FieldHidden, FieldURL, FieldEmail}
+
+type CustomField struct {
+	Name  string
+	Kind  FieldKind
+	Value string
+}
+
+// ParseFieldKind accepts the name of a field kind.
+func ParseFieldKind(s string) (FieldKind, error) {
+	for _, k := range fieldKinds {
+		if string(k) == s {
+			return k, nil
+		}
+	}
+	return "", fmt.Errorf("%w: unknown field kind %q (text, hidden, url, email)", yerrors.ErrInvalidInput, s)
+}
+
+// NormalizeTags trims tags, drops case-insensitive duplicates and sorts
+// them. Tags may not be empty or contain commas or newlines.
+func NormalizeTags(tags []string) ([]string, error) {
+	seen := map[string]bool{}
+	var out []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || strings.ContainsAny(tag, ",\n") {
+			return nil, fmt.Errorf("%w: invalid tag %q", yerrors.ErrInvalidInput, tag)
+		}
+		if key := strings.ToLower(tag); !seen[key] {
+			seen[key] = true
+			out = append(out, tag)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return strings.ToLower(out[i]) < strings.ToLower(out[j]) })
+	return out, nil
+}
+
+// validateFields checks custom field names and kinds. Names may not
+// contain ":" or newlines and are unique case-insensitively.
+func validateFields(fields []CustomField) error {
+	seen := map[string]bool{}
+	for _, f := range fields {
+		if strings.TrimSpace(f.Name) == "" || strings.ContainsAny(f.Name, ":\n") {
+			return fmt.Errorf("%w: invalid field name %q", yerrors.ErrInvalidInput, f.Name)
+		}
+		if _, err := ParseFieldKind(string(f.Kind)); err != nil {
+			return err
+		}
+		key := strings.ToLower(f.Name)
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate field %q", yerrors.ErrInvalidInput, f.Name)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// writeEntryExtras replaces the tags, custom fields and typed values of
+// entry.
+func writeEntryExtras(
+	tx *sql.Tx,
+	vaultID string,
+	entryKey *crypto.Secret,
+	entry Entry,
+	rng crypto.RNG,
+) error {
+	if _, err := tx.Exec(`DELETE FROM entry_tags WHERE entry_id = ?`, entry.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM entry_fields WHERE entry_id = ?`, entry.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM entry_data WHERE entry_id = ?`, entry.ID); err != nil {
+		return err
+	}
+
+	for i, tag := range entry.Tags {
+		enc, err := EncryptField([]byte(tag), entryKey.Bytes(), vaultID, entry.ID, "tag", rng)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO entry_tags (entry_id, position, tag) VALUES (?, ?, ?)`,
+			entry.ID, i, enc,
+		); err != nil {
+			return err
+		}
+	}
+
+	for i, f := range entry.Fields {
+		name, err := EncryptField([]byte(f.Name), entryKey.Bytes(), vaultID, entry.ID, "field_name", rng)
+		if err != nil {
+			return err
+		}
+		value, err := EncryptField([]byte(f.Value), entryKey.Bytes(), vaultID, entry.ID, "field:"+f.Name, rng)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO entry_fields (entry_id, position, kind, name, value) VALUES (?, ?, ?, ?, ?)`,
+			entry.ID, i, string(f.Kind), name, value,
+		); err != nil {
+			return err
+		}
+	}
+
+	for name, value := range entry.Data {
+		enc, err := EncryptField([]byte(value), entryKey.Bytes(), vaultID, entry.ID, "data:"+name, rng)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO entry_data (entry_id, name, value) VALUES (?, ?, ?)`,
+			entry.ID, name, enc,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encryptedField is an entry_fields row before decryption.
+type encryptedField struct {
+	kind        string
+	name, value []byte
+}
+
+// encryptedExtras are the extra rows of one entry before decryption.
+type encryptedExtras struct {
+	tags   [][]byte
+	fields []encryptedField
+	data   map[string][]byte
+}
+
+// querier is a *sql.DB or a *sql.Tx.
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+// loadEntryExtras reads the encrypted extra rows of an entry.
+func loadEntryExtras(q querier, entryID string) (*encryptedExtras, error) {
+	x := &encryptedExtras{}
+
+	rows, err := q.Query(`SELECT tag FROM entry_tags WHERE entry_id = ? ORDER BY position`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tag []byte
+		if err := rows.Scan(&tag); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		x.tags = append(x.tags, tag)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`SELECT kind, name, value FROM entry_fields WHERE entry_id = ? ORDER BY position`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var f encryptedField
+		if err := rows.Scan(&f.kind, &f.name, &f.value); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		x.fields = append(x.fields, f)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = q.Query(`SELECT name, value FROM entry_data WHERE entry_id = ?`, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			name  string
+			value []byte
+		)
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		if x.data == nil {
+			x.data = map[string][]byte{}
+		}
+		x.data[name] = value
+	}
+	return x, rows.Err()
+}
+
+// decrypt fills the tags, custom fields and typed values of entry.
+func (x *encryptedExtras) decrypt(entry *Entry, entryKey *crypto.Secret, vaultID string) error {
+	entry.Tags, entry.Fields, entry.Data = nil, nil, nil
+
+	for _, enc := range x.tags {
+		tag, err := DecryptField(enc, entryKey.Bytes(), vaultID, entry.ID, "tag")
+		if err != nil {
+			return err
+		}
+		entry.Tags = append(entry.Tags, string(tag))
+	}
+
+	for _, enc := range x.fields {
+		name, err := DecryptField(enc.name, entryKey.Bytes(), vaultID, entry.ID, "field_name")
+		if err != nil {
+			return err
+		}
+		value, err := DecryptField(enc.value, entryKey.Bytes(), vaultID, entry.ID, "field:"+string(name))
+		if err != nil {
+			return err
+		}
+		entry.Fields = append(entry.Fields, CustomField{Name: string(name), Kind: FieldKind(enc.kind), Value: string(value)})
+	}
+
+	for name, enc := range x.data {
+		value, err := DecryptField(enc, entryKey.Bytes(), vaultID, entry.ID, "data:"+name)
+		if err != nil {
+			return err
+		}
+		if entry.Data == nil {
+			entry.Data = map[string]string{}
+		}
+		entry.Data[name] = string(value)
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package db
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+func TestEntryExtras_RoundTrip(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	in := Entry{
+		ID:       "e",
+		Title:    "GitHub",
+		Favorite: true,
+		Tags:     []string{" work", "Dev", "dev"},
+		Fields: []CustomField{
+			{Name: "API key", Kind: FieldHidden, Value: "ghp_secret"},
+			{Name: "Login", Kind: FieldURL, Value: "https://github.com/login"},
+		},
+	}
+	if err := CreateEntry(conn, folderTestVaultID, key, in, rng); err != nil {
+		t.Fatal(err)
+	}
+
+	e, err := GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !e.Favorite || !reflect.DeepEqual(e.Tags, []string{"Dev", "work"}) || !reflect.DeepEqual(e.Fields, in.Fields) {
+		t.Fatalf("extras lost: %+v", e)
+	}
+
+	// Nothing readable in the rows
+	for _, q := range []string{`SELECT tag FROM entry_tags`, `SELECT name || value FROM entry_fields`} {
+		rows, err := conn.Query(q)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var b []byte
+			if err := rows.Scan(&b); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range []string{"work", "Dev", "API key", "ghp_secret", "github.com"} {
+				if bytes.Contains(b, []byte(s)) {
+					t.Fatalf("%q stored in plaintext", s)
+				}
+			}
+		}
+		rows.Close()
+	}
+
+	// Updates replace the extras
+	e.Favorite, e.Tags, e.Fields = false, nil, e.Fields[1:]
+	if err := UpdateEntry(conn, folderTestVaultID, key, *e, rng); err != nil {
+		t.Fatal(err)
+	}
+	e, err = GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Favorite || len(e.Tags) != 0 || len(e.Fields) != 1 || e.Fields[0].Name != "Login" {
+		t.Fatalf("update not applied: %+v", e)
+	}
+
+	// Purging the entry drops its rows
+	if err := PurgeEntry(conn, "e"); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := conn.QueryRow(`SELECT count(*) FROM entry_fields`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("fields left behind: %d, %v", n, err)
+	}
+}
+
+func TestEntryExtras_Invalid(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	for _, e := range []Entry{
+		{ID: "a", Title: "t", Tags: []string{"a,b"}},
+		{ID: "b", Title: "t", Fields: []CustomField{{Name: "x:y", Kind: FieldText}}},
+		{ID: "c", Title: "t", Fields: []CustomField{{Name: "x", Kind: "secret"}}},
+		{ID: "d", Title: "t", Fields: []CustomField{{Name: "x", Kind: FieldText}, {Name: "X", Kind: FieldText}}},
+	} {
+		if err := CreateEntry(conn, folderTestVaultID, key, e, rng); !errors.Is(err, yerrors.ErrInvalidInput) {
+			t.Fatalf("entry %s accepted: %v", e.ID, err)
+		}
+	}
+}
+
+// The value AAD carries the field name.
+func TestEntryExtras_ValueBoundToName(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	e := Entry{ID: "e", Title: "t", Fields: []CustomField{
+		{Name: "a", Kind: FieldText, Value: "1"},
+		{Name: "b", Kind: FieldText, Value: "2"},
+	}}
+	if err := CreateEntry(conn, folderTestVaultID, key, e, rng); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(`
+		UPDATE entry_fields SET value = (SELECT value FROM entry_fields WHERE position = 0)
+		WHERE position = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetEntry(conn, folderTestVaultID, key, "e"); err == nil {
+		t.Fatal("swapped field value decrypted")
+	}
+}
+
+func TestEntryExtras_RotatedWithEntryKey(t *testing.T) {
+	conn, oldKey := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	in := Entry{ID: "e", Title: "t", Type: TypeAPI, Data: map[string]string{"key": "k", "secret": "s"},
+		Tags: []string{"work"}, Fields: []CustomField{{Name: "pin", Kind: FieldHidden, Value: "1234"}}}
+	if err := CreateEntry(conn, folderTestVaultID, oldKey, in, rng); err != nil {
+		t.Fatal(err)
+	}
+	newKey, err := crypto.RandomSecret(rng, crypto.XChaChaKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newKey.Destroy()
+
+	if _, err := RekeyEntry(conn, folderTestVaultID, oldKey, newKey, "e", true, rng); err != nil {
+		t.Fatal(err)
+	}
+	e, err := GetEntry(conn, folderTestVaultID, newKey, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(e.Tags, in.Tags) || !reflect.DeepEqual(e.Fields, in.Fields) || !reflect.DeepEqual(e.Data, in.Data) {
+		t.Fatalf("extras lost in rotation: %+v", e)
+	}
+}
@@ -0,0 +1,309 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+	yerrors "yap/internal/errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+/*
+* Entry types
+*
+* Every entry has a type. A login uses the fixed entry columns; the other
+* types add structured values, one entry_data row each, named after a
+* field of the type schema below:
+*
+* 	login     -
+* 	note      -                       (the text is in notes)
+* 	card      cardholder, number, expiry, cvv, pin
+* 	identity  full_name, email, phone, address, birth_date, national_id
+* 	ssh_key   private_key, public_key, passphrase
+* 	api       key, secret, endpoint
+*
+* Values are encrypted under the entry key with column "data:" || name.
+* The type and the value names come from this fixed schema and are
+* stored in clear. Values are checked, and normalized where a format has
+* several spellings, before they are written.
+* */
+
+type EntryType string
+
+const (
+	TypeLogin    EntryType = "login"
+	TypeNote     EntryType = "note"
+	TypeCard     EntryType = "card"
+	TypeIdentity EntryType = "identity"
+	TypeSSHKey   EntryType = "ssh_key"
+	TypeAPI      EntryType = "api"
+)
+
+// TypeField describes one structured value of an entry type.
+type TypeField struct {
+	Name      string
+	Label     string
+	Secret    bool // masked unless revealed
+	Required  bool
+	Multiline bool
+	normalize func(string) (string, error)
+}
+
+var entryTypes = []struct {
+	typ    EntryType
+	fields []TypeField
+}{
+	{TypeLogin, nil},
+	{TypeNote, nil},
+	{TypeCard, []TypeField{
+		{Name: "cardholder", Label: "Cardholder"},
+		{Name: "number", Label: "Number", Secret: true, Required: true, normalize: normalizeCardNumber},
+		{Name: "expiry", Label: "Expiry", Required: true, normalize: normalizeExpiry},
+		{Name: "cvv", Label: "CVV", Secret: true, normalize: digits(3, 4)},
+		{Name: "pin", Label: "PIN", Secret: true, normalize: digits(4, 12)},
+	}},
+	{TypeIdentity, []TypeField{
+		{Name: "full_name", Label: "Full name", Required: true},
+		{Name: "email", Label: "Email", normalize: normalizeEmail},
+		{Name: "phone", Label: "Phone"},
+		{Name: "address", Label: "Address", Multiline: true},
+		{Name: "birth_date", Label: "Birth date", normalize: normalizeDate},
+		{Name: "national_id", Label: "National ID", Secret: true},
+	}},
+	{TypeSSHKey, []TypeField{
+		{Name: "private_key", Label: "Private key", Secret: true, Required: true, Multiline: true, normalize: normalizePrivateKey},
+		{Name: "public_key", Label: "Public key", normalize: normalizePublicKey},
+		{Name: "passphrase", Label: "Passphrase", Secret: true},
+	}},
+	{TypeAPI, []TypeField{
+		{Name: "key", Label: "Key", Required: true},
+		{Name: "secret", Label: "Secret", Secret: true},
+		{Name: "endpoint", Label: "Endpoint", normalize: normalizeEndpoint},
+	}},
+}
+
+// EntryTypes lists every entry type.
+func EntryTypes() []EntryType {
+	out := make([]EntryType, len(entryTypes))
+	for i, t := range entryTypes {
+		out[i] = t.typ
+	}
+	return out
+}
+
+// ParseEntryType accepts the name of an entry type.
+func ParseEntryType(s string) (EntryType, error) {
+	for _, t := range entryTypes {
+		if string(t.typ) == s {
+			return t.typ, nil
+		}
+	}
+	names := make([]string, len(entryTypes))
+	for i, t := range entryTypes {
+		names[i] = string(t.typ)
+	}
+	return "", fmt.Errorf("%w: unknown entry type %q (%s)", yerrors.ErrInvalidInput, s, strings.Join(names, ", "))
+}
+
+// TypeFields returns the schema of t, in display order.
+func TypeFields(t EntryType) []TypeField {
+	for _, et := range entryTypes {
+		if et.typ == t {
+			return et.fields
+		}
+	}
+	return nil
+}
+
+// normalizeEntryData checks entry.Data against the schema of its type.
+// An empty type is a login and empty values are dropped.
+func normalizeEntryData(entry *Entry) error {
+	if entry.Type == "" {
+		entry.Type = TypeLogin
+	}
+	if _, err := ParseEntryType(string(entry.Type)); err != nil {
+		return err
+	}
+
+	fields := TypeFields(entry.Type)
+	known := make(map[string]TypeField, len(fields))
+	for _, f := range fields {
+		known[f.Name] = f
+	}
+
+	data := map[string]string{}
+	for name, value := range entry.Data {
+		f, ok := known[name]
+		if !ok {
+			return fmt.Errorf("%w: %s entries have no field %q", yerrors.ErrInvalidInput, entry.Type, name)
+		}
+		if !f.Multiline {
+			value = strings.TrimSpace(value)
+		}
+		if value == "" {
+			continue
+		}
+		if f.normalize != nil {
+			v, err := f.normalize(value)
+			if err != nil {
+				return fmt.Errorf("%w: %s: %w", yerrors.ErrInvalidInput, name, err)
+			}
+			value = v
+		}
+		data[name] = value
+	}
+	for _, f := range fields {
+		if f.Required && data[f.Name] == "" {
+			return fmt.Errorf("%w: %s entries need %s", yerrors.ErrInvalidInput, entry.Type, f.Name)
+		}
+	}
+
+	if entry.Type == TypeSSHKey {
+		if err := checkSSHKeyPair(data); err != nil {
+			return fmt.Errorf("%w: %w", yerrors.ErrInvalidInput, err)
+		}
+	}
+
+	entry.Data = nil
+	if len(data) > 0 {
+		entry.Data = data
+	}
+	return nil
+}
+
+// normalizeCardNumber drops spaces and dashes and checks the length and
+// the Luhn check digit.
+func normalizeCardNumber(s string) (string, error) {
+	n := strings.NewReplacer(" ", "", "-", "").Replace(s)
+	if len(n) < 12 || len(n) > 19 || !allDigits(n) {
+		return "", fmt.Errorf("card number must have 12-19 digits")
+	}
+
+	sum := 0
+	for i := range n {
+		d := int(n[len(n)-1-i] - '0')
+		if i%2 == 1 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	if sum%10 != 0 {
+		return "", fmt.Errorf("card number fails its check digit")
+	}
+	return n, nil
+}
+
+// normalizeExpiry accepts MM/YY or MM/YYYY and returns MM/YYYY.
+func normalizeExpiry(s string) (string, error) {
+	for _, layout := range []string{"01/06", "01/2006", "1/06", "1/2006"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("01/2006"), nil
+		}
+	}
+	return "", fmt.Errorf("expiry must be MM/YY or MM/YYYY")
+}
+
+func digits(min, max int) func(string) (string, error) {
+	return func(s string) (string, error) {
+		if len(s) < min || len(s) > max || !allDigits(s) {
+			return "", fmt.Errorf("must be %d-%d digits", min, max)
+		}
+		return s, nil
+	}
+}
+
+func allDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func normalizeEmail(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil || addr.Name != "" {
+		return "", fmt.Errorf("not an email address")
+	}
+	return addr.Address, nil
+}
+
+// normalizeDate accepts YYYY-MM-DD.
+func normalizeDate(s string) (string, error) {
+	if _, err := time.Parse(time.DateOnly, s); err != nil {
+		return "", fmt.Errorf("date must be YYYY-MM-DD")
+	}
+	return s, nil
+}
+
+func normalizeEndpoint(s string) (string, error) {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("endpoint must be an http or https URL")
+	}
+	return s, nil
+}
+
+// normalizePrivateKey checks for a PEM or OpenSSH private key. Keys
+// protected by a passphrase cannot be parsed further without it.
+func normalizePrivateKey(s string) (string, error) {
+	s = strings.TrimSpace(s) + "\n"
+	if _, err := ssh.ParseRawPrivateKey([]byte(s)); err != nil {
+		var missing *ssh.PassphraseMissingError
+		if !errors.As(err, &missing) {
+			return "", fmt.Errorf("not a private key: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// normalizePublicKey accepts an authorized_keys line.
+func normalizePublicKey(s string) (string, error) {
+	if _, _, _, _, err := ssh.ParseAuthorizedKey([]byte(s)); err != nil {
+		return "", fmt.Errorf("not a public key: %w", err)
+	}
+	return s, nil
+}
+
+// checkSSHKeyPair checks that public_key belongs to private_key, when
+// both are set and the private key can be read.
+func checkSSHKeyPair(data map[string]string) error {
+	if data["public_key"] == "" {
+		return nil
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(data["public_key"]))
+	if err != nil {
+		return err
+	}
+
+	signer, err := ssh.ParsePrivateKey([]byte(data["private_key"]))
+	var missing *ssh.PassphraseMissingError
+	if errors.As(err, &missing) && data["passphrase"] != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(data["private_key"]), []byte(data["passphrase"]))
+	}
+	if err != nil {
+		// Encrypted, and the passphrase on record (if any) does not open it
+		return nil
+	}
+	if ssh.FingerprintSHA256(signer.PublicKey()) != ssh.FingerprintSHA256(pub) {
+		return fmt.Errorf("public_key does not match private_key")
+	}
+	return nil
+}
+
+// SSHFingerprint returns the SHA256 fingerprint of an authorized_keys
+// line, or "" if it does not parse.
+func SSHFingerprint(publicKey string) string {
+	pub, _, _, _, err := ssh.ParseAuthorizedKey([]byte(publicKey))
+	if err != nil {
+		return ""
+	}
+	return ssh.FingerprintSHA256(pub)
+}
@@ -0,0 +1,121 @@
+package db
+
+import (
+	"crypto/ed25519"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func TestNormalizeEntryData(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry Entry
+		want  map[string]string // nil when the entry is rejected
+	}{
+		{"login by default", Entry{}, map[string]string{}},
+		{"card", Entry{Type: TypeCard, Data: map[string]string{"number": "4111-1111-1111-1111", "expiry": "3/30", "pin": " "}},
+			map[string]string{"number": "4111111111111111", "expiry": "03/2030"}},
+		{"card check digit", Entry{Type: TypeCard, Data: map[string]string{"number": "4111111111111112", "expiry": "03/30"}}, nil},
+		{"card without expiry", Entry{Type: TypeCard, Data: map[string]string{"number": "4111111111111111"}}, nil},
+		{"cvv", Entry{Type: TypeCard, Data: map[string]string{"number": "4111111111111111", "expiry": "03/30", "cvv": "12a"}}, nil},
+		{"identity", Entry{Type: TypeIdentity, Data: map[string]string{"full_name": "A B", "email": "a@example.com", "address": "1 Road\nTown\n"}},
+			map[string]string{"full_name": "A B", "email": "a@example.com", "address": "1 Road\nTown\n"}},
+		{"identity email", Entry{Type: TypeIdentity, Data: map[string]string{"full_name": "A", "email": "nope"}}, nil},
+		{"identity birth date", Entry{Type: TypeIdentity, Data: map[string]string{"full_name": "A", "birth_date": "1/2/90"}}, nil},
+		{"api", Entry{Type: TypeAPI, Data: map[string]string{"key": "k", "endpoint": "https://api.example.com/v1"}},
+			map[string]string{"key": "k", "endpoint": "https://api.example.com/v1"}},
+		{"api endpoint", Entry{Type: TypeAPI, Data: map[string]string{"key": "k", "endpoint": "ftp://x"}}, nil},
+		{"field of another type", Entry{Type: TypeAPI, Data: map[string]string{"key": "k", "number": "1"}}, nil},
+		{"login values", Entry{Type: TypeLogin, Data: map[string]string{"key": "k"}}, nil},
+		{"unknown type", Entry{Type: "wallet"}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := tt.entry
+			err := normalizeEntryData(&e)
+			if tt.want == nil {
+				if !errors.Is(err, yerrors.ErrInvalidInput) {
+					t.Fatalf("accepted: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if e.Type == "" || len(e.Data) != len(tt.want) {
+				t.Fatalf("got %q %v, want %v", e.Type, e.Data, tt.want)
+			}
+			for k, v := range tt.want {
+				if e.Data[k] != v {
+					t.Fatalf("%s: got %q, want %q", k, e.Data[k], v)
+				}
+			}
+		})
+	}
+}
+
+func TestNormalizeEntryData_SSHKeyPair(t *testing.T) {
+	newKey := func() (string, string) {
+		_, priv, err := ed25519.GenerateKey(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, err := ssh.MarshalPrivateKey(priv, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		signer, err := ssh.NewSignerFromKey(priv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(pem.EncodeToMemory(block)), string(ssh.MarshalAuthorizedKey(signer.PublicKey()))
+	}
+	priv, pub := newKey()
+	_, otherPub := newKey()
+
+	e := Entry{Type: TypeSSHKey, Data: map[string]string{"private_key": priv, "public_key": pub}}
+	if err := normalizeEntryData(&e); err != nil {
+		t.Fatal(err)
+	}
+	e = Entry{Type: TypeSSHKey, Data: map[string]string{"private_key": priv, "public_key": otherPub}}
+	if err := normalizeEntryData(&e); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("mismatched pair accepted: %v", err)
+	}
+	e = Entry{Type: TypeSSHKey, Data: map[string]string{"private_key": "not a key"}}
+	if err := normalizeEntryData(&e); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("garbage private key accepted: %v", err)
+	}
+}
+
+// The value AAD carries the value name.
+func TestEntryData_ValueBoundToName(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	e := Entry{ID: "e", Title: "t", Type: TypeAPI, Data: map[string]string{"key": "public", "secret": "private"}}
+	if err := CreateEntry(conn, folderTestVaultID, key, e, rng); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Type != TypeAPI || got.Data["secret"] != "private" {
+		t.Fatalf("typed values lost: %+v", got)
+	}
+
+	if _, err := conn.Exec(`
+		UPDATE entry_data SET value = (SELECT value FROM entry_data WHERE name = 'secret')
+		WHERE name = 'key'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetEntry(conn, folderTestVaultID, key, "e"); err == nil {
+		t.Fatal("swapped value decrypted")
+	}
+}
@@ -88,7 +88,7 @@ func DecryptField(
 		return nil, fmt.Errorf("Invalid entry key length")
 	}
 	var env FieldEnvelope
-	if err := encoding.UnmarshalStrict(encrypted, env); err != nil {
+	if err := encoding.UnmarshalStrict(encrypted, &env); err != nil {
 		return nil, fmt.Errorf("field decryption failed: %w", err)
 	}
 
@@ -124,3 +124,56 @@ Uses the same envelope
 Uses Vault Key instead of Entry Key
 Uses column = "entry_key"
 * */
+
+// sealEntryKey encrypts an entry key for the entry_key column.
+func sealEntryKey(
+	entryKey *crypto.Secret,
+	vaultKey *crypto.Secret,
+	vaultID string,
+	entryID string,
+	rng crypto.RNG,
+) ([]byte, error) {
+	return EncryptField(entryKey.Bytes(), vaultKey.Bytes(), vaultID, entryID, "entry_key", rng)
+}
+
+// openEntryKey decrypts the entry_key column. The caller must Destroy
+// the returned key.
+func openEntryKey(
+	encrypted []byte,
+	vaultKey *crypto.Secret,
+	vaultID string,
+	entryID string,
+) (*crypto.Secret, error) {
+	entryKey, err := DecryptField(encrypted, vaultKey.Bytes(), vaultID, entryID, "entry_key")
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewSecretFrom(entryKey)
+}
+
+// sealFolderKey encrypts a folder key for the folder_key column. It is
+// the folder counterpart of sealEntryKey, with the folder id in the AAD.
+func sealFolderKey(
+	folderKey *crypto.Secret,
+	vaultKey *crypto.Secret,
+	vaultID string,
+	folderID string,
+	rng crypto.RNG,
+) ([]byte, error) {
+	return EncryptField(folderKey.Bytes(), vaultKey.Bytes(), vaultID, folderID, "folder_key", rng)
+}
+
+// openFolderKey decrypts the folder_key column. The caller must Destroy
+// the returned key.
+func openFolderKey(
+	encrypted []byte,
+	vaultKey *crypto.Secret,
+	vaultID string,
+	folderID string,
+) (*crypto.Secret, error) {
+	folderKey, err := DecryptField(encrypted, vaultKey.Bytes(), vaultID, folderID, "folder_key")
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewSecretFrom(folderKey)
+}
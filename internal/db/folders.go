@@ -0,0 +1,425 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+	"yap/internal/keys"
+)
+
+/*
+* Folders
+*
+* Folders form a tree: parent_id is NULL at the root. Each folder has its
+* own folder key, wrapped under the Vault Key exactly like an entry key
+* (column "folder_key"), and its name is encrypted under that key with
+* column "name". The folder id takes the place of the entry id in the AAD.
+*
+* Names are encrypted, so SQLite cannot enforce their uniqueness; sibling
+* names are checked here after decryption. A name may not contain "/",
+* which separates folders in a path.
+* */
+
+type Folder struct {
+	ID        string
+	ParentID  string // empty at the root
+	Name      string
+	CreatedAt int64
+	UpdatedAt int64
+}
+
+const FolderPathSeparator = "/"
+
+func validateFolderName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("%w: folder name cannot be empty", yerrors.ErrInvalidInput)
+	case strings.Contains(name, FolderPathSeparator):
+		return fmt.Errorf("%w: folder name cannot contain %q", yerrors.ErrInvalidInput, FolderPathSeparator)
+	}
+	return nil
+}
+
+func CreateFolder(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	folder Folder,
+	rng crypto.RNG,
+) error {
+	if folder.ID == "" {
+		return fmt.Errorf("folder id required")
+	}
+	if err := validateFolderName(folder.Name); err != nil {
+		return err
+	}
+	if err := checkFolderParent(db, folder.ParentID); err != nil {
+		return err
+	}
+	if err := checkSiblingName(db, vaultID, vaultKey, folder); err != nil {
+		return err
+	}
+
+	if folder.CreatedAt == 0 {
+		now := time.Now().Unix()
+		folder.CreatedAt = now
+		folder.UpdatedAt = now
+	}
+
+	folderKey, err := keys.GenerateEntryKey(rng)
+	if err != nil {
+		return fmt.Errorf("folder key generation failed: %w", err)
+	}
+	defer folderKey.Destroy()
+
+	encFolderKey, err := sealFolderKey(folderKey, vaultKey, vaultID, folder.ID, rng)
+	if err != nil {
+		return err
+	}
+	name, err := EncryptField([]byte(folder.Name), folderKey.Bytes(), vaultID, folder.ID, "name", rng)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO folders (
+			id, parent_id, name, created_at, updated_at, folder_key
+		) VALUES (?, ?, ?, ?, ?, ?)`,
+		folder.ID,
+		nullableID(folder.ParentID),
+		name,
+		folder.CreatedAt,
+		folder.UpdatedAt,
+		encFolderKey,
+	)
+	return err
+}
+
+func GetFolder(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	folderID string,
+) (*Folder, error) {
+	var (
+		parentID              sql.NullString
+		nameEnc, folderKeyEnc []byte
+		createdAt, updatedAt  int64
+	)
+	if err := db.QueryRow(`
+		SELECT parent_id, name, created_at, updated_at, folder_key
+		FROM folders WHERE id = ?`,
+		folderID,
+	).Scan(&parentID, &nameEnc, &createdAt, &updatedAt, &folderKeyEnc); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: folder %s", yerrors.ErrNotFound, folderID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	folderKey, err := openFolderKey(folderKeyEnc, vaultKey, vaultID, folderID)
+	if err != nil {
+		return nil, err
+	}
+	defer folderKey.Destroy()
+
+	name, err := DecryptField(nameEnc, folderKey.Bytes(), vaultID, folderID, "name")
+	if err != nil {
+		return nil, err
+	}
+
+	return &Folder{
+		ID:        folderID,
+		ParentID:  parentID.String,
+		Name:      string(name),
+		CreatedAt: createdAt,
+		UpdatedAt: updatedAt,
+	}, nil
+}
+
+// ListFolders decrypts every folder, ordered by id.
+func ListFolders(db *sql.DB, vaultID string, vaultKey *crypto.Secret) ([]Folder, error) {
+	ids, err := ListFolderIDs(db)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make([]Folder, 0, len(ids))
+	for _, id := range ids {
+		f, err := GetFolder(db, vaultID, vaultKey, id)
+		if err != nil {
+			return nil, err
+		}
+		folders = append(folders, *f)
+	}
+	return folders, nil
+}
+
+// RenameFolder re-encrypts the folder name under its existing key.
+func RenameFolder(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	folderID string,
+	name string,
+	rng crypto.RNG,
+) error {
+	if err := validateFolderName(name); err != nil {
+		return err
+	}
+	folder, err := GetFolder(db, vaultID, vaultKey, folderID)
+	if err != nil {
+		return err
+	}
+	folder.Name = name
+	if err := checkSiblingName(db, vaultID, vaultKey, *folder); err != nil {
+		return err
+	}
+
+	var folderKeyEnc []byte
+	if err := db.QueryRow(`SELECT folder_key FROM folders WHERE id = ?`, folderID).Scan(&folderKeyEnc); err != nil {
+		return err
+	}
+	folderKey, err := openFolderKey(folderKeyEnc, vaultKey, vaultID, folderID)
+	if err != nil {
+		return err
+	}
+	defer folderKey.Destroy()
+
+	nameEnc, err := EncryptField([]byte(name), folderKey.Bytes(), vaultID, folderID, "name", rng)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE folders SET name = ?, updated_at = ? WHERE id = ?`,
+		nameEnc, time.Now().Unix(), folderID)
+	return err
+}
+
+// MoveFolder re-parents a folder. A folder cannot move below itself.
+func MoveFolder(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	folderID string,
+	parentID string,
+) error {
+	folder, err := GetFolder(db, vaultID, vaultKey, folderID)
+	if err != nil {
+		return err
+	}
+	if err := checkFolderParent(db, parentID); err != nil {
+		return err
+	}
+
+	// Walk up from the new parent; meeting the folder would make a cycle
+	for p := parentID; p != ""; {
+		if p == folderID {
+			return fmt.Errorf("%w: cannot move a folder into itself", yerrors.ErrInvalidInput)
+		}
+		var next sql.NullString
+		if err := db.QueryRow(`SELECT parent_id FROM folders WHERE id = ?`, p).Scan(&next); err != nil {
+			return err
+		}
+		p = next.String
+	}
+
+	folder.ParentID = parentID
+	if err := checkSiblingName(db, vaultID, vaultKey, *folder); err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`UPDATE folders SET parent_id = ?, updated_at = ? WHERE id = ?`,
+		nullableID(parentID), time.Now().Unix(), folderID)
+	return err
+}
+
+// DeleteFolder removes a folder without live entries or subfolders.
+func DeleteFolder(db *sql.DB, folderID string) error {
+	var children, entries int
+	if err := db.QueryRow(`SELECT count(*) FROM folders WHERE parent_id = ?`, folderID).Scan(&children); err != nil {
+		return err
+	}
+	if err := db.QueryRow(
+		`SELECT count(*) FROM entries WHERE folder_id = ? AND deleted_at IS NULL`,
+		folderID,
+	).Scan(&entries); err != nil {
+		return err
+	}
+	if children > 0 || entries > 0 {
+		return fmt.Errorf("%w: folder %s is not empty (%d folders, %d entries)",
+			yerrors.ErrInvalidInput, folderID, children, entries)
+	}
+
+	// Trashed entries are restored at the root instead
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE entries SET folder_id = NULL WHERE folder_id = ?`, folderID); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM folders WHERE id = ?`, folderID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: folder %s", yerrors.ErrNotFound, folderID)
+	}
+	return tx.Commit()
+}
+
+// ListFolderIDs returns every folder id, ordered by id.
+func ListFolderIDs(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`SELECT id FROM folders ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// checkFolderParent checks that a parent (or entry folder) exists. The
+// root, "", always does.
+func checkFolderParent(db *sql.DB, folderID string) error {
+	if folderID == "" {
+		return nil
+	}
+	var n int
+	if err := db.QueryRow(`SELECT count(*) FROM folders WHERE id = ?`, folderID).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: folder %s", yerrors.ErrNotFound, folderID)
+	}
+	return nil
+}
+
+// checkSiblingName rejects a name already used by another folder with
+// the same parent, compared case-insensitively.
+func checkSiblingName(db *sql.DB, vaultID string, vaultKey *crypto.Secret, folder Folder) error {
+	rows, err := db.Query(`
+		SELECT id FROM folders
+		WHERE parent_id IS ? AND id != ?`,
+		nullableID(folder.ParentID), folder.ID,
+	)
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		sibling, err := GetFolder(db, vaultID, vaultKey, id)
+		if err != nil {
+			return err
+		}
+		if strings.EqualFold(sibling.Name, folder.Name) {
+			return fmt.Errorf("%w: folder %q already exists", yerrors.ErrInvalidInput, folder.Name)
+		}
+	}
+	return nil
+}
+
+// nullableID stores the root as NULL.
+func nullableID(id string) any {
+	if id == "" {
+		return nil
+	}
+	return id
+}
+
+/*
+* RekeyFolder moves one folder key from oldVaultKey to newVaultKey, and
+* with rotateFolderKey replaces it and re-encrypts the name. Idempotent
+* in the same way as RekeyEntry.
+* */
+func RekeyFolder(
+	db *sql.DB,
+	vaultID string,
+	oldVaultKey *crypto.Secret,
+	newVaultKey *crypto.Secret,
+	folderID string,
+	rotateFolderKey bool,
+	rng crypto.RNG,
+) (rekeyed bool, err error) {
+	var folderKeyEnc, nameEnc []byte
+	if err := db.QueryRow(
+		`SELECT folder_key, name FROM folders WHERE id = ?`,
+		folderID,
+	).Scan(&folderKeyEnc, &nameEnc); err != nil {
+		return false, err
+	}
+
+	// Already under the new key
+	if k, err := openFolderKey(folderKeyEnc, newVaultKey, vaultID, folderID); err == nil {
+		k.Destroy()
+		return false, nil
+	}
+
+	folderKey, err := openFolderKey(folderKeyEnc, oldVaultKey, vaultID, folderID)
+	if err != nil {
+		return false, fmt.Errorf("folder %s: %w", folderID, err)
+	}
+	defer folderKey.Destroy()
+
+	if !rotateFolderKey {
+		encFolderKey, err := sealFolderKey(folderKey, newVaultKey, vaultID, folderID, rng)
+		if err != nil {
+			return false, err
+		}
+		_, err = db.Exec(`UPDATE folders SET folder_key = ? WHERE id = ?`, encFolderKey, folderID)
+		return err == nil, err
+	}
+
+	newFolderKey, err := keys.GenerateEntryKey(rng)
+	if err != nil {
+		return false, fmt.Errorf("folder key generation failed: %w", err)
+	}
+	defer newFolderKey.Destroy()
+
+	encFolderKey, err := sealFolderKey(newFolderKey, newVaultKey, vaultID, folderID, rng)
+	if err != nil {
+		return false, err
+	}
+	name, err := DecryptField(nameEnc, folderKey.Bytes(), vaultID, folderID, "name")
+	if err != nil {
+		return false, err
+	}
+	reenc, err := EncryptField(name, newFolderKey.Bytes(), vaultID, folderID, "name", rng)
+	crypto.Wipe(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = db.Exec(`UPDATE folders SET name = ?, folder_key = ? WHERE id = ?`,
+		reenc, encFolderKey, folderID)
+	return err == nil, err
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"testing"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+const folderTestVaultID = "vault-id"
+
+func newFolderTestDB(t *testing.T) (*sql.DB, *crypto.Secret) {
+	t.Helper()
+
+	conn, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	key, err := crypto.RandomSecret(crypto.SecureRNG{}, crypto.XChaChaKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(key.Destroy)
+	return conn, key
+}
+
+func TestFolders_Tree(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	mustCreate := func(id, parent, name string) {
+		t.Helper()
+		if err := CreateFolder(conn, folderTestVaultID, key, Folder{ID: id, ParentID: parent, Name: name}, rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mustCreate("work", "", "Work")
+	mustCreate("mail", "work", "Email")
+
+	f, err := GetFolder(conn, folderTestVaultID, key, "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Email" || f.ParentID != "work" {
+		t.Fatalf("unexpected folder %+v", f)
+	}
+
+	// Names are not stored in clear
+	var nameEnc []byte
+	if err := conn.QueryRow(`SELECT name FROM folders WHERE id = 'mail'`).Scan(&nameEnc); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(nameEnc, []byte("Email")) {
+		t.Fatal("folder name stored in plaintext")
+	}
+
+	// Sibling names are unique, case-insensitively
+	err = CreateFolder(conn, folderTestVaultID, key, Folder{ID: "dup", ParentID: "work", Name: "email"}, rng)
+	if !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("duplicate sibling accepted: %v", err)
+	}
+	err = CreateFolder(conn, folderTestVaultID, key, Folder{ID: "slash", Name: "a/b"}, rng)
+	if !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("name with a separator accepted: %v", err)
+	}
+
+	if err := MoveFolder(conn, folderTestVaultID, key, "work", "mail"); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("cycle accepted: %v", err)
+	}
+	if err := RenameFolder(conn, folderTestVaultID, key, "mail", "Mail", rng); err != nil {
+		t.Fatal(err)
+	}
+	if err := MoveFolder(conn, folderTestVaultID, key, "mail", ""); err != nil {
+		t.Fatal(err)
+	}
+	f, err = GetFolder(conn, folderTestVaultID, key, "mail")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Name != "Mail" || f.ParentID != "" {
+		t.Fatalf("rename or move lost: %+v", f)
+	}
+
+	// Entries pin their folder
+	if err := CreateEntry(conn, folderTestVaultID, key, Entry{ID: "e", Title: "t", FolderID: "mail"}, rng); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFolder(conn, "mail"); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("non-empty folder deleted: %v", err)
+	}
+	if err := MoveEntry(conn, "e", "missing"); !errors.Is(err, yerrors.ErrNotFound) {
+		t.Fatalf("entry moved to a missing folder: %v", err)
+	}
+	if err := MoveEntry(conn, "e", ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFolder(conn, "mail"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// The AAD binds a folder name to its folder.
+func TestFolders_NameBoundToFolder(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	for _, id := range []string{"a", "b"} {
+		if err := CreateFolder(conn, folderTestVaultID, key, Folder{ID: id, Name: id}, rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Exec(`UPDATE folders SET name = (SELECT name FROM folders WHERE id = 'a') WHERE id = 'b'`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetFolder(conn, folderTestVaultID, key, "b"); err == nil {
+		t.Fatal("swapped folder name decrypted")
+	}
+}
@@ -0,0 +1,313 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+/*
+* Password history
+*
+* UpdateEntry keeps the password it replaces in password_history, in the
+* same transaction, encrypted under the entry key:
+*
+* 	password_history.password  column "password_history:" || seq
+*
+* seq grows per entry, so a row copied onto another position fails to
+* decrypt. changed_at, when the password was replaced, is in clear.
+*
+* Each entry keeps the newest meta.password_history_limit passwords,
+* DefaultHistoryLimit when unset; 0 turns history off. Lowering the
+* limit trims every entry right away.
+*
+* Merging two copies of an entry merges their histories: the union of
+* both, by password and changed_at, ordered by changed_at and numbered
+* again from 1.
+* */
+
+const (
+	DefaultHistoryLimit = 10
+	historyLimitKey     = "password_history_limit"
+)
+
+// PasswordVersion is a password an entry used to have.
+type PasswordVersion struct {
+	Seq       int64
+	Password  string
+	ChangedAt int64 // when it was replaced
+}
+
+// GetHistoryLimit returns how many old passwords each entry keeps.
+func GetHistoryLimit(db *sql.DB) (int, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM meta WHERE key = ?`, historyLimitKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return DefaultHistoryLimit, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit < 0 {
+		return 0, fmt.Errorf("%w: invalid %s %q", yerrors.ErrCorruptData, historyLimitKey, value)
+	}
+	return limit, nil
+}
+
+// SetHistoryLimit changes the retention limit and trims every entry to it.
+func SetHistoryLimit(db *sql.DB, limit int) error {
+	if limit < 0 {
+		return fmt.Errorf("%w: history limit must not be negative", yerrors.ErrInvalidInput)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`INSERT INTO meta (key, value) VALUES (?, ?)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value`,
+		historyLimitKey, strconv.Itoa(limit),
+	); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM password_history
+		WHERE (SELECT count(*) FROM password_history AS newer
+		       WHERE newer.entry_id = password_history.entry_id
+		         AND newer.seq > password_history.seq) >= ?`,
+		limit,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// recordPassword appends an old password of an entry to its history and
+// trims the history to limit.
+func recordPassword(
+	tx *sql.Tx,
+	vaultID string,
+	entryKey *crypto.Secret,
+	entryID string,
+	password string,
+	limit int,
+	rng crypto.RNG,
+) error {
+	if limit == 0 {
+		return nil
+	}
+
+	var seq int64
+	if err := tx.QueryRow(
+		`SELECT coalesce(max(seq), 0) + 1 FROM password_history WHERE entry_id = ?`,
+		entryID,
+	).Scan(&seq); err != nil {
+		return err
+	}
+	enc, err := EncryptField([]byte(password), entryKey.Bytes(), vaultID, entryID, historyColumn(seq), rng)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO password_history (entry_id, seq, changed_at, password) VALUES (?, ?, ?, ?)`,
+		entryID, seq, time.Now().Unix(), enc,
+	); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(
+		`DELETE FROM password_history WHERE entry_id = ? AND seq <= ?`,
+		entryID, seq-int64(limit),
+	)
+	return err
+}
+
+// mergeHistory merges other, the history of the same entry in another
+// copy of the vault, into the history of entryID. replaced, the password
+// the merge overwrites, is kept too unless either side already has it.
+func mergeHistory(
+	tx *sql.Tx,
+	vaultID string,
+	entryKey *crypto.Secret,
+	entryID string,
+	other []PasswordVersion,
+	replaced string,
+	limit int,
+	rng crypto.RNG,
+) error {
+	encrypted, err := loadHistory(tx, entryID)
+	if err != nil {
+		return err
+	}
+	own, err := decryptHistory(encrypted, entryKey, vaultID, entryID)
+	if err != nil {
+		return err
+	}
+
+	type version struct {
+		password  string
+		changedAt int64
+	}
+	seen := map[version]bool{}
+	passwords := map[string]bool{}
+	var merged []PasswordVersion
+	for _, v := range append(own, other...) {
+		passwords[v.Password] = true
+		if k := (version{v.Password, v.ChangedAt}); !seen[k] {
+			seen[k] = true
+			merged = append(merged, v)
+		}
+	}
+	if replaced != "" && !passwords[replaced] {
+		merged = append(merged, PasswordVersion{Password: replaced, ChangedAt: time.Now().Unix()})
+	}
+
+	sort.SliceStable(merged, func(i, j int) bool { return merged[i].ChangedAt < merged[j].ChangedAt })
+	if len(merged) > limit {
+		merged = merged[len(merged)-limit:]
+	}
+	for i := range merged {
+		merged[i].Seq = int64(i + 1)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM password_history WHERE entry_id = ?`, entryID); err != nil {
+		return err
+	}
+	return insertHistory(tx, vaultID, entryKey, entryID, merged, rng)
+}
+
+func historyColumn(seq int64) string {
+	return "password_history:" + strconv.FormatInt(seq, 10)
+}
+
+// encryptedVersion is a password_history row before decryption.
+type encryptedVersion struct {
+	seq       int64
+	changedAt int64
+	password  []byte
+}
+
+func loadHistory(q querier, entryID string) ([]encryptedVersion, error) {
+	rows, err := q.Query(
+		`SELECT seq, changed_at, password FROM password_history WHERE entry_id = ? ORDER BY seq DESC`,
+		entryID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var out []encryptedVersion
+	for rows.Next() {
+		var v encryptedVersion
+		if err := rows.Scan(&v.seq, &v.changedAt, &v.password); err != nil {
+			return nil, err
+		}
+		out = append(out, v)
+	}
+	return out, rows.Err()
+}
+
+func decryptHistory(
+	versions []encryptedVersion,
+	entryKey *crypto.Secret,
+	vaultID string,
+	entryID string,
+) ([]PasswordVersion, error) {
+	out := make([]PasswordVersion, 0, len(versions))
+	for _, v := range versions {
+		password, err := DecryptField(v.password, entryKey.Bytes(), vaultID, entryID, historyColumn(v.seq))
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, PasswordVersion{Seq: v.seq, Password: string(password), ChangedAt: v.changedAt})
+	}
+	return out, nil
+}
+
+// PasswordHistory returns the old passwords of an entry, newest first.
+func PasswordHistory(
+	db *sql.DB,
+	vaultID string,
+	vaultKey *crypto.Secret,
+	entryID string,
+) ([]PasswordVersion, error) {
+	var entryKeyEnc []byte
+	if err := db.QueryRow(
+		`SELECT entry_key FROM entries WHERE id = ?`,
+		entryID,
+	).Scan(&entryKeyEnc); err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: entry %s", yerrors.ErrNotFound, entryID)
+	} else if err != nil {
+		return nil, err
+	}
+
+	entryKey, err := openEntryKey(entryKeyEnc, vaultKey, vaultID, entryID)
+	if err != nil {
+		return nil, err
+	}
+	defer entryKey.Destroy()
+
+	versions, err := loadHistory(db, entryID)
+	if err != nil {
+		return nil, err
+	}
+	return decryptHistory(versions, entryKey, vaultID, entryID)
+}
+
+// insertHistory adds versions, with their seq and changed_at, to the
+// history of a new entry.
+func insertHistory(
+	tx *sql.Tx,
+	vaultID string,
+	entryKey *crypto.Secret,
+	entryID string,
+	versions []PasswordVersion,
+	rng crypto.RNG,
+) error {
+	for _, v := range versions {
+		enc, err := EncryptField([]byte(v.Password), entryKey.Bytes(), vaultID, entryID, historyColumn(v.Seq), rng)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`INSERT INTO password_history (entry_id, seq, changed_at, password) VALUES (?, ?, ?, ?)`,
+			entryID, v.Seq, v.ChangedAt, enc,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeHistory re-encrypts versions under entryKey, for key rotation.
+func writeHistory(
+	tx *sql.Tx,
+	vaultID string,
+	entryKey *crypto.Secret,
+	entryID string,
+	versions []PasswordVersion,
+	rng crypto.RNG,
+) error {
+	for _, v := range versions {
+		enc, err := EncryptField([]byte(v.Password), entryKey.Bytes(), vaultID, entryID, historyColumn(v.Seq), rng)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(
+			`UPDATE password_history SET password = ? WHERE entry_id = ? AND seq = ?`,
+			enc, entryID, v.Seq,
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package db
+
+import (
+	"bytes"
+	"testing"
+	"yap/internal/crypto"
+)
+
+func TestPasswordHistory(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	e := Entry{ID: "e", Title: "t", Password: "p0"}
+	if err := CreateEntry(conn, folderTestVaultID, key, e, rng); err != nil {
+		t.Fatal(err)
+	}
+	update := func(password string) {
+		t.Helper()
+		e.Password = password
+		if err := UpdateEntry(conn, folderTestVaultID, key, e, rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+	passwords := func() []string {
+		t.Helper()
+		versions, err := PasswordHistory(conn, folderTestVaultID, key, "e")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var out []string
+		for _, v := range versions {
+			out = append(out, v.Password)
+		}
+		return out
+	}
+
+	update("p1")
+	e.Title = "renamed" // not a password change
+	update("p1")
+	update("p2")
+	if got := passwords(); len(got) != 2 || got[0] != "p1" || got[1] != "p0" {
+		t.Fatalf("unexpected history %v", got)
+	}
+
+	var enc []byte
+	if err := conn.QueryRow(`SELECT password FROM password_history WHERE seq = 1`).Scan(&enc); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(enc, []byte("p0")) {
+		t.Fatal("old password stored in plaintext")
+	}
+
+	// Old passwords follow a rotated entry key
+	newKey, err := crypto.RandomSecret(rng, crypto.XChaChaKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer newKey.Destroy()
+	if _, err := RekeyEntry(conn, folderTestVaultID, key, newKey, "e", true, rng); err != nil {
+		t.Fatal(err)
+	}
+	key = newKey
+	if got := passwords(); len(got) != 2 {
+		t.Fatalf("history lost in rotation: %v", got)
+	}
+
+	// Retention
+	if err := SetHistoryLimit(conn, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := passwords(); len(got) != 1 || got[0] != "p1" {
+		t.Fatalf("history not trimmed: %v", got)
+	}
+	update("p3")
+	if got := passwords(); len(got) != 1 || got[0] != "p2" {
+		t.Fatalf("history not trimmed on update: %v", got)
+	}
+	if err := SetHistoryLimit(conn, 0); err != nil {
+		t.Fatal(err)
+	}
+	update("p4")
+	if got := passwords(); len(got) != 0 {
+		t.Fatalf("history kept with limit 0: %v", got)
+	}
+}
+
+// The AAD binds an old password to its position.
+func TestPasswordHistory_BoundToSeq(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	e := Entry{ID: "e", Title: "t", Password: "p0"}
+	if err := CreateEntry(conn, folderTestVaultID, key, e, rng); err != nil {
+		t.Fatal(err)
+	}
+	for _, pw := range []string{"p1", "p2"} {
+		e.Password = pw
+		if err := UpdateEntry(conn, folderTestVaultID, key, e, rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := conn.Exec(`
+		UPDATE password_history SET password = (SELECT password FROM password_history WHERE seq = 1)
+		WHERE seq = 2`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PasswordHistory(conn, folderTestVaultID, key, "e"); err == nil {
+		t.Fatal("moved old password decrypted")
+	}
+}
+
+// Imported entries keep their timestamps and the newest old passwords
+// the limit allows.
+func TestImportEntry_KeepsHistory(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	if err := SetHistoryLimit(conn, 2); err != nil {
+		t.Fatal(err)
+	}
+	history := []PasswordVersion{
+		{Seq: 5, Password: "p4", ChangedAt: 500},
+		{Seq: 4, Password: "p3", ChangedAt: 400},
+		{Seq: 3, Password: "p2", ChangedAt: 300},
+	}
+	e := Entry{ID: "e", Title: "t", Password: "p5", CreatedAt: 100, UpdatedAt: 500}
+	if err := ImportEntry(conn, folderTestVaultID, key, e, history, rng); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.CreatedAt != 100 || got.UpdatedAt != 500 {
+		t.Fatalf("timestamps not kept: %+v", got)
+	}
+	versions, err := PasswordHistory(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 || versions[0] != history[0] || versions[1] != history[1] {
+		t.Fatalf("unexpected imported history %+v", versions)
+	}
+
+	// Later changes continue the sequence
+	got.Password = "p6"
+	if err := UpdateEntry(conn, folderTestVaultID, key, *got, rng); err != nil {
+		t.Fatal(err)
+	}
+	if versions, err = PasswordHistory(conn, folderTestVaultID, key, "e"); err != nil {
+		t.Fatal(err)
+	}
+	if versions[0].Seq != 6 || versions[0].Password != "p5" {
+		t.Fatalf("history not continued: %+v", versions)
+	}
+}
+
+// Applying a merged entry keeps the old passwords of both copies.
+func TestApplyEntry_MergesHistory(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	own := []PasswordVersion{
+		{Seq: 2, Password: "local1", ChangedAt: 300},
+		{Seq: 1, Password: "p0", ChangedAt: 100},
+	}
+	e := Entry{ID: "e", Title: "t", Password: "local2", UpdatedAt: 300}
+	if err := ImportEntry(conn, folderTestVaultID, key, e, own, rng); err != nil {
+		t.Fatal(err)
+	}
+
+	other := []PasswordVersion{
+		{Seq: 3, Password: "remote2", ChangedAt: 400},
+		{Seq: 2, Password: "local2", ChangedAt: 200}, // the side being replaced
+		{Seq: 1, Password: "p0", ChangedAt: 100},
+	}
+	e.Password, e.UpdatedAt = "remote3", 400
+	if err := ApplyEntry(conn, folderTestVaultID, key, e, other, rng); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := GetEntry(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.UpdatedAt != 400 {
+		t.Fatalf("updated_at not kept: %d", got.UpdatedAt)
+	}
+	versions, err := PasswordHistory(conn, folderTestVaultID, key, "e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PasswordVersion{
+		{Seq: 4, Password: "remote2", ChangedAt: 400},
+		{Seq: 3, Password: "local1", ChangedAt: 300},
+		{Seq: 2, Password: "local2", ChangedAt: 200},
+		{Seq: 1, Password: "p0", ChangedAt: 100},
+	}
+	if len(versions) != len(want) {
+		t.Fatalf("unexpected merged history %+v", versions)
+	}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("unexpected merged history %+v", versions)
+		}
+	}
+}
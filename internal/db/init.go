@@ -1,31 +1,145 @@
 package db
 
 import (
-	_ "embed"
+	"bytes"
+	"context"
 	"database/sql"
+	"database/sql/driver"
+	_ "embed"
 	"fmt"
+
+	"github.com/mattn/go-sqlite3"
 )
 
+// SchemaVersion is the schema version written by schema.sql and reached
+// by the last migration.
+const SchemaVersion = 7
+
+/*
+* In-memory database
+*
+* The decrypted database never touches the filesystem. Each vault gets a
+* single SQLite connection whose main database is loaded from the
+* decrypted payload, and serialized back on commit. Temporary tables and
+* indices are kept in memory too.
+*
+* database/sql must never open a second connection: it would be a new,
+* empty database. The connector refuses to connect twice.
+* */
+
 //go:embed schema.sql
 var schemaSQL string
 
-func Init(dbPath string) (*sql.DB, error) {
-	if dbPath == "" {
-		return nil, fmt.Errorf("db path must not be empty")
+// memConnector opens the one in-memory connection of a vault database.
+type memConnector struct {
+	image []byte
+	used  bool
+}
+
+func (c *memConnector) Connect(context.Context) (driver.Conn, error) {
+	if c.used {
+		return nil, fmt.Errorf("in-memory database connection was lost")
 	}
+	c.used = true
 
-	db, err := sql.Open("sqlite3", dbPath)
+	conn, err := c.Driver().Open(":memory:")
 	if err != nil {
-		return nil, fmt.Errorf("sqlite open failed: %w", err)
+		return nil, err
+	}
+	sc := conn.(*sqlite3.SQLiteConn)
+
+	if c.image != nil {
+		if err := loadImage(sc, c.image); err != nil {
+			sc.Close()
+			return nil, err
+		}
+		c.image = nil
+	}
+	if _, err := sc.Exec(`PRAGMA foreign_keys = ON; PRAGMA temp_store = MEMORY`, nil); err != nil {
+		sc.Close()
+		return nil, err
+	}
+	return sc, nil
+}
+
+func (c *memConnector) Driver() driver.Driver {
+	return &sqlite3.SQLiteDriver{}
+}
+
+// loadImage copies image into the main database of dst.
+//
+// A deserialized database is fixed to the size of its image (the driver
+// does not let it be resized), so the image is deserialized into a
+// scratch connection and copied page by page into dst, an ordinary
+// in-memory database that grows as needed.
+func loadImage(dst *sqlite3.SQLiteConn, image []byte) error {
+	// The destination of an in-memory backup must use the source page size
+	if len(image) >= 18 {
+		pageSize := int(image[16])<<8 | int(image[17])
+		if pageSize == 1 {
+			pageSize = 65536
+		}
+		if _, err := dst.Exec(fmt.Sprintf("PRAGMA page_size = %d", pageSize), nil); err != nil {
+			return err
+		}
 	}
 
+	conn, err := (&sqlite3.SQLiteDriver{}).Open(":memory:")
+	if err != nil {
+		return err
+	}
+	src := conn.(*sqlite3.SQLiteConn)
+	defer src.Close()
+
+	if err := src.Deserialize(image, "main"); err != nil {
+		return err
+	}
+	backup, err := dst.Backup("main", src, "main")
+	if err != nil {
+		return err
+	}
+	if _, err := backup.Step(-1); err != nil {
+		backup.Finish()
+		return err
+	}
+	return backup.Finish()
+}
+
+// Open loads a database image into memory and migrates it to
+// SchemaVersion. A nil image creates an empty database.
+func Open(image []byte) (*sql.DB, error) {
+	if image != nil {
+		image = bytes.Clone(image)
+		// Images written from a WAL database say so in their header;
+		// the in-memory VFS cannot open those, so mark them rollback.
+		if len(image) >= 20 && image[18] == 2 && image[19] == 2 {
+			image[18], image[19] = 1, 1
+		}
+	}
+
+	db := sql.OpenDB(&memConnector{image: image})
+	db.SetMaxOpenConns(1)
+	db.SetMaxIdleConns(1)
+	db.SetConnMaxLifetime(0)
+	db.SetConnMaxIdleTime(0)
+
 	if err := db.Ping(); err != nil {
 		db.Close()
-		return nil, fmt.Errorf("sqlite ping failed: %w", err)
+		return nil, fmt.Errorf("sqlite open failed: %w", err)
+	}
+
+	// Existing databases are migrated; only new ones get schema.sql
+	if image != nil {
+		if err := migrate(db); err != nil {
+			db.Close()
+			return nil, err
+		}
+		return db, nil
 	}
 
 	tx, err := db.Begin()
 	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("schema tx begin failed: %w", err)
 	}
 
@@ -43,6 +157,25 @@ func Init(dbPath string) (*sql.DB, error) {
 	return db, nil
 }
 
+// Serialize returns the database image of an Open database.
+func Serialize(db *sql.DB) ([]byte, error) {
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var image []byte
+	err = conn.Raw(func(dc any) error {
+		image, err = dc.(*sqlite3.SQLiteConn).Serialize("main")
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sqlite serialize failed: %w", err)
+	}
+	return image, nil
+}
+
 // GetMeta returns a value from the meta table.
 func GetMeta(db *sql.DB, key string) (string, error) {
 	var value string
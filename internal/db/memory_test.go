@@ -0,0 +1,95 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOpen_RoundTripsImage(t *testing.T) {
+	conn, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMeta(conn, "probe", "kept"); err != nil {
+		t.Fatal(err)
+	}
+	image, err := Serialize(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	reopened, err := Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	if v, err := GetMeta(reopened, "probe"); err != nil || v != "kept" {
+		t.Fatalf("image lost data: %q, %v", v, err)
+	}
+}
+
+// Vaults written before the database moved into memory hold images of a
+// WAL-mode file database.
+func TestOpen_LoadsWALImage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "legacy.db")
+	file, err := sql.Open("sqlite3", path+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := file.Exec(schemaSQL); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMeta(file, "probe", "legacy"); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	image, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if image[18] != 2 {
+		t.Fatal("expected a WAL-mode image")
+	}
+
+	conn, err := Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if v, err := GetMeta(conn, "probe"); err != nil || v != "legacy" {
+		t.Fatalf("legacy image unreadable: %q, %v", v, err)
+	}
+	if image[18] != 2 {
+		t.Fatal("Open modified the caller's image")
+	}
+}
+
+// A loaded image is only the pages it had; the database must still grow.
+func TestOpen_LoadedImageGrows(t *testing.T) {
+	conn, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	image, err := Serialize(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	reopened, err := Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	big := make([]byte, 1<<20)
+	if err := SetMeta(reopened, "probe", string(big)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reopened.Exec(`CREATE TABLE grown (id TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+}
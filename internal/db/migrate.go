@@ -0,0 +1,196 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	yerrors "yap/internal/errors"
+)
+
+/*
+* Schema migrations
+*
+* schema.sql always describes the newest schema and is only applied to
+* new databases. Databases loaded from older vaults are brought forward
+* by the migrations below, in order. Each one runs in its own transaction
+* together with its meta update, so a database is never left between two
+* versions:
+*
+* 	meta.schema_version  version the database is at
+* 	meta.last_migration  last migration applied to it, 0 if it was
+* 	                     created at its current version
+*
+* A database from a newer schema is refused rather than opened: older
+* code would silently drop what it does not know about on the next commit.
+*
+* Adding a migration
+* 	- append it with version SchemaVersion+1 and bump SchemaVersion
+* 	- update schema.sql so new databases match a migrated one
+* 	- write DDL inline; never reuse schema.sql, which keeps moving
+*
+* Foreign keys stay enforced but are checked at commit, so a migration
+* may rebuild referenced tables as long as it ends consistent.
+* */
+
+type migration struct {
+	version int // schema version the migration produces
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+var migrations = []migration{
+	{2, "folders", migrateFolders},
+	{3, "entry extras", migrateEntryExtras},
+	{4, "entry types", migrateEntryTypes},
+	{5, "totp", migrateTOTP},
+	{6, "password history", migratePasswordHistory},
+	{7, "trash", migrateTrash},
+}
+
+// migrate upgrades db to SchemaVersion.
+func migrate(db *sql.DB) error {
+	from, err := GetSchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if from > SchemaVersion {
+		return fmt.Errorf("%w: schema version %d is newer than this yap supports (%d); upgrade yap",
+			yerrors.ErrInvalidVault, from, SchemaVersion)
+	}
+
+	for _, m := range migrations {
+		if m.version <= from {
+			continue
+		}
+		if err := runMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+func runMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`PRAGMA defer_foreign_keys = ON`); err != nil {
+		return err
+	}
+	if err := m.up(tx); err != nil {
+		return err
+	}
+
+	version := strconv.Itoa(m.version)
+	if _, err := tx.Exec(`
+		UPDATE meta SET value = ?
+		WHERE key IN ('schema_version', 'last_migration')`,
+		version,
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetSchemaVersion returns meta.schema_version.
+func GetSchemaVersion(db *sql.DB) (int, error) {
+	value, err := GetMeta(db, "schema_version")
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", yerrors.ErrCorruptData, err)
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < 1 {
+		return 0, fmt.Errorf("%w: invalid schema version %q", yerrors.ErrCorruptData, value)
+	}
+	return version, nil
+}
+
+// 2: folder tree with per-folder keys. The version 1 folders table was
+// never written to, so it is replaced rather than altered.
+func migrateFolders(tx *sql.Tx) error {
+	var n int
+	if err := tx.QueryRow(`SELECT count(*) FROM folders`).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return fmt.Errorf("version 1 folders table is not empty")
+	}
+
+	_, err := tx.Exec(`
+		DROP TABLE folders;
+		CREATE TABLE folders (
+		  id TEXT PRIMARY KEY,
+		  parent_id TEXT REFERENCES folders(id),
+		  name BLOB NOT NULL,
+		  created_at INTEGER NOT NULL,
+		  updated_at INTEGER NOT NULL,
+		  folder_key BLOB NOT NULL
+		);
+		CREATE INDEX idx_folders_parent_id ON folders(parent_id);
+		ALTER TABLE entries ADD COLUMN folder_id TEXT REFERENCES folders(id);
+		CREATE INDEX idx_entries_folder_id ON entries(folder_id);`)
+	return err
+}
+
+// 3: tags, custom fields and the favorite flag.
+func migrateEntryExtras(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE entries ADD COLUMN favorite INTEGER NOT NULL DEFAULT 0;
+		CREATE TABLE entry_tags (
+		  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		  position INTEGER NOT NULL,
+		  tag BLOB NOT NULL,
+		  PRIMARY KEY (entry_id, position)
+		);
+		CREATE TABLE entry_fields (
+		  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		  position INTEGER NOT NULL,
+		  kind TEXT NOT NULL,
+		  name BLOB NOT NULL,
+		  value BLOB NOT NULL,
+		  PRIMARY KEY (entry_id, position)
+		);`)
+	return err
+}
+
+// 4: entry types and their typed values. Existing entries are logins.
+func migrateEntryTypes(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		ALTER TABLE entries ADD COLUMN type TEXT NOT NULL DEFAULT 'login';
+		CREATE TABLE entry_data (
+		  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		  name TEXT NOT NULL,
+		  value BLOB NOT NULL,
+		  PRIMARY KEY (entry_id, name)
+		);`)
+	return err
+}
+
+// 5: encrypted TOTP secrets. Existing entries keep NULL, read as none.
+func migrateTOTP(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE entries ADD COLUMN totp BLOB`)
+	return err
+}
+
+// 6: password history. The retention limit is in meta and defaults when
+// unset, so nothing else changes.
+func migratePasswordHistory(tx *sql.Tx) error {
+	_, err := tx.Exec(`
+		CREATE TABLE password_history (
+		  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+		  seq INTEGER NOT NULL,
+		  changed_at INTEGER NOT NULL,
+		  password BLOB NOT NULL,
+		  PRIMARY KEY (entry_id, seq)
+		);`)
+	return err
+}
+
+// 7: soft delete. Entries deleted before this were removed outright, so
+// every existing entry is live.
+func migrateTrash(tx *sql.Tx) error {
+	_, err := tx.Exec(`ALTER TABLE entries ADD COLUMN deleted_at INTEGER`)
+	return err
+}
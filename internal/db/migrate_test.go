@@ -0,0 +1,204 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	yerrors "yap/internal/errors"
+)
+
+// schemaV1 is schema.sql as shipped at schema version 1.
+const schemaV1 = `
+CREATE TABLE entries (
+  id TEXT PRIMARY KEY,
+  title BLOB NOT NULL,
+  username BLOB,
+  password BLOB NOT NULL,
+  url BLOB,
+  notes BLOB,
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL,
+  entry_key BLOB NOT NULL
+);
+CREATE INDEX idx_entries_updated_at ON entries(updated_at);
+CREATE TABLE folders (
+  id TEXT PRIMARY KEY,
+  name BLOB NOT NULL
+);
+CREATE TABLE meta (
+  key TEXT PRIMARY KEY,
+  value TEXT NOT NULL
+);
+INSERT INTO meta (key, value) VALUES
+  ('schema_version', '1'),
+  ('last_migration', '0');`
+
+// imageWith returns a database image built by schema instead of schema.sql.
+func imageWith(t *testing.T, schema string) []byte {
+	t.Helper()
+
+	conn := sql.OpenDB(&memConnector{})
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+	if _, err := conn.Exec(schema); err != nil {
+		t.Fatal(err)
+	}
+	image, err := Serialize(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return image
+}
+
+// describeSchema lists every table with its columns and indices.
+func describeSchema(t *testing.T, conn *sql.DB) map[string][]string {
+	t.Helper()
+
+	var tables []string
+	rows, err := conn.Query(`SELECT name FROM sqlite_master WHERE type = 'table' ORDER BY name`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	out := map[string][]string{}
+	for _, table := range tables {
+		rows, err := conn.Query(`
+			SELECT name, type, "notnull", pk FROM pragma_table_info(?) ORDER BY name`, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var name, typ string
+			var notNull, pk int
+			if err := rows.Scan(&name, &typ, &notNull, &pk); err != nil {
+				t.Fatal(err)
+			}
+			out[table] = append(out[table], fmt.Sprintf("%s %s %d %d", name, typ, notNull, pk))
+		}
+		rows.Close()
+
+		rows, err = conn.Query(`SELECT name FROM pragma_index_list(?) ORDER BY name`, table)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				t.Fatal(err)
+			}
+			out[table] = append(out[table], "index "+name)
+		}
+		rows.Close()
+	}
+	return out
+}
+
+func TestMigrations_Ordered(t *testing.T) {
+	for i, m := range migrations {
+		if m.version != i+2 {
+			t.Fatalf("migration %q has version %d, want %d", m.name, m.version, i+2)
+		}
+	}
+	if last := migrations[len(migrations)-1].version; last != SchemaVersion {
+		t.Fatalf("last migration reaches %d, SchemaVersion is %d", last, SchemaVersion)
+	}
+}
+
+// A migrated database must look exactly like a new one.
+func TestMigrate_V1MatchesFresh(t *testing.T) {
+	image := imageWith(t, schemaV1+`
+		INSERT INTO entries (id, title, password, created_at, updated_at, entry_key)
+		VALUES ('e', x'00', x'00', 1, 1, x'00');`)
+
+	migrated, err := Open(image)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer migrated.Close()
+	fresh, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fresh.Close()
+
+	if got, want := describeSchema(t, migrated), describeSchema(t, fresh); !reflect.DeepEqual(got, want) {
+		t.Fatalf("migrated schema differs:\n got  %v\n want %v", got, want)
+	}
+
+	want := strconv.Itoa(SchemaVersion)
+	for _, key := range []string{"schema_version", "last_migration"} {
+		if v, err := GetMeta(migrated, key); err != nil || v != want {
+			t.Fatalf("%s = %q, %v; want %s", key, v, err, want)
+		}
+	}
+
+	var folderID *string
+	if err := migrated.QueryRow(`SELECT folder_id FROM entries WHERE id = 'e'`).Scan(&folderID); err != nil {
+		t.Fatal(err)
+	}
+	if folderID != nil {
+		t.Fatal("migrated entry should be at the root")
+	}
+}
+
+// A failed migration leaves the database at its old version.
+func TestMigrate_FailureRollsBack(t *testing.T) {
+	image := imageWith(t, schemaV1+`
+		INSERT INTO folders (id, name) VALUES ('f', x'00');`)
+
+	if _, err := Open(image); err == nil {
+		t.Fatal("expected the folders migration to fail")
+	}
+
+	conn, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	failing := migration{SchemaVersion + 1, "partial", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(`CREATE TABLE half_done (id TEXT)`); err != nil {
+			return err
+		}
+		return errors.New("boom")
+	}}
+	if err := runMigration(conn, failing); err == nil {
+		t.Fatal("expected failure")
+	}
+	var n int
+	if err := conn.QueryRow(`SELECT count(*) FROM sqlite_master WHERE name = 'half_done'`).Scan(&n); err != nil || n != 0 {
+		t.Fatalf("failed migration left changes behind: %d, %v", n, err)
+	}
+	if v, err := GetSchemaVersion(conn); err != nil || v != SchemaVersion {
+		t.Fatalf("schema version moved to %d, %v", v, err)
+	}
+}
+
+func TestMigrate_RefusesNewerSchema(t *testing.T) {
+	conn, err := Open(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetMeta(conn, "schema_version", strconv.Itoa(SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	image, err := Serialize(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	if _, err := Open(image); !errors.Is(err, yerrors.ErrInvalidVault) {
+		t.Fatalf("expected ErrInvalidVault, got %v", err)
+	}
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"yap/internal/crypto"
+	"yap/internal/keys"
+)
+
+// entryFieldColumns are the entries columns encrypted under the entry key.
+// totp is NULL in entries written before schema version 5.
+var entryFieldColumns = []string{"title", "username", "password", "url", "notes", "totp"}
+
+/*
+* RekeyEntry moves one entry from oldVaultKey to newVaultKey.
+*
+* The entry_key is re-encrypted under the new Vault Key. With
+* rotateEntryKey, a fresh entry key is generated and every field, tag,
+* custom field, typed value and old password is re-encrypted under it
+* as well.
+*
+* Idempotent: an entry whose entry_key already opens under newVaultKey
+* is left alone and reported as not rekeyed, which is what makes an
+* interrupted rekey resumable. Each entry is updated in one transaction,
+* so it is never half rekeyed.
+* */
+func RekeyEntry(
+	db *sql.DB,
+	vaultID string,
+	oldVaultKey *crypto.Secret,
+	newVaultKey *crypto.Secret,
+	entryID string,
+	rotateEntryKey bool,
+	rng crypto.RNG,
+) (rekeyed bool, err error) {
+	var entryKeyEnc []byte
+	if err := db.QueryRow(
+		`SELECT entry_key FROM entries WHERE id = ?`,
+		entryID,
+	).Scan(&entryKeyEnc); err != nil {
+		return false, err
+	}
+
+	// Already under the new key
+	if k, err := openEntryKey(entryKeyEnc, newVaultKey, vaultID, entryID); err == nil {
+		k.Destroy()
+		return false, nil
+	}
+
+	entryKey, err := openEntryKey(entryKeyEnc, oldVaultKey, vaultID, entryID)
+	if err != nil {
+		return false, fmt.Errorf("entry %s: %w", entryID, err)
+	}
+	defer entryKey.Destroy()
+
+	if !rotateEntryKey {
+		encEntryKey, err := sealEntryKey(entryKey, newVaultKey, vaultID, entryID, rng)
+		if err != nil {
+			return false, err
+		}
+		_, err = db.Exec(`UPDATE entries SET entry_key = ? WHERE id = ?`, encEntryKey, entryID)
+		return err == nil, err
+	}
+
+	// Rotate the entry key and re-encrypt every field under it
+	newEntryKey, err := keys.GenerateEntryKey(rng)
+	if err != nil {
+		return false, fmt.Errorf("entry key generation failed: %w", err)
+	}
+	defer newEntryKey.Destroy()
+
+	encEntryKey, err := sealEntryKey(newEntryKey, newVaultKey, vaultID, entryID, rng)
+	if err != nil {
+		return false, err
+	}
+
+	enc := make([][]byte, len(entryFieldColumns))
+	dst := make([]any, len(entryFieldColumns))
+	for i := range enc {
+		dst[i] = &enc[i]
+	}
+	if err := db.QueryRow(
+		`SELECT `+strings.Join(entryFieldColumns, ", ")+` FROM entries WHERE id = ?`,
+		entryID,
+	).Scan(dst...); err != nil {
+		return false, err
+	}
+
+	args := make([]any, 0, len(entryFieldColumns)+2)
+	for i, column := range entryFieldColumns {
+		var plain []byte
+		if enc[i] != nil {
+			if plain, err = DecryptField(enc[i], entryKey.Bytes(), vaultID, entryID, column); err != nil {
+				return false, err
+			}
+		}
+		reenc, err := EncryptField(plain, newEntryKey.Bytes(), vaultID, entryID, column, rng)
+		crypto.Wipe(plain)
+		if err != nil {
+			return false, err
+		}
+		args = append(args, reenc)
+	}
+	args = append(args, encEntryKey, entryID)
+
+	extrasEnc, err := loadEntryExtras(db, entryID)
+	if err != nil {
+		return false, err
+	}
+	extras := Entry{ID: entryID}
+	if err := extrasEnc.decrypt(&extras, entryKey, vaultID); err != nil {
+		return false, err
+	}
+	historyEnc, err := loadHistory(db, entryID)
+	if err != nil {
+		return false, err
+	}
+	history, err := decryptHistory(historyEnc, entryKey, vaultID, entryID)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		UPDATE entries SET
+			title = ?, username = ?, password = ?, url = ?, notes = ?, totp = ?,
+			entry_key = ?
+		WHERE id = ?`,
+		args...,
+	); err != nil {
+		return false, err
+	}
+	if err := writeEntryExtras(tx, vaultID, newEntryKey, extras, rng); err != nil {
+		return false, err
+	}
+	if err := writeHistory(tx, vaultID, newEntryKey, entryID, history, rng); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
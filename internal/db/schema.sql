@@ -1,7 +1,3 @@
-PRAGMA foreign_keys = ON;
-PRAGMA journal_mode = WAL;
-PRAGMA synchronous = FULL;
-
 CREATE TABLE IF NOT EXISTS entries (
   id TEXT PRIMARY KEY, -- UUID plain text
   -- encrypted fields
@@ -13,15 +9,63 @@ CREATE TABLE IF NOT EXISTS entries (
   -- unix epoch
   created_at INTEGER NOT NULL,
   updated_at INTEGER NOT NULL,
-  entry_key BLOB NOT NULL
+  entry_key BLOB NOT NULL,
+  folder_id TEXT REFERENCES folders(id), -- NULL is the root
+  favorite INTEGER NOT NULL DEFAULT 0,
+  type TEXT NOT NULL DEFAULT 'login', -- see entry_types.go
+  totp BLOB, -- encrypted otpauth URI, NULL before schema 5
+  deleted_at INTEGER -- unix epoch it went to the trash, NULL if live
 );
 CREATE INDEX IF NOT EXISTS idx_entries_updated_at 
-ON entries(updated_at)
+ON entries(updated_at);
+CREATE INDEX IF NOT EXISTS idx_entries_folder_id
+ON entries(folder_id);
+
+-- encrypted under the entry key of entry_id
+CREATE TABLE IF NOT EXISTS entry_tags (
+  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  tag BLOB NOT NULL,
+  PRIMARY KEY (entry_id, position)
+);
+
+CREATE TABLE IF NOT EXISTS entry_fields (
+  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+  position INTEGER NOT NULL,
+  kind TEXT NOT NULL, -- text, hidden, url, email
+  name BLOB NOT NULL,
+  value BLOB NOT NULL,
+  PRIMARY KEY (entry_id, position)
+);
+
+-- typed values, by type schema field name
+CREATE TABLE IF NOT EXISTS entry_data (
+  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+  name TEXT NOT NULL,
+  value BLOB NOT NULL,
+  PRIMARY KEY (entry_id, name)
+);
+
+-- replaced passwords, encrypted under the entry key of entry_id
+CREATE TABLE IF NOT EXISTS password_history (
+  entry_id TEXT NOT NULL REFERENCES entries(id) ON DELETE CASCADE,
+  seq INTEGER NOT NULL, -- grows per entry, part of the AAD
+  changed_at INTEGER NOT NULL,
+  password BLOB NOT NULL,
+  PRIMARY KEY (entry_id, seq)
+);
 
 CREATE TABLE IF NOT EXISTS folders (
-  id TEXT PRIMARY KEY,
-  name BLOB NOT NULL
+  id TEXT PRIMARY KEY, -- UUID plain text
+  parent_id TEXT REFERENCES folders(id), -- NULL is the root
+  -- encrypted under the folder key
+  name BLOB NOT NULL,
+  created_at INTEGER NOT NULL,
+  updated_at INTEGER NOT NULL,
+  folder_key BLOB NOT NULL
 );
+CREATE INDEX IF NOT EXISTS idx_folders_parent_id
+ON folders(parent_id);
 
 CREATE TABLE IF NOT EXISTS meta (
   key TEXT PRIMARY KEY,
@@ -29,5 +73,5 @@ CREATE TABLE IF NOT EXISTS meta (
 );
 
 INSERT OR IGNORE INTO meta (key, value) VALUES 
-  ('schema_version', '1'),
+  ('schema_version', '7'),
   ('last_migration', '0')
@@ -0,0 +1,172 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"time"
+	yerrors "yap/internal/errors"
+)
+
+/*
+* Trash
+*
+* DeleteEntry only sets entries.deleted_at. A trashed entry keeps its
+* key, fields and history, is left out of ListEntryIDs, and comes back
+* with RestoreEntry. PurgeEntry removes it for good.
+*
+* Trashed entries are tombstones for sync: both sides keep the row, so a
+* three-way merge sees a deletion rather than an entry missing on one
+* side. Purged entries are gone and merge as deleted.
+*
+* Commit purges entries trashed more than meta.trash_retention_days ago,
+* DefaultTrashRetentionDays when unset; 0 keeps them until emptied.
+* */
+
+const (
+	DefaultTrashRetentionDays = 30
+	trashRetentionKey         = "trash_retention_days"
+)
+
+// DeleteEntry moves an entry to the trash. Trashing it again is a no-op.
+func DeleteEntry(db *sql.DB, entryID string) error {
+	now := time.Now().Unix()
+	res, err := db.Exec(
+		`UPDATE entries SET deleted_at = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL`,
+		now, now, entryID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return requireEntry(db, entryID)
+	}
+	return nil
+}
+
+// RestoreEntry takes an entry out of the trash. An entry whose folder
+// was removed meanwhile is restored at the root.
+func RestoreEntry(db *sql.DB, entryID string) error {
+	res, err := db.Exec(
+		`UPDATE entries SET deleted_at = NULL, updated_at = ? WHERE id = ? AND deleted_at IS NOT NULL`,
+		time.Now().Unix(), entryID,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		if err := requireEntry(db, entryID); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: entry %s is not in the trash", yerrors.ErrInvalidInput, entryID)
+	}
+	return nil
+}
+
+// PurgeEntry deletes an entry for good, with its extras and history.
+func PurgeEntry(db *sql.DB, entryID string) error {
+	res, err := db.Exec(`DELETE FROM entries WHERE id = ?`, entryID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: entry %s", yerrors.ErrNotFound, entryID)
+	}
+	return nil
+}
+
+// PurgeTrash deletes every entry trashed at or before cutoff and returns
+// how many were purged.
+func PurgeTrash(db *sql.DB, cutoff int64) (int, error) {
+	res, err := db.Exec(`DELETE FROM entries WHERE deleted_at IS NOT NULL AND deleted_at <= ?`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	return int(n), err
+}
+
+// PurgeExpiredTrash applies the retention period as of now.
+func PurgeExpiredTrash(db *sql.DB, now time.Time) (int, error) {
+	days, err := GetTrashRetention(db)
+	if err != nil || days == 0 {
+		return 0, err
+	}
+	return PurgeTrash(db, now.Add(-time.Duration(days)*24*time.Hour).Unix())
+}
+
+// ListTrashIDs returns the trashed entries, most recently deleted first.
+func ListTrashIDs(db *sql.DB) ([]string, error) {
+	return queryIDs(db, `SELECT id FROM entries WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC, id`)
+}
+
+// ListAllEntryIDs returns every entry, trashed or not.
+func ListAllEntryIDs(db *sql.DB) ([]string, error) {
+	return queryIDs(db, `SELECT id FROM entries ORDER BY id`)
+}
+
+// GetTrashRetention returns after how many days trashed entries are
+// purged, 0 for never.
+func GetTrashRetention(db *sql.DB) (int, error) {
+	var value string
+	err := db.QueryRow(`SELECT value FROM meta WHERE key = ?`, trashRetentionKey).Scan(&value)
+	if err == sql.ErrNoRows {
+		return DefaultTrashRetentionDays, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("%w: invalid %s %q", yerrors.ErrCorruptData, trashRetentionKey, value)
+	}
+	return days, nil
+}
+
+// SetTrashRetention changes the retention period; it applies on the
+// next commit.
+func SetTrashRetention(db *sql.DB, days int) error {
+	if days < 0 {
+		return fmt.Errorf("%w: trash retention must not be negative", yerrors.ErrInvalidInput)
+	}
+	return SetMeta(db, trashRetentionKey, strconv.Itoa(days))
+}
+
+func requireEntry(db *sql.DB, entryID string) error {
+	var one int
+	err := db.QueryRow(`SELECT 1 FROM entries WHERE id = ?`, entryID).Scan(&one)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("%w: entry %s", yerrors.ErrNotFound, entryID)
+	}
+	return err
+}
+
+func queryIDs(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,122 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+func TestTrash(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	if err := CreateFolder(conn, folderTestVaultID, key, Folder{ID: "f", Name: "Work"}, rng); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"a", "b"} {
+		if err := CreateEntry(conn, folderTestVaultID, key, Entry{ID: id, Title: id, FolderID: "f"}, rng); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids := func(list func(*sql.DB) ([]string, error)) []string {
+		t.Helper()
+		out, err := list(conn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	if err := DeleteEntry(conn, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteEntry(conn, "a"); err != nil {
+		t.Fatalf("trashing twice: %v", err)
+	}
+	if got := ids(ListEntryIDs); len(got) != 1 || got[0] != "b" {
+		t.Fatalf("trashed entry still listed: %v", got)
+	}
+	if got := ids(ListTrashIDs); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("unexpected trash %v", got)
+	}
+	e, err := GetEntry(conn, folderTestVaultID, key, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.DeletedAt == 0 {
+		t.Fatal("deleted_at not read back")
+	}
+
+	// The folder can go; its trashed entry moves to the root
+	if err := DeleteEntry(conn, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := DeleteFolder(conn, "f"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreEntry(conn, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if e, err = GetEntry(conn, folderTestVaultID, key, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if e.DeletedAt != 0 || e.FolderID != "" {
+		t.Fatalf("unexpected restored entry %+v", e)
+	}
+	if err := RestoreEntry(conn, "a"); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("restoring a live entry: expected ErrInvalidInput, got %v", err)
+	}
+	if err := DeleteEntry(conn, "missing"); !errors.Is(err, yerrors.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	if err := PurgeEntry(conn, "b"); err != nil {
+		t.Fatal(err)
+	}
+	if got := ids(ListAllEntryIDs); len(got) != 1 || got[0] != "a" {
+		t.Fatalf("entry not purged: %v", got)
+	}
+}
+
+func TestTrash_Retention(t *testing.T) {
+	conn, key := newFolderTestDB(t)
+	rng := crypto.SecureRNG{}
+
+	if days, err := GetTrashRetention(conn); err != nil || days != DefaultTrashRetentionDays {
+		t.Fatalf("unexpected default retention %d, %v", days, err)
+	}
+	for _, id := range []string{"old", "new"} {
+		if err := CreateEntry(conn, folderTestVaultID, key, Entry{ID: id, Title: id}, rng); err != nil {
+			t.Fatal(err)
+		}
+		if err := DeleteEntry(conn, id); err != nil {
+			t.Fatal(err)
+		}
+	}
+	now := time.Now()
+	if _, err := conn.Exec(`UPDATE entries SET deleted_at = ? WHERE id = 'old'`,
+		now.Add(-31*24*time.Hour).Unix()); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := PurgeExpiredTrash(conn, now); err != nil || n != 1 {
+		t.Fatalf("expected 1 expired entry, got %d, %v", n, err)
+	}
+	if got, _ := ListTrashIDs(conn); len(got) != 1 || got[0] != "new" {
+		t.Fatalf("unexpected trash %v", got)
+	}
+
+	// 0 keeps the trash forever
+	if err := SetTrashRetention(conn, 0); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := PurgeExpiredTrash(conn, now.Add(365*24*time.Hour)); err != nil || n != 0 {
+		t.Fatalf("retention 0 purged %d, %v", n, err)
+	}
+	if err := SetTrashRetention(conn, -1); !errors.Is(err, yerrors.ErrInvalidInput) {
+		t.Fatalf("expected ErrInvalidInput, got %v", err)
+	}
+}
@@ -65,16 +65,14 @@ func MarshalCanonical(v any) ([]byte, error) {
 // - Rejects duplicate map keys
 // - Rejects tags and indefinite-length items
 func UnmarshalStrict(data []byte, v any) error {
-	r := bytes.NewReader(data)
-	dec := decMode.NewDecoder(r)
-
-	if err := dec.Decode(v); err != nil {
+	rest, err := decMode.UnmarshalFirst(data, v)
+	if err != nil {
 		return fmt.Errorf("cbor decode failed: %w", err)
 	}
-	
-	if r.Len() > 0 {
+
+	if len(rest) > 0 {
 		return fmt.Errorf("cbor decode failed: trailing data")
 	}
-	
+
 	return nil
 }
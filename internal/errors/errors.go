@@ -9,6 +9,9 @@ var (
 	ErrCorruptData      = errors.New("corrupt data")
 	ErrCryptoFailure    = errors.New("cryptographic failure")
 	ErrConfig           = errors.New("configuration error")
+	ErrNotFound         = errors.New("not found")
+	ErrDiverged         = errors.New("vault diverged")
+	ErrInvalidInput     = errors.New("invalid input")
 )
 
 
@@ -29,12 +29,8 @@ type EncryptedEntryKey struct {
 }
 
 // Generates a new random entry key
-func GenerateEntryKey(rng crypto.RNG) ([]byte, error) {
-	key := make([]byte, EntryKeySize)
-	if _, err := rng.Read(key); err != nil {
-		return nil, err
-	}
-	return key, nil
+func GenerateEntryKey(rng crypto.RNG) (*crypto.Secret, error) {
+	return crypto.RandomSecret(rng, EntryKeySize)
 }
 
 
@@ -57,17 +53,17 @@ func buildEntryKeyAAD(vaultID string, entryID string) ([]byte, error) {
 
 // Encrypt Entry Key 
 func EncryptEntryKey(
-	entryKey []byte,
-	vaultKey []byte,
+	entryKey *crypto.Secret,
+	vaultKey *crypto.Secret,
 	vaultID string,
 	entryID string,
 	rng crypto.RNG,
 ) ([]byte, error) {
 	// validations
-	if len(entryKey) != EntryKeySize {
+	if entryKey.Len() != EntryKeySize {
 		return nil, fmt.Errorf("invalid entry key length")
 	}
-	if len(vaultKey) != VaultKeySize {
+	if vaultKey.Len() != VaultKeySize {
 		return nil, fmt.Errorf("invalid vaukt key length")
 	}
 	
@@ -82,9 +78,9 @@ func EncryptEntryKey(
 	}
 
 	ct, err := crypto.Encrypt(
-		vaultKey,
+		vaultKey.Bytes(),
 		nonce,
-		entryKey,
+		entryKey.Bytes(),
 		aad,
 	)
 	if err != nil {
@@ -102,14 +98,15 @@ func EncryptEntryKey(
 	return encoding.MarshalCanonical(env)
 }
 
-// Decrypt entry key using the vault key
+// Decrypt entry key using the vault key. The caller owns it and must
+// Destroy it.
 func DecryptEntryKey(
 	encrypted []byte,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 	vaultID string,
 	entryID string,
-) ([]byte, error) {
-	if (len(vaultKey) != VaultKeySize) {
+) (*crypto.Secret, error) {
+	if (vaultKey.Len() != VaultKeySize) {
 		return nil, fmt.Errorf("invalid vault key length")
 	}
 	
@@ -135,7 +132,7 @@ func DecryptEntryKey(
 	}
 
 	entryKey, err := crypto.Decrypt(
-		vaultKey,
+		vaultKey.Bytes(),
 		env.Nonce,
 		env.CT,
 		aad,
@@ -145,8 +142,9 @@ func DecryptEntryKey(
 	}
 
 	if len(entryKey) != EntryKeySize {
+		crypto.Wipe(entryKey)
 		return nil, fmt.Errorf("invalid decrypted entry key length")
 	}
-	return entryKey, nil
+	return crypto.NewSecretFrom(entryKey)
 }
 
@@ -26,11 +26,13 @@ func GenerateSalt(rng crypto.RNG, size int) ([]byte, error) {
 	return salt, nil
 }
 
+// DeriveMasterKey runs Argon2id over the password. The caller owns the
+// returned key and must Destroy it.
 func DeriveMasterKey(
 	password []byte,
 	salt[] byte,
 	params crypto.Argon2Params,
-) ([]byte, error) {
+) (*crypto.Secret, error) {
 	if len(password) == 0 {
 		return nil, fmt.Errorf("master password cannot be empty")
 	}
@@ -54,7 +56,7 @@ func DeriveMasterKey(
 		return nil, fmt.Errorf("argon2id derivation failed: %w", err)
 	}
 
-	return key, nil
+	return crypto.NewSecretFrom(key)
 }
 
 
@@ -76,8 +78,10 @@ rng := crypto.SecureRNG{}
 salt, err := keys.GenerateSalt(rng, 32)
 params := keys.DefaultArgon2Params()
 masterKey, err := keys.DeriveMasterKey(password, salt, params)
+defer masterKey.Destroy()
 
 Vault Opening
 // params + salt read from header
 masterKey, err := keys.DeriveMasterKey(password, header.KDF.Salt, params)
+defer masterKey.Destroy()
 */
@@ -25,17 +25,26 @@ type WrappedVaultKey struct {
 	KeyEpoch uint64 `cbor:"key_epoch"`
 }
 
+// Generates a new random vault key
+func GenerateVaultKey(rng crypto.RNG) (*crypto.Secret, error) {
+	return crypto.RandomSecret(rng, VaultKeySize)
+}
+
 // Derives the key encryption key from the master key
-func DeriveKEK(masterKey []byte) ([]byte, error) {
-	if len(masterKey) != 32 {
+func DeriveKEK(masterKey *crypto.Secret) (*crypto.Secret, error) {
+	if masterKey.Len() != 32 {
 		return nil, fmt.Errorf("invalid master key length")
 	}
 
-	return crypto.HKDFExpand(
-		masterKey,
+	kek, err := crypto.HKDFExpand(
+		masterKey.Bytes(),
 		[]byte(hkdfWrapInfo),
 		32,
 	)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.NewSecretFrom(kek)
 }
 
 // AAD = "pmgr:vk-wrap" || vault_id || key_epoch
@@ -56,16 +65,16 @@ func buildWrapAAD(vaultID string, keyEpoch uint64) ([]byte, error) {
 
 // encrypts the vault key using the kek
 func WrapVaultKey(
-	vaultKey []byte,
-	kek []byte,
+	vaultKey *crypto.Secret,
+	kek *crypto.Secret,
 	vaultID string,
 	keyEpoch uint64,
 	rng crypto.RNG,
 ) ([]byte, error) {
-	if len(vaultKey) != VaultKeySize {
+	if vaultKey.Len() != VaultKeySize {
 		return nil, fmt.Errorf("invalid vault key length")
 	}
-	if len(kek) != 32 {
+	if kek.Len() != 32 {
 		return nil, fmt.Errorf("invalid KEK length")
 	} 
 	if keyEpoch == 0 {
@@ -83,9 +92,9 @@ func WrapVaultKey(
 	}
 
 	ct, err := crypto.Encrypt(
-		kek,
+		kek.Bytes(),
 		nonce,
-		vaultKey,
+		vaultKey.Bytes(),
 		aad,
 	)
 	if err != nil {
@@ -103,15 +112,16 @@ func WrapVaultKey(
 	return encoding.MarshalCanonical(wrapped)
 }
 
-// decrypts and returns the Vault Key.
+// decrypts and returns the Vault Key. The caller owns it and must
+// Destroy it.
 func UnwrapVaultKey(
 	wrappedBytes []byte,
-	kek []byte,
+	kek *crypto.Secret,
 	vaultID string,
 	expectedEpoch uint64,
-) ([]byte, error) {
+) (*crypto.Secret, error) {
 
-	if len(kek) != 32 {
+	if kek.Len() != 32 {
 		return nil, fmt.Errorf("invalid KEK length")
 	}
 
@@ -142,7 +152,7 @@ func UnwrapVaultKey(
 
 	// ---- Decrypt ----
 	vaultKey, err := crypto.Decrypt(
-		kek,
+		kek.Bytes(),
 		wrapped.Nonce,
 		wrapped.CT,
 		aad,
@@ -152,15 +162,16 @@ func UnwrapVaultKey(
 	}
 
 	if len(vaultKey) != VaultKeySize {
+		crypto.Wipe(vaultKey)
 		return nil, fmt.Errorf("invalid decrypted vault key length")
 	}
 
-	return vaultKey, nil
+	return crypto.NewSecretFrom(vaultKey)
 }
 // re-wraps an existing Vault Key under a new KEK and increments epoch.
 func RotateVaultKey(
-	vaultKey []byte,
-	newKEK []byte,
+	vaultKey *crypto.Secret,
+	newKEK *crypto.Secret,
 	vaultID string,
 	oldEpoch uint64,
 	rng crypto.RNG,
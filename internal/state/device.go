@@ -0,0 +1,114 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"yap/internal/encoding"
+	yerrors "yap/internal/errors"
+	"yap/internal/util"
+)
+
+const (
+	deviceFile        = "device"
+	deviceFileVersion = 1
+	maxLabelLen       = 64
+)
+
+// Device is this machine's stable identity, stamped into every commit.
+// It is not secret; it only answers "who last wrote this vault".
+type Device struct {
+	ID        string `cbor:"id"`
+	Label     string `cbor:"label"`
+	CreatedAt int64  `cbor:"created_at"`
+}
+
+type deviceRecord struct {
+	V      uint8  `cbor:"v"`
+	Device Device `cbor:"device"`
+}
+
+// Device returns the device identity, generating and persisting one on
+// first run. The default label is user@hostname.
+func (s *Store) Device() (*Device, error) {
+	path := filepath.Join(s.dir, deviceFile)
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		var rec deviceRecord
+		if err := encoding.UnmarshalStrict(data, &rec); err != nil {
+			return nil, fmt.Errorf("%w: device identity decode failed: %w", yerrors.ErrCorruptData, err)
+		}
+		if rec.V != deviceFileVersion || rec.Device.ID == "" || rec.Device.Label == "" {
+			return nil, fmt.Errorf("%w: invalid device identity", yerrors.ErrCorruptData)
+		}
+		return &rec.Device, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	id, err := util.NewUUID(s.rng)
+	if err != nil {
+		return nil, err
+	}
+	d := Device{
+		ID:        id,
+		Label:     defaultDeviceLabel(),
+		CreatedAt: time.Now().Unix(),
+	}
+	if err := s.saveDevice(d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// SetDeviceLabel renames this device. The ID never changes.
+func (s *Store) SetDeviceLabel(label string) (*Device, error) {
+	label = strings.TrimSpace(label)
+	if label == "" || len(label) > maxLabelLen {
+		return nil, fmt.Errorf("device label must be 1-%d bytes", maxLabelLen)
+	}
+
+	d, err := s.Device()
+	if err != nil {
+		return nil, err
+	}
+	d.Label = label
+	if err := s.saveDevice(*d); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (s *Store) saveDevice(d Device) error {
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("state dir create failed: %w", err)
+	}
+
+	data, err := encoding.MarshalCanonical(deviceRecord{
+		V:      deviceFileVersion,
+		Device: d,
+	})
+	if err != nil {
+		return err
+	}
+	return util.AtomicWriteFile(filepath.Join(s.dir, deviceFile), data)
+}
+
+func defaultDeviceLabel() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "unknown-host"
+	}
+	if user := os.Getenv("USER"); user != "" {
+		host = user + "@" + host
+	}
+	if len(host) > maxLabelLen {
+		host = host[:maxLabelLen]
+	}
+	return host
+}
@@ -0,0 +1,40 @@
+package state
+
+import (
+	"testing"
+	"yap/internal/crypto"
+)
+
+func TestDevice_StableAcrossLoads(t *testing.T) {
+	s := NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	d1, err := s.Device()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d2, err := s.Device()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d1.ID == "" || d1.ID != d2.ID {
+		t.Fatalf("device id not stable: %q vs %q", d1.ID, d2.ID)
+	}
+}
+
+func TestSetDeviceLabel_KeepsID(t *testing.T) {
+	s := NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	d, err := s.Device()
+	if err != nil {
+		t.Fatal(err)
+	}
+	renamed, err := s.SetDeviceLabel("work-laptop")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renamed.ID != d.ID || renamed.Label != "work-laptop" {
+		t.Fatalf("unexpected device after rename: %+v", renamed)
+	}
+}
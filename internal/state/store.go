@@ -0,0 +1,316 @@
+/*
+* Trusted local state
+*
+* Per-device record of the highest vault_version and key_epoch this device
+* has accepted for a vault. It is what makes rollback protection work:
+* Git can hand us any old vault, but it cannot rewind this file.
+*
+* Layout ($XDG_STATE_HOME/yap, 0700)
+* 	state.key     - 32 byte device-local MAC key (0600)
+* 	device        - CBOR device identity (see device.go)
+* 	vaults        - CBOR {v, vault_ids, mac}, every vault ever saved
+* 	<vault_id>    - CBOR {v, record, mac}
+*
+* What it protects against: a sync remote, a backup or a copied file
+* handing back an older vault. Records copied in from another device or
+* edited by hand fail their MAC, and a deleted record of a vault listed
+* in vaults fails closed with ErrRollbackDetected.
+*
+* What it does not: state.key sits next to the records, so anyone who can
+* write to this directory can forge records. Removing the whole directory
+* (or vaults with the records) looks like a fresh device. The directory
+* must be as private as the user's home.
+* */
+package state
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	"yap/internal/crypto"
+	"yap/internal/encoding"
+	yerrors "yap/internal/errors"
+	"yap/internal/util"
+)
+
+const (
+	stateFileVersion = 1
+	macKeySize       = 32
+	macKeyFile       = "state.key"
+	macPrefix        = "pmgr:local-state"
+	knownFile        = "vaults"
+	knownMACPrefix   = "pmgr:local-state-vaults"
+)
+
+// Record is the trusted state for a single vault.
+type Record struct {
+	VaultID              string `cbor:"vault_id"`
+	LastSeenVaultVersion uint64 `cbor:"last_seen_vault_version"`
+	LastSeenKeyEpoch     uint64 `cbor:"last_seen_key_epoch"`
+	UpdatedAt            int64  `cbor:"updated_at"`
+}
+
+type stateFile struct {
+	V      uint8  `cbor:"v"`
+	Record Record `cbor:"record"`
+	MAC    []byte `cbor:"mac"`
+}
+
+// knownVaults lists, sorted, the vault ids this device saved a record for.
+type knownVaults struct {
+	V        uint8    `cbor:"v"`
+	VaultIDs []string `cbor:"vault_ids"`
+	MAC      []byte   `cbor:"mac"`
+}
+
+// Store persists Records under a directory.
+type Store struct {
+	dir string
+	rng crypto.RNG
+}
+
+// DefaultDir returns $XDG_STATE_HOME/yap, falling back to ~/.local/state/yap.
+func DefaultDir() (string, error) {
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "yap"), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("%w: cannot resolve state directory: %w", yerrors.ErrConfig, err)
+	}
+	return filepath.Join(home, ".local", "state", "yap"), nil
+}
+
+func NewStore(dir string, rng crypto.RNG) *Store {
+	return &Store{dir: dir, rng: rng}
+}
+
+func (s *Store) Dir() string {
+	return s.dir
+}
+
+// Load returns the verified record for vaultID.
+// A vault never seen on this device yields ErrNotFound; a missing record
+// of a vault seen before yields ErrRollbackDetected.
+func (s *Store) Load(vaultID string) (*Record, error) {
+	path, err := s.recordPath(vaultID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		known, err := s.known()
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(known, vaultID) {
+			return nil, fmt.Errorf("%w: local state for vault %s was removed", yerrors.ErrRollbackDetected, vaultID)
+		}
+		return nil, fmt.Errorf("%w: no local state for vault %s", yerrors.ErrNotFound, vaultID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f stateFile
+	if err := encoding.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: local state decode failed: %w", yerrors.ErrCorruptData, err)
+	}
+	if f.V != stateFileVersion {
+		return nil, fmt.Errorf("%w: unsupported local state version", yerrors.ErrCorruptData)
+	}
+	if f.Record.VaultID != vaultID {
+		return nil, fmt.Errorf("%w: local state vault_id mismatch", yerrors.ErrCorruptData)
+	}
+
+	// Fail closed: a record without its key cannot be trusted
+	key, err := s.macKey(false)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := recordMAC(key, f.Record)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(expected, f.MAC) != 1 {
+		return nil, fmt.Errorf("%w: local state mac mismatch", yerrors.ErrCorruptData)
+	}
+
+	return &f.Record, nil
+}
+
+// Save atomically records that vaultID was seen at version/epoch.
+// Counters never move backwards; a lower value is a rollback.
+func (s *Store) Save(vaultID string, vaultVersion, keyEpoch uint64) error {
+	path, err := s.recordPath(vaultID)
+	if err != nil {
+		return err
+	}
+
+	prev, err := s.Load(vaultID)
+	if err != nil && !errors.Is(err, yerrors.ErrNotFound) {
+		return err
+	}
+	if prev != nil {
+		if vaultVersion < prev.LastSeenVaultVersion {
+			return fmt.Errorf("%w: vault_version would move backwards", yerrors.ErrRollbackDetected)
+		}
+		if keyEpoch < prev.LastSeenKeyEpoch {
+			return fmt.Errorf("%w: key_epoch would move backwards", yerrors.ErrRollbackDetected)
+		}
+	}
+
+	if err := os.MkdirAll(s.dir, 0o700); err != nil {
+		return fmt.Errorf("state dir create failed: %w", err)
+	}
+	key, err := s.macKey(true)
+	if err != nil {
+		return err
+	}
+
+	rec := Record{
+		VaultID:              vaultID,
+		LastSeenVaultVersion: vaultVersion,
+		LastSeenKeyEpoch:     keyEpoch,
+		UpdatedAt:            time.Now().Unix(),
+	}
+	mac, err := recordMAC(key, rec)
+	if err != nil {
+		return err
+	}
+
+	data, err := encoding.MarshalCanonical(stateFile{
+		V:      stateFileVersion,
+		Record: rec,
+		MAC:    mac,
+	})
+	if err != nil {
+		return err
+	}
+
+	// The record goes first: a crash in between leaves it unlisted, which
+	// is no worse than before
+	if err := util.AtomicWriteFile(path, data); err != nil {
+		return err
+	}
+	return s.addKnown(key, vaultID)
+}
+
+// known returns the verified list of vaults this device has seen. No
+// list, as on a fresh device, is an empty one.
+func (s *Store) known() ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(s.dir, knownFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var f knownVaults
+	if err := encoding.UnmarshalStrict(data, &f); err != nil {
+		return nil, fmt.Errorf("%w: known vaults decode failed: %w", yerrors.ErrCorruptData, err)
+	}
+	if f.V != stateFileVersion {
+		return nil, fmt.Errorf("%w: unsupported known vaults version", yerrors.ErrCorruptData)
+	}
+	key, err := s.macKey(false)
+	if err != nil {
+		return nil, err
+	}
+	expected, err := knownMAC(key, f.VaultIDs)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare(expected, f.MAC) != 1 {
+		return nil, fmt.Errorf("%w: known vaults mac mismatch", yerrors.ErrCorruptData)
+	}
+	return f.VaultIDs, nil
+}
+
+// addKnown adds vaultID to the list of vaults this device has seen.
+func (s *Store) addKnown(key []byte, vaultID string) error {
+	ids, err := s.known()
+	if err != nil {
+		return err
+	}
+	if slices.Contains(ids, vaultID) {
+		return nil
+	}
+	ids = append(ids, vaultID)
+	slices.Sort(ids)
+
+	mac, err := knownMAC(key, ids)
+	if err != nil {
+		return err
+	}
+	data, err := encoding.MarshalCanonical(knownVaults{V: stateFileVersion, VaultIDs: ids, MAC: mac})
+	if err != nil {
+		return err
+	}
+	return util.AtomicWriteFile(filepath.Join(s.dir, knownFile), data)
+}
+
+func (s *Store) recordPath(vaultID string) (string, error) {
+	if vaultID == "" || vaultID == macKeyFile || vaultID == deviceFile || vaultID == knownFile ||
+		strings.ContainsAny(vaultID, `/\`) || strings.HasPrefix(vaultID, ".") {
+		return "", fmt.Errorf("invalid vault_id for local state: %q", vaultID)
+	}
+	return filepath.Join(s.dir, vaultID), nil
+}
+
+// macKey loads the device MAC key, generating it on first use if create is set.
+func (s *Store) macKey(create bool) ([]byte, error) {
+	path := filepath.Join(s.dir, macKeyFile)
+
+	key, err := os.ReadFile(path)
+	if err == nil {
+		if len(key) != macKeySize {
+			return nil, fmt.Errorf("%w: invalid local state key", yerrors.ErrCorruptData)
+		}
+		return key, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if !create {
+		return nil, fmt.Errorf("%w: local state key missing", yerrors.ErrCorruptData)
+	}
+
+	key = make([]byte, macKeySize)
+	if _, err := s.rng.Read(key); err != nil {
+		return nil, err
+	}
+	if err := util.AtomicWriteFile(path, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func knownMAC(key []byte, ids []string) ([]byte, error) {
+	body, err := encoding.MarshalCanonical(ids)
+	if err != nil {
+		return nil, err
+	}
+	return crypto.MAC(key, append([]byte(knownMACPrefix), body...))
+}
+
+func recordMAC(key []byte, rec Record) ([]byte, error) {
+	body, err := encoding.MarshalCanonical(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	msg := make([]byte, 0, len(macPrefix)+len(body))
+	msg = append(msg, macPrefix...)
+	msg = append(msg, body...)
+
+	return crypto.MAC(key, msg)
+}
@@ -0,0 +1,101 @@
+package state
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"yap/internal/crypto"
+	yerrors "yap/internal/errors"
+)
+
+func TestStore_SaveLoad_RoundTrip(t *testing.T) {
+	s := NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	if err := s.Save("vault-1", 3, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := s.Load("vault-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.LastSeenVaultVersion != 3 || rec.LastSeenKeyEpoch != 2 {
+		t.Fatalf("unexpected record: %+v", rec)
+	}
+}
+
+func TestStore_Load_UnknownVault(t *testing.T) {
+	s := NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	if _, err := s.Load("vault-1"); !errors.Is(err, yerrors.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_Save_RefusesRollback(t *testing.T) {
+	s := NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	if err := s.Save("vault-1", 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save("vault-1", 4, 1); !errors.Is(err, yerrors.ErrRollbackDetected) {
+		t.Fatalf("expected ErrRollbackDetected, got %v", err)
+	}
+}
+
+func TestStore_Load_DetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir, crypto.SecureRNG{})
+
+	if err := s.Save("vault-1", 5, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Swap in a record MAC'd under a different device key
+	other := NewStore(t.TempDir(), crypto.SecureRNG{})
+	if err := other.Save("vault-1", 1, 1); err != nil {
+		t.Fatal(err)
+	}
+	forged, err := os.ReadFile(filepath.Join(other.Dir(), "vault-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "vault-1"), forged, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Load("vault-1"); !errors.Is(err, yerrors.ErrCorruptData) {
+		t.Fatalf("expected ErrCorruptData, got %v", err)
+	}
+}
+
+// A removed record of a vault this device has seen fails closed.
+func TestStore_Load_RemovedRecordFailsClosed(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir, crypto.SecureRNG{})
+
+	if err := s.Save("vault-1", 5, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(dir, "vault-1")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("vault-1"); !errors.Is(err, yerrors.ErrRollbackDetected) {
+		t.Fatalf("expected ErrRollbackDetected, got %v", err)
+	}
+	if err := s.Save("vault-1", 1, 1); !errors.Is(err, yerrors.ErrRollbackDetected) {
+		t.Fatalf("expected ErrRollbackDetected, got %v", err)
+	}
+	if _, err := s.Load("vault-2"); !errors.Is(err, yerrors.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for a new vault, got %v", err)
+	}
+
+	// The list is MAC'd like the records
+	if err := os.WriteFile(filepath.Join(dir, "vaults"), []byte{0xa0}, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Load("vault-1"); !errors.Is(err, yerrors.ErrCorruptData) {
+		t.Fatalf("expected ErrCorruptData, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/util"
+)
+
+/*
+* Conflicts
+*
+* When both sides advanced, neither is overwritten. Both ciphertexts are
+* kept next to the vault file until the user resolves them:
+*
+* 	vault.yap.local   our diverged version
+* 	vault.yap.remote  the remote version at detection time
+* 	vault.yap.base    the last common version, if any (for merging)
+*
+* Only vault.yap is ever committed, so the copies stay out of Git; the
+* CLI also lists them in .git/info/exclude (Repo.Exclude).
+* */
+
+const (
+	localSuffix  = ".local"
+	remoteSuffix = ".remote"
+	baseSuffix   = ".base"
+)
+
+// Conflict holds both sides of a diverged vault.
+type Conflict struct {
+	Local  []byte
+	Remote []byte
+	Base   []byte // nil if the histories share no vault
+}
+
+// ConflictPaths returns where the copies of vaultPath are kept.
+func ConflictPaths(vaultPath string) (local, remote string) {
+	return vaultPath + localSuffix, vaultPath + remoteSuffix
+}
+
+// BasePath returns where the common ancestor of a conflict is kept.
+func BasePath(vaultPath string) string {
+	return vaultPath + baseSuffix
+}
+
+// SaveConflict persists both sides of a divergence.
+func SaveConflict(vaultPath string, c *Conflict) error {
+	localPath, remotePath := ConflictPaths(vaultPath)
+	if c.Base != nil {
+		if err := util.AtomicWriteFile(BasePath(vaultPath), c.Base); err != nil {
+			return err
+		}
+	}
+	if err := util.AtomicWriteFile(localPath, c.Local); err != nil {
+		return err
+	}
+	return util.AtomicWriteFile(remotePath, c.Remote)
+}
+
+// LoadConflict reads a pending conflict. It returns ErrNotFound if there
+// is none.
+func LoadConflict(vaultPath string) (*Conflict, error) {
+	localPath, remotePath := ConflictPaths(vaultPath)
+
+	local, err := os.ReadFile(localPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: no pending conflict", yerrors.ErrNotFound)
+	}
+	if err != nil {
+		return nil, err
+	}
+	remote, err := os.ReadFile(remotePath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: conflict is missing its remote copy", yerrors.ErrCorruptData)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	base, err := os.ReadFile(BasePath(vaultPath))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	return &Conflict{Local: local, Remote: remote, Base: base}, nil
+}
+
+// ClearConflict removes the saved copies.
+func ClearConflict(vaultPath string) error {
+	localPath, remotePath := ConflictPaths(vaultPath)
+	for _, p := range []string{localPath, remotePath, BasePath(vaultPath)} {
+		if err := os.Remove(p); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ResetToRemote moves the branch to the remote-tracking ref without
+// touching the work tree. Used after a conflict is resolved so the
+// resolution commit fast-forwards the remote.
+func (r *Repo) ResetToRemote() error {
+	if _, err := r.git("reset", "--quiet", "--mixed", r.remoteRef()); err != nil {
+		return fmt.Errorf("git reset failed: %w", err)
+	}
+	return nil
+}
+
+// MergeBaseVault returns the vault at the last commit shared by HEAD and
+// the remote, or nil if there is none or it holds no vault.
+func (r *Repo) MergeBaseVault() ([]byte, error) {
+	base, err := r.git("merge-base", "HEAD", r.remoteRef())
+	if err != nil {
+		return nil, nil
+	}
+	data, err := r.showBlob(base)
+	if errors.Is(err, yerrors.ErrNotFound) {
+		return nil, nil
+	}
+	return data, err
+}
+
+// ChangeKind classifies how an entry differs between two vaults.
+type ChangeKind string
+
+const (
+	ChangeLocalOnly  ChangeKind = "local_only"
+	ChangeRemoteOnly ChangeKind = "remote_only"
+	ChangeModified   ChangeKind = "modified"
+)
+
+// EntryChange is one differing entry. Fields names the columns that
+// differ; values are never included.
+type EntryChange struct {
+	ID     string
+	Title  string
+	Kind   ChangeKind
+	Fields []string
+	Local  *db.Entry
+	Remote *db.Entry
+}
+
+// DiffEntries compares two entry sets by ID, ordered by title then ID.
+func DiffEntries(local, remote []db.Entry) []EntryChange {
+	remoteByID := make(map[string]db.Entry, len(remote))
+	for _, e := range remote {
+		remoteByID[e.ID] = e
+	}
+
+	var changes []EntryChange
+	for _, l := range local {
+		r, ok := remoteByID[l.ID]
+		if !ok {
+			changes = append(changes, EntryChange{ID: l.ID, Title: l.Title, Kind: ChangeLocalOnly, Local: &l})
+			continue
+		}
+		delete(remoteByID, l.ID)
+
+		if fields := ChangedFields(l, r); len(fields) > 0 {
+			changes = append(changes, EntryChange{
+				ID: l.ID, Title: l.Title, Kind: ChangeModified, Fields: fields, Local: &l, Remote: &r,
+			})
+		}
+	}
+	for _, r := range remoteByID {
+		changes = append(changes, EntryChange{ID: r.ID, Title: r.Title, Kind: ChangeRemoteOnly, Remote: &r})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		if changes[i].Title != changes[j].Title {
+			return changes[i].Title < changes[j].Title
+		}
+		return changes[i].ID < changes[j].ID
+	})
+	return changes
+}
+
+// ChangedFields lists the user-visible fields that differ between a and b.
+func ChangedFields(a, b db.Entry) []string {
+	var fields []string
+	for _, f := range fieldNames(&a, &b) {
+		if getField(&a, f) != getField(&b, f) {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,168 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"yap/internal/encoding"
+	yerrors "yap/internal/errors"
+	"yap/internal/state"
+	"yap/internal/vault"
+)
+
+/*
+* Remote detection (no password)
+*
+* Only the plaintext header of the remote vault is read. It is not
+* authenticated until the vault is decrypted, so the result is advisory:
+* it decides what to attempt, never what to accept.
+* */
+
+// Relation describes the remote vault relative to the local one.
+type Relation string
+
+const (
+	RelationMissing  Relation = "missing"  // no vault on the remote
+	RelationEqual    Relation = "equal"    // same vault version
+	RelationAhead    Relation = "ahead"    // remote has newer versions
+	RelationBehind   Relation = "behind"   // local has newer versions
+	RelationDiverged Relation = "diverged" // both sides advanced
+	RelationForeign  Relation = "foreign"  // remote is a different vault
+	RelationRollback Relation = "rollback" // remote is older than trusted state
+)
+
+// RemoteState is the outcome of comparing local and remote headers.
+type RemoteState struct {
+	Relation Relation
+	Local    *vault.VaultHeader // nil if there is no local vault
+	Remote   *vault.VaultHeader // nil if Relation is RelationMissing
+	Trusted  *state.Record      // nil if the vault was never opened here
+}
+
+// DetectRemote compares the vault at the last fetched remote ref with the
+// local vault file and trusted state. Call Fetch first.
+func (r *Repo) DetectRemote(localPath string, store *state.Store) (*RemoteState, error) {
+	rs := &RemoteState{Relation: RelationMissing}
+
+	// 1) local header
+	local, err := vault.ReadFile(localPath)
+	if err == nil {
+		rs.Local = local.Header
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	// 2) remote header
+	data, err := r.RemoteVault()
+	if errors.Is(err, yerrors.ErrNotFound) {
+		return rs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	remote, err := vault.DecodeFile(data)
+	if err != nil {
+		return nil, err
+	}
+	rs.Remote = remote.Header
+
+	// 3) trusted state for whichever vault we consider ours
+	if store != nil {
+		id := rs.Remote.VaultID
+		if rs.Local != nil {
+			id = rs.Local.VaultID
+		}
+		rec, err := store.Load(id)
+		if err == nil {
+			rs.Trusted = rec
+		} else if !errors.Is(err, yerrors.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	rs.Relation = CompareHeaders(rs.Local, rs.Remote, rs.Trusted)
+
+	// Headers carry second resolution timestamps; equal headers with
+	// different payloads are two writers, not one vault
+	if rs.Relation == RelationEqual && local != nil &&
+		!bytes.Equal(local.EnvelopeBytes, remote.EnvelopeBytes) {
+		rs.Relation = RelationDiverged
+	}
+
+	// 4) Git history can show divergence the counters alone cannot
+	if rs.Relation == RelationAhead || rs.Relation == RelationBehind {
+		st, err := r.Status()
+		if err != nil {
+			return nil, err
+		}
+		if st.Diverged() {
+			rs.Relation = RelationDiverged
+		}
+	}
+
+	return rs, nil
+}
+
+// CompareHeaders classifies remote against local and trusted state.
+// local and trusted may be nil.
+func CompareHeaders(local, remote *vault.VaultHeader, trusted *state.Record) Relation {
+	if remote == nil {
+		return RelationMissing
+	}
+
+	switch {
+	case local != nil && local.VaultID != remote.VaultID:
+		return RelationForeign
+	case trusted != nil && trusted.VaultID != remote.VaultID:
+		return RelationForeign
+	}
+
+	// Trusted state is the newest vault this machine accepted. A remote
+	// older than that was rolled back, unless a newer local file explains
+	// the gap (local changes or a local rekey not pushed yet)
+	if trusted != nil &&
+		(remote.VaultVersion < trusted.LastSeenVaultVersion || remote.KeyEpoch < trusted.LastSeenKeyEpoch) &&
+		(local == nil || (local.VaultVersion <= remote.VaultVersion && local.KeyEpoch <= remote.KeyEpoch)) {
+		return RelationRollback
+	}
+
+	// Without a local file, trusted state stands in for it
+	if local == nil {
+		if trusted == nil || remote.VaultVersion > trusted.LastSeenVaultVersion {
+			return RelationAhead
+		}
+		return RelationEqual
+	}
+
+	switch {
+	case remote.VaultVersion > local.VaultVersion:
+		// A local rekey the remote never saw
+		if remote.KeyEpoch < local.KeyEpoch {
+			return RelationDiverged
+		}
+		return RelationAhead
+	case remote.VaultVersion < local.VaultVersion:
+		if remote.KeyEpoch > local.KeyEpoch {
+			return RelationDiverged
+		}
+		return RelationBehind
+	default:
+		// Same version from two writers
+		if !sameHeader(local, remote) {
+			return RelationDiverged
+		}
+		return RelationEqual
+	}
+}
+
+func sameHeader(a, b *vault.VaultHeader) bool {
+	ab, err := encoding.MarshalCanonical(a)
+	if err != nil {
+		return false
+	}
+	bb, err := encoding.MarshalCanonical(b)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(ab, bb)
+}
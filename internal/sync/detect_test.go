@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"strings"
+	"testing"
+	"yap/internal/db"
+	"yap/internal/state"
+	"yap/internal/vault"
+)
+
+func header(id string, version, epoch uint64) *vault.VaultHeader {
+	return &vault.VaultHeader{
+		VaultID:      id,
+		VaultVersion: version,
+		KeyEpoch:     epoch,
+		LastModified: int64(version),
+	}
+}
+
+func TestCompareHeaders(t *testing.T) {
+	sameVersionOtherWriter := header("v", 3, 1)
+	sameVersionOtherWriter.LastModified = 99
+
+	tests := []struct {
+		name    string
+		local   *vault.VaultHeader
+		remote  *vault.VaultHeader
+		trusted *state.Record
+		want    Relation
+	}{
+		{"missing", header("v", 1, 1), nil, nil, RelationMissing},
+		{"equal", header("v", 3, 1), header("v", 3, 1), nil, RelationEqual},
+		{"ahead", header("v", 3, 1), header("v", 5, 1), nil, RelationAhead},
+		{"behind", header("v", 5, 1), header("v", 3, 1), nil, RelationBehind},
+		{"same version, different content", header("v", 3, 1), sameVersionOtherWriter, nil, RelationDiverged},
+		{"remote ahead on old key", header("v", 3, 2), header("v", 5, 1), nil, RelationDiverged},
+		{"remote behind on new key", header("v", 5, 1), header("v", 3, 2), nil, RelationDiverged},
+		{"foreign vault", header("v", 3, 1), header("w", 3, 1), nil, RelationForeign},
+		{"foreign to trusted state", nil, header("w", 3, 1), &state.Record{VaultID: "v"}, RelationForeign},
+		{"no local, never seen", nil, header("v", 3, 1), nil, RelationAhead},
+		{"no local, trusted newer", nil, header("v", 3, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 4}, RelationRollback},
+		{"no local, trusted on newer key", nil, header("v", 5, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 4, LastSeenKeyEpoch: 2}, RelationRollback},
+		{"stale local, trusted newer", header("v", 2, 1), header("v", 3, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 4, LastSeenKeyEpoch: 1}, RelationRollback},
+		{"local and remote both rolled back", header("v", 3, 1), header("v", 3, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 4, LastSeenKeyEpoch: 1}, RelationRollback},
+		{"unpushed local changes", header("v", 5, 1), header("v", 3, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 5, LastSeenKeyEpoch: 1}, RelationBehind},
+		{"unpushed local rekey", header("v", 4, 2), header("v", 5, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 4, LastSeenKeyEpoch: 2}, RelationDiverged},
+		{"trusted and ahead", header("v", 3, 1), header("v", 5, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 3, LastSeenKeyEpoch: 1}, RelationAhead},
+		{"no local, trusted equal", nil, header("v", 3, 1), &state.Record{VaultID: "v", LastSeenVaultVersion: 3}, RelationEqual},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CompareHeaders(tt.local, tt.remote, tt.trusted); got != tt.want {
+				t.Fatalf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffEntries(t *testing.T) {
+	local := []db.Entry{
+		{ID: "1", Title: "same", Password: "p"},
+		{ID: "2", Title: "changed", Password: "old", URL: "u"},
+		{ID: "3", Title: "local"},
+	}
+	remote := []db.Entry{
+		{ID: "1", Title: "same", Password: "p"},
+		{ID: "2", Title: "changed", Password: "new", URL: "u2"},
+		{ID: "4", Title: "remote"},
+	}
+
+	changes := DiffEntries(local, remote)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %+v", changes)
+	}
+
+	want := map[string]ChangeKind{"2": ChangeModified, "3": ChangeLocalOnly, "4": ChangeRemoteOnly}
+	for _, c := range changes {
+		if want[c.ID] != c.Kind {
+			t.Fatalf("entry %s: got %s, want %s", c.ID, c.Kind, want[c.ID])
+		}
+		if c.ID == "2" && strings.Join(c.Fields, ",") != "password,url" {
+			t.Fatalf("unexpected changed fields %v", c.Fields)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+	"yap/internal/db"
+)
+
+/*
+* Three-way folder merge
+*
+* Folders merge against base like entries, by ID, on two fields: the
+* name and the parent.
+*
+* 	renamed or moved on one side  -> take that side
+* 	changed on both, same way     -> take it
+* 	same field changed twice      -> conflict (defaults to local)
+* 	deleted on one side           -> delete, unless merged entries or
+* 	                                 folders are still filed under it
+* 	added on both under one name  -> one folder, the local one
+*
+* A remote move that would close a loop with a local one is dropped:
+* the local tree has no loops.
+* */
+
+// FolderConflict is a folder both sides renamed, or moved, differently.
+type FolderConflict struct {
+	FolderID string
+	Field    string // "name" or "parent"
+	Local    db.Folder
+	Remote   db.Folder
+}
+
+// FolderMerge is the result of MergeFolders. Conflicts hold local values
+// until Choose picks the remote side.
+type FolderMerge struct {
+	folders map[string]*db.Folder // includes folders deleted on one side
+	deleted map[string]bool       // deleted on one side, dropped unless used
+	local   map[string]*db.Folder
+
+	// RemoteIDs maps folders the remote added under a name the local
+	// side also added onto the local folder.
+	RemoteIDs map[string]string
+	Conflicts []FolderConflict
+}
+
+// MergeFolders merges local and remote folder sets against base.
+func MergeFolders(base, local, remote []db.Folder) *FolderMerge {
+	b, l, r := foldersByID(base), foldersByID(local), foldersByID(remote)
+	m := &FolderMerge{
+		folders:   map[string]*db.Folder{},
+		deleted:   map[string]bool{},
+		local:     l,
+		RemoteIDs: map[string]string{},
+	}
+
+	ids := map[string]struct{}{}
+	for _, set := range []map[string]*db.Folder{b, l, r} {
+		for id := range set {
+			ids[id] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	var added []*db.Folder
+	for _, id := range sorted {
+		bf, lf, rf := b[id], l[id], r[id]
+		switch {
+		case lf == nil && rf == nil:
+
+		case lf == nil || rf == nil:
+			side := lf
+			if side == nil {
+				side = rf
+			}
+			f := *side
+			m.folders[id] = &f
+			switch {
+			case bf != nil:
+				m.deleted[id] = true
+			case lf == nil:
+				added = append(added, &f)
+			}
+
+		default:
+			if bf == nil {
+				bf = &db.Folder{ID: id}
+			}
+			merged := *lf
+			for _, field := range []string{"name", "parent"} {
+				lv, rv, bv := folderField(lf, field), folderField(rf, field), folderField(bf, field)
+				switch {
+				case lv == rv, rv == bv:
+				case lv == bv:
+					setFolderField(&merged, field, rv)
+				default:
+					m.Conflicts = append(m.Conflicts, FolderConflict{
+						FolderID: id, Field: field, Local: *lf, Remote: *rf,
+					})
+				}
+			}
+			m.folders[id] = &merged
+		}
+	}
+
+	// Parents first, so a nested pair added on both sides matches twice
+	depth := func(f *db.Folder) int {
+		n := 0
+		for p := f.ParentID; p != "" && n <= len(r); n++ {
+			parent, ok := r[p]
+			if !ok {
+				break
+			}
+			p = parent.ParentID
+		}
+		return n
+	}
+	sort.SliceStable(added, func(i, j int) bool { return depth(added[i]) < depth(added[j]) })
+	for _, f := range added {
+		f.ParentID = m.folderID(f.ParentID)
+		if match := m.findLocal(f.ParentID, f.Name); match != nil {
+			m.RemoteIDs[f.ID] = match.ID
+			delete(m.folders, f.ID)
+		}
+	}
+	return m
+}
+
+// MatchFolders maps remote folders onto the local folders added under
+// the same path with another id, as MergeFolders does, without a base:
+// for comparing the two sides only.
+func MatchFolders(local, remote []db.Folder) map[string]string {
+	return MergeFolders(nil, local, remote).RemoteIDs
+}
+
+// Choose resolves conflict i. Local is already applied, so only a
+// remote choice changes the result.
+func (m *FolderMerge) Choose(i int, useRemote bool) {
+	if !useRemote {
+		return
+	}
+	c := m.Conflicts[i]
+	setFolderField(m.folders[c.FolderID], c.Field, folderField(&c.Remote, c.Field))
+}
+
+/*
+* Result returns the merged folders, parents first. entries are the
+* merged entries, pointing at merged folder ids: a folder deleted on one
+* side stays while one of their live entries, or a kept folder, is still
+* filed under it. Entries left in a dropped folder move to the root.
+* */
+func (m *FolderMerge) Result(entries []db.Entry) []db.Folder {
+	folders := make(map[string]*db.Folder, len(m.folders))
+	for id, f := range m.folders {
+		c := *f
+		c.ParentID = m.folderID(c.ParentID)
+		folders[id] = &c
+	}
+	for _, f := range folders {
+		if _, ok := folders[f.ParentID]; !ok {
+			f.ParentID = ""
+		}
+	}
+	m.breakLoops(folders)
+
+	used := map[string]bool{}
+	use := func(id string) {
+		for id != "" && !used[id] {
+			used[id] = true
+			f, ok := folders[id]
+			if !ok {
+				return
+			}
+			id = f.ParentID
+		}
+	}
+	for _, e := range entries {
+		if e.DeletedAt == 0 {
+			use(e.FolderID)
+		}
+	}
+	for id := range folders {
+		if !m.deleted[id] {
+			use(id)
+		}
+	}
+	for id := range folders {
+		if !used[id] {
+			delete(folders, id)
+		}
+	}
+	for i := range entries {
+		if _, ok := folders[entries[i].FolderID]; !ok {
+			entries[i].FolderID = ""
+		}
+	}
+
+	return sortFolders(folders)
+}
+
+// breakLoops puts back the local parent of a folder whose remote move
+// closed a loop, until none is left.
+func (m *FolderMerge) breakLoops(folders map[string]*db.Folder) {
+	for _, id := range sortFolderIDs(folders) {
+		for loop := folderLoop(folders, id); loop != nil; loop = folderLoop(folders, id) {
+			undone := false
+			for _, q := range loop {
+				local, ok := m.local[q]
+				if ok && local.ParentID != folders[q].ParentID {
+					folders[q].ParentID = ""
+					if _, ok := folders[local.ParentID]; ok {
+						folders[q].ParentID = local.ParentID
+					}
+					undone = true
+					break
+				}
+			}
+			if !undone {
+				folders[loop[0]].ParentID = ""
+			}
+		}
+	}
+}
+
+// folderLoop returns the loop reached walking up from id, nil if the
+// walk reaches the root.
+func folderLoop(folders map[string]*db.Folder, id string) []string {
+	seen := map[string]bool{}
+	p := id
+	for p != "" && !seen[p] {
+		seen[p] = true
+		p = folders[p].ParentID
+	}
+	if p == "" {
+		return nil
+	}
+	loop := []string{p}
+	for q := folders[p].ParentID; q != p; q = folders[q].ParentID {
+		loop = append(loop, q)
+	}
+	return loop
+}
+
+// folderID maps a remote folder id onto the merged folders.
+func (m *FolderMerge) folderID(id string) string {
+	if mapped, ok := m.RemoteIDs[id]; ok {
+		return mapped
+	}
+	return id
+}
+
+// findLocal returns the merged folder named name directly under
+// parentID that exists locally.
+func (m *FolderMerge) findLocal(parentID, name string) *db.Folder {
+	for _, id := range sortFolderIDs(m.folders) {
+		f := m.folders[id]
+		if _, ok := m.local[id]; ok && f.ParentID == parentID && strings.EqualFold(f.Name, name) {
+			return f
+		}
+	}
+	return nil
+}
+
+func folderField(f *db.Folder, field string) string {
+	if field == "name" {
+		return f.Name
+	}
+	return f.ParentID
+}
+
+func setFolderField(f *db.Folder, field, value string) {
+	if field == "name" {
+		f.Name = value
+	} else {
+		f.ParentID = value
+	}
+}
+
+// sortFolders orders folders parents first, then by id.
+func sortFolders(folders map[string]*db.Folder) []db.Folder {
+	depth := func(f *db.Folder) int {
+		n := 0
+		for p := f.ParentID; p != ""; p = folders[p].ParentID {
+			n++
+		}
+		return n
+	}
+	out := make([]db.Folder, 0, len(folders))
+	for _, id := range sortFolderIDs(folders) {
+		out = append(out, *folders[id])
+	}
+	sort.SliceStable(out, func(i, j int) bool { return depth(&out[i]) < depth(&out[j]) })
+	return out
+}
+
+func sortFolderIDs(folders map[string]*db.Folder) []string {
+	ids := make([]string, 0, len(folders))
+	for id := range folders {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func foldersByID(folders []db.Folder) map[string]*db.Folder {
+	m := make(map[string]*db.Folder, len(folders))
+	for i := range folders {
+		m[folders[i].ID] = &folders[i]
+	}
+	return m
+}
@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"yap/internal/db"
+)
+
+func folder(id, parent, name string) db.Folder {
+	return db.Folder{ID: id, ParentID: parent, Name: name}
+}
+
+func TestMergeFolders(t *testing.T) {
+	base := []db.Folder{
+		folder("a", "", "A"),
+		folder("b", "", "B"),
+		folder("c", "", "C"),
+		folder("d", "", "D"),
+		folder("e", "", "E"),
+		folder("f", "", "F"),
+	}
+
+	tests := []struct {
+		name          string
+		local, remote []db.Folder
+		want          []db.Folder
+	}{
+		{
+			name:   "renamed locally",
+			local:  []db.Folder{folder("a", "", "A2")},
+			remote: []db.Folder{folder("a", "", "A")},
+			want:   []db.Folder{folder("a", "", "A2")},
+		},
+		{
+			name:   "renamed remotely",
+			local:  []db.Folder{folder("a", "", "A")},
+			remote: []db.Folder{folder("a", "", "A3")},
+			want:   []db.Folder{folder("a", "", "A3")},
+		},
+		{
+			name:   "moved locally, renamed remotely",
+			local:  []db.Folder{folder("a", "b", "A"), folder("b", "", "B")},
+			remote: []db.Folder{folder("a", "", "A3"), folder("b", "", "B")},
+			want:   []db.Folder{folder("b", "", "B"), folder("a", "b", "A3")},
+		},
+		{
+			name:   "moved remotely",
+			local:  []db.Folder{folder("a", "", "A"), folder("b", "", "B")},
+			remote: []db.Folder{folder("a", "b", "A"), folder("b", "", "B")},
+			want:   []db.Folder{folder("b", "", "B"), folder("a", "b", "A")},
+		},
+		{
+			name:   "deleted locally",
+			local:  []db.Folder{folder("b", "", "B")},
+			remote: []db.Folder{folder("a", "", "A"), folder("b", "", "B")},
+			want:   []db.Folder{folder("b", "", "B")},
+		},
+		{
+			name:   "deleted remotely, renamed locally",
+			local:  []db.Folder{folder("a", "", "A2"), folder("b", "", "B")},
+			remote: []db.Folder{folder("b", "", "B")},
+			want:   []db.Folder{folder("b", "", "B")},
+		},
+		{
+			name:   "deleted locally, remote filed a folder under it",
+			local:  []db.Folder{},
+			remote: []db.Folder{folder("a", "", "A"), folder("n", "a", "New")},
+			want:   []db.Folder{folder("a", "", "A"), folder("n", "a", "New")},
+		},
+		{
+			name:   "moved into each other",
+			local:  []db.Folder{folder("a", "b", "A"), folder("b", "", "B")},
+			remote: []db.Folder{folder("a", "", "A"), folder("b", "a", "B")},
+			want:   []db.Folder{folder("b", "", "B"), folder("a", "b", "A")},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Only the folders a case lists take part
+			var b []db.Folder
+			for _, f := range base {
+				for _, g := range append(tt.local, tt.remote...) {
+					if f.ID == g.ID {
+						b = append(b, f)
+						break
+					}
+				}
+			}
+			m := MergeFolders(b, tt.local, tt.remote)
+			if len(m.Conflicts) != 0 {
+				t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+			}
+			if got := m.Result(nil); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeFolders_DeletedFolderStillUsed(t *testing.T) {
+	base := []db.Folder{folder("a", "", "A"), folder("b", "", "B")}
+	local := []db.Folder{folder("b", "", "B")}
+	remote := []db.Folder{folder("a", "", "A")}
+
+	entries := []db.Entry{
+		{ID: "live", FolderID: "a"},
+		{ID: "trashed", FolderID: "b", DeletedAt: 1},
+	}
+	got := MergeFolders(base, local, remote).Result(entries)
+	if want := []db.Folder{folder("a", "", "A")}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+	if entries[0].FolderID != "a" || entries[1].FolderID != "" {
+		t.Fatalf("unexpected entry folders %+v", entries)
+	}
+}
+
+func TestMergeFolders_Conflicts(t *testing.T) {
+	base := []db.Folder{folder("a", "", "A"), folder("b", "", "B"), folder("c", "", "C")}
+	local := []db.Folder{folder("a", "b", "Local"), folder("b", "", "B"), folder("c", "", "C")}
+	remote := []db.Folder{folder("a", "c", "Remote"), folder("b", "", "B"), folder("c", "", "C")}
+
+	m := MergeFolders(base, local, remote)
+	if len(m.Conflicts) != 2 || m.Conflicts[0].Field != "name" || m.Conflicts[1].Field != "parent" {
+		t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+	}
+	if got := m.Result(nil)[2]; got != folder("a", "b", "Local") {
+		t.Fatalf("conflicts must default to local, got %+v", got)
+	}
+
+	m.Choose(0, true)
+	m.Choose(1, true)
+	if got := m.Result(nil)[2]; got != folder("a", "c", "Remote") {
+		t.Fatalf("remote choices not applied, got %+v", got)
+	}
+}
+
+func TestMergeFolders_AddedOnBothSides(t *testing.T) {
+	local := []db.Folder{folder("l1", "", "Work"), folder("l2", "l1", "Email")}
+	remote := []db.Folder{folder("r2", "r1", "email"), folder("r1", "", "work"), folder("r3", "r1", "Chat")}
+
+	m := MergeFolders(nil, local, remote)
+	if want := map[string]string{"r1": "l1", "r2": "l2"}; !reflect.DeepEqual(m.RemoteIDs, want) {
+		t.Fatalf("got ids %v, want %v", m.RemoteIDs, want)
+	}
+	want := []db.Folder{folder("l1", "", "Work"), folder("l2", "l1", "Email"), folder("r3", "l1", "Chat")}
+	if got := m.Result(nil); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,349 @@
+/*
+* Git sync layer (untrusted transport)
+*
+* Git only moves ciphertext. This package never decides whether a vault
+* is acceptable; callers verify what Git hands them before applying it.
+*
+* Rules
+* - single branch, fast-forward only, no merges
+* - only the vault file is ever staged or committed
+* - commit messages are neutral and carry no vault metadata
+* */
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	yerrors "yap/internal/errors"
+)
+
+const (
+	DefaultRemote = "origin"
+	CommitMessage = "Update vault"
+
+	// Used only when the repository has no committer identity configured
+	fallbackName  = "yap"
+	fallbackEmail = "yap@localhost"
+)
+
+// Repo is a Git work tree holding a vault file.
+type Repo struct {
+	dir      string // work tree root
+	vaultRel string // vault path relative to dir, slash separated
+
+	Remote string
+	Branch string
+}
+
+// Status describes the local branch relative to its remote.
+type Status struct {
+	Branch       string
+	Remote       string
+	Head         string // empty before the first commit
+	RemoteHead   string // empty if the remote branch does not exist
+	Ahead        int
+	Behind       int
+	VaultChanged bool // vault differs from HEAD
+}
+
+// Diverged reports whether local and remote both have commits the other lacks.
+func (s *Status) Diverged() bool {
+	return s.Ahead > 0 && s.Behind > 0
+}
+
+// OpenRepo locates the work tree containing vaultPath. repoDir may be
+// empty, in which case the vault's directory is used.
+func OpenRepo(repoDir, vaultPath string) (*Repo, error) {
+	if repoDir == "" {
+		repoDir = filepath.Dir(vaultPath)
+	}
+
+	top, err := runGit(repoDir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s is not a git repository: %w", yerrors.ErrConfig, repoDir, err)
+	}
+	top, err = filepath.EvalSymlinks(top)
+	if err != nil {
+		return nil, err
+	}
+
+	absVault, err := filepath.Abs(vaultPath)
+	if err != nil {
+		return nil, err
+	}
+	// Resolve the directory only; the vault file itself may not exist yet
+	vaultDir, err := filepath.EvalSymlinks(filepath.Dir(absVault))
+	if err != nil {
+		return nil, err
+	}
+	rel, err := filepath.Rel(top, filepath.Join(vaultDir, filepath.Base(absVault)))
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return nil, fmt.Errorf("%w: vault %s is outside repository %s", yerrors.ErrConfig, vaultPath, top)
+	}
+
+	r := &Repo{
+		dir:      top,
+		vaultRel: filepath.ToSlash(rel),
+		Remote:   DefaultRemote,
+	}
+
+	branch, err := r.git("symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return nil, fmt.Errorf("%w: detached HEAD is not supported", yerrors.ErrConfig)
+	}
+	r.Branch = branch
+
+	return r, nil
+}
+
+func (r *Repo) Dir() string {
+	return r.dir
+}
+
+// VaultPath returns the vault path relative to the work tree.
+func (r *Repo) VaultPath() string {
+	return r.vaultRel
+}
+
+// Exclude lists files kept beside the vault, like conflict copies and
+// the rekey journal, in the repository's info/exclude so they are never
+// shown as untracked or committed by hand. Only base names are used.
+func (r *Repo) Exclude(paths ...string) error {
+	file, err := r.git("rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(r.dir, file)
+	}
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	have := make(map[string]bool)
+	for _, line := range strings.Split(string(data), "\n") {
+		have[line] = true
+	}
+	var add []string
+	for _, p := range paths {
+		pattern := "/" + excludePattern(path.Join(path.Dir(r.vaultRel), filepath.Base(p)))
+		if !have[pattern] {
+			have[pattern] = true
+			add = append(add, pattern)
+		}
+	}
+	if len(add) == 0 {
+		return nil
+	}
+
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		data = append(data, '\n')
+	}
+	data = append(data, strings.Join(add, "\n")+"\n"...)
+	if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(file, data, 0o644)
+}
+
+// excludePattern escapes the characters gitignore patterns treat
+// specially, so rel matches only itself.
+func excludePattern(rel string) string {
+	var b strings.Builder
+	for _, c := range rel {
+		if strings.ContainsRune(`\*?[`, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	p := b.String()
+	if strings.HasSuffix(p, " ") {
+		p = p[:len(p)-1] + `\ `
+	}
+	return p
+}
+
+// remoteRef is the remote-tracking ref for the sync branch.
+func (r *Repo) remoteRef() string {
+	return "refs/remotes/" + r.Remote + "/" + r.Branch
+}
+
+// Fetch updates the remote-tracking ref. It reports false if the remote
+// branch does not exist yet.
+func (r *Repo) Fetch() (bool, error) {
+	out, err := r.git("ls-remote", "--heads", r.Remote, r.Branch)
+	if err != nil {
+		return false, fmt.Errorf("fetch failed: %w", err)
+	}
+	if out == "" {
+		return false, nil
+	}
+
+	refspec := "+refs/heads/" + r.Branch + ":" + r.remoteRef()
+	if _, err := r.git("fetch", "--quiet", r.Remote, refspec); err != nil {
+		return false, fmt.Errorf("fetch failed: %w", err)
+	}
+	return true, nil
+}
+
+// Status reports ahead/behind counts against the last fetched remote
+// state. Call Fetch first for an up to date answer.
+func (r *Repo) Status() (*Status, error) {
+	s := &Status{Branch: r.Branch, Remote: r.Remote}
+
+	s.Head, _ = r.revParse("HEAD")
+	s.RemoteHead, _ = r.revParse(r.remoteRef())
+
+	changed, err := r.vaultChanged()
+	if err != nil {
+		return nil, err
+	}
+	s.VaultChanged = changed
+
+	switch {
+	case s.Head == "" && s.RemoteHead == "":
+	case s.Head == "":
+		n, err := r.countCommits(s.RemoteHead)
+		if err != nil {
+			return nil, err
+		}
+		s.Behind = n
+	case s.RemoteHead == "":
+		n, err := r.countCommits(s.Head)
+		if err != nil {
+			return nil, err
+		}
+		s.Ahead = n
+	default:
+		out, err := r.git("rev-list", "--left-right", "--count", s.Head+"..."+s.RemoteHead)
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(out)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("unexpected rev-list output: %q", out)
+		}
+		s.Ahead, _ = strconv.Atoi(fields[0])
+		s.Behind, _ = strconv.Atoi(fields[1])
+	}
+
+	return s, nil
+}
+
+// CommitVault stages and commits only the vault file. It reports false
+// when there was nothing to commit.
+func (r *Repo) CommitVault() (bool, error) {
+	changed, err := r.vaultChanged()
+	if err != nil || !changed {
+		return false, err
+	}
+
+	if _, err := r.git("add", "--", r.vaultRel); err != nil {
+		return false, fmt.Errorf("git add failed: %w", err)
+	}
+
+	args := r.identityArgs()
+	args = append(args, "commit", "--quiet", "--no-verify", "-m", CommitMessage, "--only", "--", r.vaultRel)
+	if _, err := r.git(args...); err != nil {
+		return false, fmt.Errorf("git commit failed: %w", err)
+	}
+	return true, nil
+}
+
+// RemoteVault returns the committed vault bytes at the remote-tracking ref.
+func (r *Repo) RemoteVault() ([]byte, error) {
+	return r.showBlob(r.remoteRef())
+}
+
+// FastForward moves the branch to the remote-tracking ref. Anything but
+// a fast-forward is divergence and is refused.
+func (r *Repo) FastForward() error {
+	if _, err := r.git("merge", "--quiet", "--ff-only", r.remoteRef()); err != nil {
+		return fmt.Errorf("%w: cannot fast-forward to %s/%s", yerrors.ErrDiverged, r.Remote, r.Branch)
+	}
+	return nil
+}
+
+// Push publishes the branch. Git itself refuses anything but a
+// fast-forward of the remote branch; it is never forced.
+func (r *Repo) Push() error {
+	if _, err := r.git("push", "--quiet", r.Remote, "HEAD:refs/heads/"+r.Branch); err != nil {
+		return fmt.Errorf("%w: push rejected: %w", yerrors.ErrDiverged, err)
+	}
+
+	if _, err := r.git("update-ref", r.remoteRef(), "HEAD"); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (r *Repo) vaultChanged() (bool, error) {
+	out, err := r.git("status", "--porcelain", "--untracked-files=all", "--", r.vaultRel)
+	if err != nil {
+		return false, err
+	}
+	return out != "", nil
+}
+
+func (r *Repo) showBlob(rev string) ([]byte, error) {
+	cmd := exec.Command("git", "-C", r.dir, "show", rev+":"+r.vaultRel)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%w: no vault at %s: %s", yerrors.ErrNotFound, rev, strings.TrimSpace(stderr.String()))
+	}
+	return out, nil
+}
+
+func (r *Repo) revParse(rev string) (string, error) {
+	return r.git("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+}
+
+func (r *Repo) countCommits(rev string) (int, error) {
+	out, err := r.git("rev-list", "--count", rev)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(out)
+}
+
+// identityArgs supplies a neutral committer when none is configured.
+func (r *Repo) identityArgs() []string {
+	if email, _ := r.git("config", "user.email"); email != "" {
+		return nil
+	}
+	return []string{"-c", "user.name=" + fallbackName, "-c", "user.email=" + fallbackEmail}
+}
+
+func (r *Repo) git(args ...string) (string, error) {
+	return runGit(r.dir, args...)
+}
+
+func runGit(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			msg := strings.TrimSpace(stderr.String())
+			if msg == "" {
+				msg = exitErr.Error()
+			}
+			return "", fmt.Errorf("git %s: %s", args[0], msg)
+		}
+		return "", err
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
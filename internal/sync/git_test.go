@@ -0,0 +1,231 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	yerrors "yap/internal/errors"
+)
+
+// gitEnv isolates tests from the user's git configuration.
+func gitEnv(t *testing.T) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+}
+
+func mustGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	out, err := runGit(dir, args...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// newRemote creates a bare repository and returns its path.
+func newRemote(t *testing.T) string {
+	t.Helper()
+	dir := filepath.Join(t.TempDir(), "remote.git")
+	mustGit(t, t.TempDir(), "init", "--quiet", "--bare", "-b", "main", dir)
+	return dir
+}
+
+// newClone creates a work tree on branch main tracking remote.
+func newClone(t *testing.T, remote string) *Repo {
+	t.Helper()
+	dir := t.TempDir()
+	mustGit(t, dir, "init", "--quiet", "-b", "main")
+	mustGit(t, dir, "remote", "add", DefaultRemote, remote)
+
+	r, err := OpenRepo(dir, filepath.Join(dir, "vault.yap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func writeVault(t *testing.T, r *Repo, data string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(r.Dir(), r.VaultPath()), []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fetchStatus(t *testing.T, r *Repo) *Status {
+	t.Helper()
+	if _, err := r.Fetch(); err != nil {
+		t.Fatal(err)
+	}
+	st, err := r.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func TestPushPullRoundTrip(t *testing.T) {
+	gitEnv(t)
+	remote := newRemote(t)
+	a := newClone(t, remote)
+	b := newClone(t, remote)
+
+	// Nothing on the remote yet
+	if exists, err := b.Fetch(); err != nil || exists {
+		t.Fatalf("expected missing remote branch, got %v %v", exists, err)
+	}
+
+	writeVault(t, a, "v1")
+	committed, err := a.CommitVault()
+	if err != nil || !committed {
+		t.Fatalf("commit: %v %v", committed, err)
+	}
+	if st := fetchStatus(t, a); st.Ahead != 1 || st.Behind != 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	if err := a.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	st := fetchStatus(t, b)
+	if st.Behind != 1 || st.Ahead != 0 {
+		t.Fatalf("unexpected status %+v", st)
+	}
+	data, err := b.RemoteVault()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "v1" {
+		t.Fatalf("remote vault = %q", data)
+	}
+	if err := b.FastForward(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(filepath.Join(b.Dir(), b.VaultPath()))
+	if err != nil || string(got) != "v1" {
+		t.Fatalf("fast-forward did not apply: %q %v", got, err)
+	}
+}
+
+func TestExclude(t *testing.T) {
+	gitEnv(t)
+	dir := t.TempDir()
+	mustGit(t, dir, "init", "--quiet", "-b", "main")
+	sub := filepath.Join(dir, "vaults [x]")
+	if err := os.Mkdir(sub, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	r, err := OpenRepo(dir, filepath.Join(sub, "vault.yap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scratch := []string{filepath.Join(sub, "vault.yap.local"), filepath.Join(sub, "vault.yap.rekey")}
+	for _, p := range scratch {
+		if err := os.WriteFile(p, []byte("x"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Unescaped, "[x]" would also match this directory
+	decoy := filepath.Join(dir, "vaults x")
+	if err := os.Mkdir(decoy, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(decoy, "vault.yap.local"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for range 2 {
+		if err := r.Exclude(scratch...); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if out := mustGit(t, dir, "status", "--porcelain", "--untracked-files=all"); out != `?? "vaults x/vault.yap.local"` {
+		t.Fatalf("unexpected untracked files %q", out)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, ".git", "info", "exclude"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := bytes.Count(data, []byte("/vaults \\[x]/vault.yap.local\n")); n != 1 {
+		t.Fatalf("expected the pattern once, found %d times in:\n%s", n, data)
+	}
+}
+
+func TestCommitVault_OnlyStagesVault(t *testing.T) {
+	gitEnv(t)
+	r := newClone(t, newRemote(t))
+
+	writeVault(t, r, "v1")
+	if err := os.WriteFile(filepath.Join(r.Dir(), "other.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.CommitVault(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := mustGit(t, r.Dir(), "ls-tree", "--name-only", "HEAD")
+	if files != "vault.yap" {
+		t.Fatalf("unexpected tree %q", files)
+	}
+	if msg := mustGit(t, r.Dir(), "log", "-1", "--format=%s"); msg != CommitMessage {
+		t.Fatalf("unexpected message %q", msg)
+	}
+
+	// Unchanged vault is a no-op
+	if committed, err := r.CommitVault(); err != nil || committed {
+		t.Fatalf("expected no commit, got %v %v", committed, err)
+	}
+}
+
+func TestDivergenceRefused(t *testing.T) {
+	gitEnv(t)
+	remote := newRemote(t)
+	a := newClone(t, remote)
+	b := newClone(t, remote)
+
+	writeVault(t, a, "a1")
+	a.CommitVault()
+	if err := a.Push(); err != nil {
+		t.Fatal(err)
+	}
+
+	writeVault(t, b, "b1")
+	b.CommitVault()
+	st := fetchStatus(t, b)
+	if !st.Diverged() {
+		t.Fatalf("expected divergence, got %+v", st)
+	}
+	if err := b.FastForward(); !errors.Is(err, yerrors.ErrDiverged) {
+		t.Fatalf("expected ErrDiverged from fast-forward, got %v", err)
+	}
+	if err := b.Push(); !errors.Is(err, yerrors.ErrDiverged) {
+		t.Fatalf("expected ErrDiverged from push, got %v", err)
+	}
+
+	// Remote is untouched
+	data, err := a.RemoteVault()
+	if err != nil || !bytes.Equal(data, []byte("a1")) {
+		t.Fatalf("remote changed: %q %v", data, err)
+	}
+}
+
+func TestOpenRepo_Rejects(t *testing.T) {
+	gitEnv(t)
+
+	plain := t.TempDir()
+	if _, err := OpenRepo(plain, filepath.Join(plain, "vault.yap")); !errors.Is(err, yerrors.ErrConfig) {
+		t.Fatalf("expected ErrConfig outside a repo, got %v", err)
+	}
+
+	r := newClone(t, newRemote(t))
+	if _, err := OpenRepo(r.Dir(), filepath.Join(t.TempDir(), "vault.yap")); !errors.Is(err, yerrors.ErrConfig) {
+		t.Fatalf("expected ErrConfig for vault outside repo, got %v", err)
+	}
+}
@@ -0,0 +1,165 @@
+package sync
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	yerrors "yap/internal/errors"
+	"yap/internal/vault"
+)
+
+/*
+* History rewrite
+*
+* Every commit keeps a full vault ciphertext, so after a rekey the old
+* Vault Key still opens everything before it. Purging rewrites the
+* branch so those blobs are no longer reachable:
+*
+* 	keep-from  the first commit whose vault version is >= N becomes the
+* 	           new root; later commits are replayed on top of it
+* 	squash     one commit holding the current tree
+*
+* Trees are reused unchanged, so the new head holds exactly the current
+* vault. Rewritten commits keep their author and message.
+* */
+
+// HistoryCommit is one first-parent commit on the sync branch.
+type HistoryCommit struct {
+	Hash         string
+	VaultVersion uint64 // 0 if the commit holds no vault
+	KeyEpoch     uint64
+}
+
+// VaultHistory lists first-parent commits of HEAD, oldest first, with
+// the plaintext header of the vault each one holds.
+func (r *Repo) VaultHistory() ([]HistoryCommit, error) {
+	out, err := r.git("rev-list", "--first-parent", "--reverse", "refs/heads/"+r.Branch)
+	if err != nil {
+		return nil, fmt.Errorf("%w: branch has no commits", yerrors.ErrNotFound)
+	}
+
+	var history []HistoryCommit
+	for _, hash := range strings.Fields(out) {
+		c := HistoryCommit{Hash: hash}
+		data, err := r.showBlob(hash)
+		if err == nil {
+			vf, err := vault.DecodeFile(data)
+			if err != nil {
+				return nil, fmt.Errorf("commit %s: %w", hash, err)
+			}
+			c.VaultVersion = vf.Header.VaultVersion
+			c.KeyEpoch = vf.Header.KeyEpoch
+		} else if !errors.Is(err, yerrors.ErrNotFound) {
+			return nil, err
+		}
+		history = append(history, c)
+	}
+	return history, nil
+}
+
+// RewriteHistory builds a new chain of commits starting at history[from]
+// (or a single commit when squash is set) and returns its head. Refs are
+// not touched; see AdoptRewrite.
+func (r *Repo) RewriteHistory(history []HistoryCommit, from int, squash bool) (string, error) {
+	if len(history) == 0 || from < 0 || from >= len(history) {
+		return "", fmt.Errorf("invalid rewrite range")
+	}
+
+	if squash {
+		head := history[len(history)-1].Hash
+		args := append(r.identityArgs(), "commit-tree", "-m", CommitMessage, head+"^{tree}")
+		return r.git(args...)
+	}
+
+	parent := ""
+	for _, c := range history[from:] {
+		hash, err := r.replayCommit(c.Hash, parent)
+		if err != nil {
+			return "", err
+		}
+		parent = hash
+	}
+	return parent, nil
+}
+
+// replayCommit recreates commit with the same tree, author and message on
+// top of parent (a root commit when parent is empty).
+func (r *Repo) replayCommit(commit, parent string) (string, error) {
+	meta, err := r.git("log", "-1", "--format=%an%x00%ae%x00%ad", "--date=raw", commit)
+	if err != nil {
+		return "", err
+	}
+	author := strings.Split(meta, "\x00")
+	if len(author) != 3 {
+		return "", fmt.Errorf("unexpected author of %s", commit)
+	}
+	msg, err := r.git("log", "-1", "--format=%B", commit)
+	if err != nil {
+		return "", err
+	}
+
+	args := append([]string{"-C", r.dir}, r.identityArgs()...)
+	args = append(args, "commit-tree", commit+"^{tree}", "-m", msg)
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+
+	cmd := exec.Command("git", args...)
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME="+author[0],
+		"GIT_AUTHOR_EMAIL="+author[1],
+		"GIT_AUTHOR_DATE="+author[2],
+	)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git commit-tree: %s", strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// VaultAt returns the vault bytes held by commit.
+func (r *Repo) VaultAt(commit string) ([]byte, error) {
+	return r.showBlob(commit)
+}
+
+// ForcePushArgs is the exact git invocation ForcePush runs. The lease
+// makes it fail if the remote moved since it was last fetched.
+func (r *Repo) ForcePushArgs(newHead, remoteHead string) []string {
+	return []string{
+		"push",
+		"--force-with-lease=refs/heads/" + r.Branch + ":" + remoteHead,
+		r.Remote,
+		newHead + ":refs/heads/" + r.Branch,
+	}
+}
+
+// ForcePush replaces the remote branch with newHead.
+func (r *Repo) ForcePush(newHead, remoteHead string) error {
+	if _, err := r.git(r.ForcePushArgs(newHead, remoteHead)...); err != nil {
+		return fmt.Errorf("%w: force push rejected: %w", yerrors.ErrDiverged, err)
+	}
+	return nil
+}
+
+// AdoptRewrite points the branch and its remote-tracking ref at newHead
+// and prunes the old objects from the local repository.
+func (r *Repo) AdoptRewrite(newHead string) error {
+	if _, err := r.git("update-ref", "refs/heads/"+r.Branch, newHead); err != nil {
+		return err
+	}
+	if _, err := r.git("update-ref", r.remoteRef(), newHead); err != nil {
+		return err
+	}
+	if _, err := r.git("reflog", "expire", "--expire=now", "--all"); err != nil {
+		return err
+	}
+	if _, err := r.git("gc", "--quiet", "--prune=now"); err != nil {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,375 @@
+package sync
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"yap/internal/db"
+)
+
+/*
+* Three-way entry merge
+*
+* base is the vault at the last common commit. Per entry ID:
+*
+* 	changed on one side only  -> take that side
+* 	changed on both, same way -> take it
+* 	same field changed twice  -> conflict (defaults to local)
+* 	deleted vs unchanged      -> delete
+* 	deleted vs modified       -> conflict (defaults to local)
+* 	deleted vs trashed        -> delete
+*
+* A trashed entry is a tombstone: its "deleted" field changed like any
+* other, so trashing on one side merges with edits on the other and the
+* entry is not brought back. Two trash times count as the same change.
+*
+* Changes are detected by comparing fields, never by updated_at alone:
+* timestamps have second resolution. A merged entry takes the newer
+* updated_at of its two sides.
+* */
+
+// entryFields are the fixed user-visible columns compared field by field.
+// The folder is compared by id. Tags, custom fields and typed values are
+// compared one by one, as "tag:<tag>", "field:<name>" and "data:<name>",
+// so additions on both sides merge cleanly. "deleted" is the trash time.
+var entryFields = []string{"title", "username", "password", "url", "notes", "totp", "type", "folder", "favorite", "deleted"}
+
+const (
+	tagFieldPrefix    = "tag:"
+	customFieldPrefix = "field:"
+	dataFieldPrefix   = "data:"
+)
+
+// fieldNames returns entryFields followed by every tag and custom field
+// of entries. Tags and field names match case-insensitively.
+func fieldNames(entries ...*db.Entry) []string {
+	names := append([]string(nil), entryFields...)
+	seen := map[string]bool{}
+	add := func(name string) {
+		if key := strings.ToLower(name); !seen[key] {
+			seen[key] = true
+			names = append(names, name)
+		}
+	}
+	for _, e := range entries {
+		for _, t := range e.Tags {
+			add(tagFieldPrefix + t)
+		}
+	}
+	for _, e := range entries {
+		for _, f := range e.Fields {
+			add(customFieldPrefix + f.Name)
+		}
+	}
+	var data []string
+	for _, e := range entries {
+		for name := range e.Data {
+			data = append(data, dataFieldPrefix+name)
+		}
+	}
+	sort.Strings(data)
+	for _, name := range data {
+		add(name)
+	}
+	return names
+}
+
+// getField returns field name of e as a string; "" for an absent tag or
+// custom field.
+func getField(e *db.Entry, name string) string {
+	switch name {
+	case "title":
+		return e.Title
+	case "username":
+		return e.Username
+	case "password":
+		return e.Password
+	case "url":
+		return e.URL
+	case "notes":
+		return e.Notes
+	case "totp":
+		return e.TOTP
+	case "type":
+		if e.Type == "" {
+			return string(db.TypeLogin)
+		}
+		return string(e.Type)
+	case "folder":
+		return e.FolderID
+	case "favorite":
+		if e.Favorite {
+			return "true"
+		}
+		return ""
+	case "deleted":
+		if e.DeletedAt == 0 {
+			return ""
+		}
+		return strconv.FormatInt(e.DeletedAt, 10)
+	}
+	if tag, ok := strings.CutPrefix(name, tagFieldPrefix); ok {
+		for _, t := range e.Tags {
+			if strings.EqualFold(t, tag) {
+				return "true"
+			}
+		}
+		return ""
+	}
+	if field, ok := strings.CutPrefix(name, customFieldPrefix); ok {
+		for _, f := range e.Fields {
+			if strings.EqualFold(f.Name, field) {
+				// The kind is part of the value; it is never empty
+				return string(f.Kind) + "\x00" + f.Value
+			}
+		}
+		return ""
+	}
+	if data, ok := strings.CutPrefix(name, dataFieldPrefix); ok {
+		return e.Data[data]
+	}
+	panic("unknown entry field " + name)
+}
+
+// setField sets field name of e from a getField value. Tags and custom
+// fields are copied, never modified in place: merged entries share them.
+func setField(e *db.Entry, name, value string) {
+	switch name {
+	case "title":
+		e.Title = value
+	case "username":
+		e.Username = value
+	case "password":
+		e.Password = value
+	case "url":
+		e.URL = value
+	case "notes":
+		e.Notes = value
+	case "totp":
+		e.TOTP = value
+	case "type":
+		e.Type = db.EntryType(value)
+	case "folder":
+		e.FolderID = value
+	case "favorite":
+		e.Favorite = value != ""
+	case "deleted":
+		e.DeletedAt, _ = strconv.ParseInt(value, 10, 64)
+	default:
+		if tag, ok := strings.CutPrefix(name, tagFieldPrefix); ok {
+			var tags []string
+			for _, t := range e.Tags {
+				if !strings.EqualFold(t, tag) {
+					tags = append(tags, t)
+				}
+			}
+			if value != "" {
+				tags = append(tags, tag)
+			}
+			e.Tags = tags
+			return
+		}
+		if field, ok := strings.CutPrefix(name, customFieldPrefix); ok {
+			var fields []db.CustomField
+			replaced := false
+			for _, f := range e.Fields {
+				if !strings.EqualFold(f.Name, field) {
+					fields = append(fields, f)
+					continue
+				}
+				if value != "" {
+					kind, v, _ := strings.Cut(value, "\x00")
+					fields = append(fields, db.CustomField{Name: f.Name, Kind: db.FieldKind(kind), Value: v})
+				}
+				replaced = true
+			}
+			if !replaced && value != "" {
+				kind, v, _ := strings.Cut(value, "\x00")
+				fields = append(fields, db.CustomField{Name: field, Kind: db.FieldKind(kind), Value: v})
+			}
+			e.Fields = fields
+			return
+		}
+		if data, ok := strings.CutPrefix(name, dataFieldPrefix); ok {
+			values := make(map[string]string, len(e.Data))
+			for k, v := range e.Data {
+				values[k] = v
+			}
+			if value != "" {
+				values[data] = value
+			} else {
+				delete(values, data)
+			}
+			e.Data = values
+			return
+		}
+		panic("unknown entry field " + name)
+	}
+}
+
+// MergeConflict is a change both sides made incompatibly. An empty
+// Field means the entry was deleted on one side and modified on the other.
+type MergeConflict struct {
+	EntryID string
+	Title   string
+	Field   string
+	Local   *db.Entry // nil if deleted locally
+	Remote  *db.Entry // nil if deleted remotely
+}
+
+// Merge is the result of ThreeWayMerge. Conflicts hold local values
+// until Choose picks the remote side.
+type Merge struct {
+	entries   map[string]*db.Entry // nil means deleted
+	Conflicts []MergeConflict
+}
+
+// ThreeWayMerge merges local and remote entry sets against base.
+func ThreeWayMerge(base, local, remote []db.Entry) *Merge {
+	b, l, r := byID(base), byID(local), byID(remote)
+	m := &Merge{entries: map[string]*db.Entry{}}
+
+	ids := map[string]struct{}{}
+	for _, set := range []map[string]*db.Entry{b, l, r} {
+		for id := range set {
+			ids[id] = struct{}{}
+		}
+	}
+	sorted := make([]string, 0, len(ids))
+	for id := range ids {
+		sorted = append(sorted, id)
+	}
+	sort.Strings(sorted)
+
+	for _, id := range sorted {
+		m.mergeEntry(id, b[id], l[id], r[id])
+	}
+	return m
+}
+
+func (m *Merge) mergeEntry(id string, base, local, remote *db.Entry) {
+	switch {
+	case local == nil && remote == nil:
+		m.entries[id] = nil
+
+	case local == nil || remote == nil:
+		side := local
+		if side == nil {
+			side = remote
+		}
+		switch {
+		case side.DeletedAt != 0:
+			// Trashed on one side, purged on the other
+			m.entries[id] = nil
+		case base == nil:
+			// Added on one side
+			m.entries[id] = side
+		case !modified(base, side):
+			// Deleted on the other side, untouched here
+			m.entries[id] = nil
+		default:
+			m.entries[id] = local
+			m.Conflicts = append(m.Conflicts, MergeConflict{
+				EntryID: id, Title: side.Title, Local: local, Remote: remote,
+			})
+		}
+
+	default:
+		if base == nil {
+			base = &db.Entry{ID: id}
+		}
+		switch {
+		case !modified(base, remote):
+			m.entries[id] = local
+			return
+		case !modified(base, local):
+			m.entries[id] = remote
+			return
+		}
+
+		merged := *local
+		merged.UpdatedAt = max(local.UpdatedAt, remote.UpdatedAt)
+		for _, f := range fieldNames(base, local, remote) {
+			lv, rv, bv := getField(local, f), getField(remote, f), getField(base, f)
+			switch {
+			case lv == rv, rv == bv:
+			case f == "deleted" && lv != "" && rv != "":
+				// Trashed on both sides; keep the local time
+			case lv == bv:
+				setField(&merged, f, rv)
+			default:
+				m.Conflicts = append(m.Conflicts, MergeConflict{
+					EntryID: id, Title: local.Title, Field: f, Local: local, Remote: remote,
+				})
+			}
+		}
+		pruneData(&merged)
+		m.entries[id] = &merged
+	}
+}
+
+// Choose resolves conflict i. Local is already applied, so only a
+// remote choice changes the result.
+func (m *Merge) Choose(i int, useRemote bool) {
+	if !useRemote {
+		return
+	}
+
+	c := m.Conflicts[i]
+	if c.Field == "" {
+		m.entries[c.EntryID] = c.Remote
+		return
+	}
+
+	merged := *m.entries[c.EntryID]
+	setField(&merged, c.Field, getField(c.Remote, c.Field))
+	if c.Field == "type" {
+		// The typed values go with the type
+		for _, f := range fieldNames(&merged, c.Remote) {
+			if strings.HasPrefix(f, dataFieldPrefix) {
+				setField(&merged, f, getField(c.Remote, f))
+			}
+		}
+	}
+	pruneData(&merged)
+	m.entries[c.EntryID] = &merged
+}
+
+// pruneData drops typed values that the type of e does not have. They
+// come from the other side of a type change.
+func pruneData(e *db.Entry) {
+	known := map[string]bool{}
+	for _, f := range db.TypeFields(db.EntryType(getField(e, "type"))) {
+		known[f.Name] = true
+	}
+	for name := range e.Data {
+		if !known[name] {
+			setField(e, dataFieldPrefix+name, "")
+		}
+	}
+}
+
+// Result returns the merged entries ordered by ID.
+func (m *Merge) Result() []db.Entry {
+	out := make([]db.Entry, 0, len(m.entries))
+	for _, e := range m.entries {
+		if e != nil {
+			out = append(out, *e)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// modified reports whether e differs from its base version.
+func modified(base, e *db.Entry) bool {
+	return len(ChangedFields(*base, *e)) > 0
+}
+
+func byID(entries []db.Entry) map[string]*db.Entry {
+	m := make(map[string]*db.Entry, len(entries))
+	for i := range entries {
+		m[entries[i].ID] = &entries[i]
+	}
+	return m
+}
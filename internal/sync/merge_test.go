@@ -0,0 +1,186 @@
+package sync
+
+import (
+	"testing"
+	"yap/internal/db"
+)
+
+func TestThreeWayMerge(t *testing.T) {
+	base := []db.Entry{
+		{ID: "edit-both", Title: "Shared", Password: "p0", URL: "u0", UpdatedAt: 1},
+		{ID: "del-local", Title: "Old", UpdatedAt: 1},
+		{ID: "del-mod", Title: "Contested", Password: "p0", UpdatedAt: 1},
+	}
+	local := []db.Entry{
+		{ID: "edit-both", Title: "Shared", Password: "p-local", URL: "u0", UpdatedAt: 2},
+		{ID: "del-mod", Title: "Contested", Password: "p0", UpdatedAt: 1},
+		{ID: "new-local", Title: "Local"},
+	}
+	remote := []db.Entry{
+		{ID: "edit-both", Title: "Shared", Password: "p-remote", URL: "u-remote", UpdatedAt: 3},
+		{ID: "del-local", Title: "Old", UpdatedAt: 1},
+		{ID: "new-remote", Title: "Remote"},
+	}
+	// del-mod: untouched locally, deleted remotely -> deleted
+	// del-local: deleted locally, untouched remotely -> deleted
+
+	m := ThreeWayMerge(base, local, remote)
+	if len(m.Conflicts) != 1 || m.Conflicts[0].EntryID != "edit-both" || m.Conflicts[0].Field != "password" {
+		t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+	}
+
+	got := map[string]db.Entry{}
+	for _, e := range m.Result() {
+		got[e.ID] = e
+	}
+	if len(got) != 3 {
+		t.Fatalf("unexpected result %+v", got)
+	}
+	for _, id := range []string{"edit-both", "new-local", "new-remote"} {
+		if _, ok := got[id]; !ok {
+			t.Fatalf("missing %s in %+v", id, got)
+		}
+	}
+
+	shared := got["edit-both"]
+	if shared.Password != "p-local" || shared.URL != "u-remote" || shared.UpdatedAt != 3 {
+		t.Fatalf("unexpected merged entry %+v", shared)
+	}
+
+	m.Choose(0, true)
+	for _, e := range m.Result() {
+		if e.ID == "edit-both" && (e.Password != "p-remote" || e.URL != "u-remote") {
+			t.Fatalf("remote choice not applied: %+v", e)
+		}
+	}
+}
+
+func TestThreeWayMerge_DeleteVersusModify(t *testing.T) {
+	base := []db.Entry{{ID: "x", Title: "X", Password: "p0"}}
+	local := []db.Entry{{ID: "x", Title: "X", Password: "p1"}}
+
+	m := ThreeWayMerge(base, local, nil)
+	if len(m.Conflicts) != 1 || m.Conflicts[0].Field != "" || m.Conflicts[0].Remote != nil {
+		t.Fatalf("expected delete/modify conflict, got %+v", m.Conflicts)
+	}
+	if len(m.Result()) != 1 {
+		t.Fatal("local modification must be kept by default")
+	}
+
+	m.Choose(0, true)
+	if len(m.Result()) != 0 {
+		t.Fatal("remote deletion not applied")
+	}
+}
+
+// Trashed entries are tombstones: an edit on the other side does not
+// bring them back.
+func TestThreeWayMerge_Trash(t *testing.T) {
+	base := []db.Entry{{ID: "x", Title: "X", Password: "p0"}, {ID: "y", Title: "Y"}, {ID: "z", Title: "Z"}}
+	local := []db.Entry{
+		{ID: "x", Title: "X", Password: "p0", DeletedAt: 100},
+		{ID: "y", Title: "Y", DeletedAt: 100},
+		{ID: "z", Title: "Z", DeletedAt: 100},
+	}
+	remote := []db.Entry{
+		{ID: "x", Title: "X", Password: "p1"},
+		{ID: "y", Title: "Y", DeletedAt: 200},
+	}
+
+	m := ThreeWayMerge(base, local, remote)
+	if len(m.Conflicts) != 0 {
+		t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+	}
+	got := m.Result()
+	if len(got) != 2 {
+		t.Fatalf("purged entry must stay deleted, got %+v", got)
+	}
+	if got[0].ID != "x" || got[0].DeletedAt != 100 || got[0].Password != "p1" {
+		t.Fatalf("remote edit must land in the trash, got %+v", got[0])
+	}
+	if got[1].ID != "y" || got[1].DeletedAt != 100 {
+		t.Fatalf("entry trashed on both sides keeps the local time, got %+v", got[1])
+	}
+}
+
+// Tags and custom fields merge one by one, like columns.
+func TestThreeWayMerge_TagsAndCustomFields(t *testing.T) {
+	pin := db.CustomField{Name: "PIN", Kind: db.FieldHidden, Value: "1234"}
+	base := []db.Entry{{ID: "x", Title: "X", Tags: []string{"old"}, Fields: []db.CustomField{pin}}}
+	local := []db.Entry{{ID: "x", Title: "X", Favorite: true, Tags: []string{"local", "old"},
+		Fields: []db.CustomField{{Name: "PIN", Kind: db.FieldHidden, Value: "0000"}}}}
+	remote := []db.Entry{{ID: "x", Title: "X", Tags: []string{"Remote"},
+		Fields: []db.CustomField{pin, {Name: "api", Kind: db.FieldText, Value: "k"}}}}
+
+	m := ThreeWayMerge(base, local, remote)
+	if len(m.Conflicts) != 0 {
+		t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+	}
+	got := m.Result()[0]
+
+	tags, err := db.NormalizeTags(got.Tags)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0] != "local" || tags[1] != "Remote" {
+		t.Fatalf("unexpected merged tags %v", tags)
+	}
+	if !got.Favorite {
+		t.Fatal("local favorite lost")
+	}
+	if len(got.Fields) != 2 || got.Fields[0].Value != "0000" || got.Fields[1].Name != "api" {
+		t.Fatalf("unexpected merged fields %+v", got.Fields)
+	}
+	if len(local[0].Fields) != 1 || len(local[0].Tags) != 2 {
+		t.Fatal("merge modified its input")
+	}
+
+	// Both sides changing one custom field conflicts on that field only
+	remote[0].Fields[0].Value = "9999"
+	m = ThreeWayMerge(base, local, remote)
+	if len(m.Conflicts) != 1 || m.Conflicts[0].Field != "field:PIN" {
+		t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+	}
+	m.Choose(0, true)
+	if f := m.Result()[0].Fields; f[0].Value != "9999" {
+		t.Fatalf("remote choice not applied: %+v", f)
+	}
+}
+
+func TestThreeWayMerge_TypedValues(t *testing.T) {
+	card := func(data map[string]string) db.Entry {
+		return db.Entry{ID: "x", Title: "Card", Type: db.TypeCard, Data: data}
+	}
+	base := []db.Entry{card(map[string]string{"number": "4111111111111111", "expiry": "01/2030"})}
+	local := []db.Entry{card(map[string]string{"number": "4111111111111111", "expiry": "02/2031"})}
+	remote := []db.Entry{card(map[string]string{"number": "4111111111111111", "expiry": "01/2030", "cvv": "123"})}
+
+	m := ThreeWayMerge(base, local, remote)
+	if len(m.Conflicts) != 0 {
+		t.Fatalf("unexpected conflicts %+v", m.Conflicts)
+	}
+	if got := m.Result()[0].Data; got["expiry"] != "02/2031" || got["cvv"] != "123" {
+		t.Fatalf("unexpected merged values %v", got)
+	}
+
+	// Both sides change the type: the values follow the chosen type
+	local[0] = db.Entry{ID: "x", Title: "Card", Type: db.TypeAPI, Data: map[string]string{"key": "k"}}
+	remote[0] = db.Entry{ID: "x", Title: "Card", Type: db.TypeNote}
+	m = ThreeWayMerge(base, local, remote)
+	var typeConflict = -1
+	for i, c := range m.Conflicts {
+		if c.Field == "type" {
+			typeConflict = i
+		}
+	}
+	if typeConflict < 0 {
+		t.Fatalf("type change not a conflict: %+v", m.Conflicts)
+	}
+	if got := m.Result()[0]; got.Type != db.TypeAPI || len(got.Data) != 1 || got.Data["key"] != "k" {
+		t.Fatalf("local type not kept whole: %+v", got)
+	}
+	m.Choose(typeConflict, true)
+	if got := m.Result()[0]; got.Type != db.TypeNote || len(got.Data) != 0 {
+		t.Fatalf("remote type not applied whole: %+v", got)
+	}
+}
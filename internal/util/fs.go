@@ -1,4 +1,4 @@
-package vault
+package util
 
 import (
 	"fmt"
@@ -7,13 +7,13 @@ import (
 	"runtime"
 )
 
-// atomicWriteFile writes data to path safely.
+// AtomicWriteFile writes data to path safely with mode 0600.
 //
 // Guarantees:
 // - Never leaves partial file at destination
 // - Survives crash after rename (POSIX)
 // - Cleans up temp files on failure
-func atomicWriteFile(path string, data []byte) error {
+func AtomicWriteFile(path string, data []byte) error {
 	dir := filepath.Dir(path)
 
 	// Create temp file in same directory (required for atomic rename)
@@ -2,9 +2,9 @@ package vault
 
 import (
 	"fmt"
-	"os"
 	"time"
 	"yap/internal/crypto"
+	"yap/internal/db"
 )
 
 /*************************************************************
@@ -18,7 +18,12 @@ func (v *Vault) Commit(
 	// Lock the mutex to maintain atomicity
 	v.mu.Lock()
 	defer v.mu.Unlock()
-	
+
+	return v.commit(outputPath, rng)
+}
+
+// commit is Commit with v.mu held.
+func (v *Vault) commit(outputPath string, rng crypto.RNG) error {
 	// Validtions to verify vault is healthy to be commited
 	if err := v.requireState(VaultDirty); err != nil {
 		return err
@@ -26,70 +31,124 @@ func (v *Vault) Commit(
 	if v.db == nil {
 		return fmt.Errorf("vault database not open")
 	}
+	if v.device == nil {
+		return fmt.Errorf("device identity required to commit")
+	}
 
 	/* 
 	* Commit Steps
+	* 0) Purge expired trash
 	* 1) Serialize SQLite db
 	* 2) Update vault metadata
 	* 3) Encrypt payload envelope
-	* 4) Atomic write
-	* 5) Transition to clean*/
+	* 4) Atomic write (header + envelope container)
+	* 5) Transition to clean
+	* 6) Update trusted local state*/
+
+	// 0) Purge expired trash
+	if _, err := db.PurgeExpiredTrash(v.db, time.Now()); err != nil {
+		return err
+	}
 
 	// 1) Serialize SQLite db
-	dbBytes, err := os.ReadFile(v.dbPath)
+	// The payload records the schema the database was migrated to on open
+	schemaVersion, err := db.GetSchemaVersion(v.db)
 	if err != nil {
-		return fmt.Errorf("sqlite read failed: %w", err)
+		return err
+	}
+	dbBytes, err := v.snapshotDB()
+	if err != nil {
+		return err
 	}
 
 	// 2) Update vault metadata
-	v.vaultVersion++
-	now := time.Now().Unix()
-	v.header.VaultVersion = v.vaultVersion
-	v.header.LastModified = now
-	payload := &DecryptedPayload{
-		VaultMetadata: VaultMetadata{
-			VaultID: v.vaultID,
-			VaultVersion: v.vaultVersion,
-			KeyEpoch: v.keyEpoch,
-			DeviceID: "",
-			CreatedBy: "",
-			LastWriter: "",
-			Integrity: IntegrityBlock{
-				PayloadHash: mustHash(v.dbBytes),
-			},
+	// Work on a copy so a failed write leaves the in-memory vault untouched
+	nextVersion := v.vaultVersion + 1
+	header := *v.header
+	header.VaultVersion = nextVersion
+	header.LastModified = time.Now().Unix()
+
+	meta := VaultMetadata{
+		VaultID: v.vaultID,
+		VaultVersion: nextVersion,
+		KeyEpoch: v.keyEpoch,
+		DeviceID: v.device.ID,
+		CreatedBy: v.meta.CreatedBy,
+		LastWriter: v.device.Label,
+		Integrity: IntegrityBlock{
+			PayloadHash: mustHash(dbBytes),
 		},
-		WrappedVaultKey: v.vaultKey,
+	}
+	payload := &DecryptedPayload{
+		VaultMetadata: meta,
 		SQLite: SQLitePayload{
-			SchemaVersion: 1,
+			SchemaVersion: uint32(schemaVersion),
 			DBBytes: dbBytes,
 		},
 	}
 
-	headerAAD, err := v.header.CannonicalBytes()
+	// 3) Encrypt payload envelope
+	headerAAD, err := header.CannonicalBytes()
 	if err != nil {
 		return err
 	}
 
 	encryptedPayload, err := EncryptPayload(
 		payload,
-		v.vaultKey.WrappedKey,
+		v.vaultKey,
 		headerAAD,
+		header.Padding,
 		rng,
 	)
 	if err != nil {
 		return fmt.Errorf("payload encryption failed %w", err)
 	}
 
-	if err := atomicWriteFile(outputPath, encryptedPayload); err != nil {
+	// 4) Atomic write
+	if err := WriteFile(outputPath, &header, encryptedPayload); err != nil {
 		return err
 	}
 
-	v.transitionTo(VaultClean)
+	// 5) Transition to clean
+	v.header = &header
+	v.vaultVersion = nextVersion
 	v.dbBytes = dbBytes
+	v.storedSchema = payload.SQLite.SchemaVersion
+	v.meta = meta
+	if err := v.transitionTo(VaultClean); err != nil {
+		return err
+	}
+
+	// 6) Record the new version as trusted local state
+	if v.trusted != nil {
+		if err := v.trusted.Save(v.vaultID, v.vaultVersion, v.keyEpoch); err != nil {
+			return fmt.Errorf("vault committed but local state update failed: %w", err)
+		}
+	}
 
 	return nil
 }
 
+// snapshotDB returns the current SQLite bytes.
+func (v *Vault) snapshotDB() ([]byte, error) {
+	return db.Serialize(v.db)
+}
+
+// replaceDB swaps the working database for dbBytes.
+func (v *Vault) replaceDB(dbBytes []byte) error {
+	if err := v.db.Close(); err != nil {
+		return err
+	}
+
+	conn, err := db.Open(dbBytes)
+	if err != nil {
+		v.db = nil
+		return err
+	}
+	v.db = conn
+	return nil
+}
+
 func mustHash(data []byte) []byte {
 	h, err := crypto.Hash(data)
 	if err != nil {
@@ -0,0 +1,188 @@
+package vault
+
+import (
+	"fmt"
+	"os"
+	"time"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	"yap/internal/keys"
+	"yap/internal/state"
+	"yap/internal/util"
+)
+
+const (
+	initialKeyEpoch     = 1
+	initialVaultVersion = 1
+
+	saltSize   = 32
+	cipherName = "xchacha20-poly1305"
+	kdfName    = "argon2id"
+)
+
+// CreateOptions controls how a new vault is initialised.
+type CreateOptions struct {
+	// Device identifies the creating device. Required.
+	Device state.Device
+
+	// KDF overrides the Argon2id parameters. Zero value uses keys defaults.
+	KDF crypto.Argon2Params
+
+	// Padding sets the payload padding policy. nil uses DefaultPadding.
+	Padding *PaddingParams
+
+	// RNG overrides the randomness source. nil uses crypto.SecureRNG.
+	RNG crypto.RNG
+}
+
+/*
+* Create Steps
+* 1) Generate vault identity
+* 2) Derive master key + KEK from a fresh salt
+* 3) Generate and wrap the Vault Key
+* 4) Build the initial header (epoch 1, version 1)
+* 5) Initialise an empty SQLite payload
+* 6) Encrypt payload under the header AAD
+* 7) Atomic write
+* */
+
+// Create initialises a brand-new vault at path, protected by password.
+// It refuses to overwrite an existing file.
+func Create(
+	path string,
+	password []byte,
+	opts CreateOptions,
+) (*VaultHeader, error) {
+	if path == "" {
+		return nil, fmt.Errorf("vault path must not be empty")
+	}
+	if opts.Device.ID == "" || opts.Device.Label == "" {
+		return nil, fmt.Errorf("device identity must not be empty")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return nil, fmt.Errorf("vault already exists: %s", path)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	rng := opts.RNG
+	if rng == nil {
+		rng = crypto.SecureRNG{}
+	}
+	padding := opts.Padding
+	if padding == nil {
+		def := DefaultPadding()
+		padding = &def
+	}
+	params := opts.KDF
+	if params == (crypto.Argon2Params{}) {
+		params = keys.DefaultArgon2Params()
+	}
+
+	// 1) Generate vault identity
+	vaultID, err := util.NewUUID(rng)
+	if err != nil {
+		return nil, err
+	}
+
+	// 2) Derive master key + KEK from a fresh salt
+	salt, err := keys.GenerateSalt(rng, saltSize)
+	if err != nil {
+		return nil, fmt.Errorf("salt generation failed: %w", err)
+	}
+	mk, err := keys.DeriveMasterKey(password, salt, params)
+	if err != nil {
+		return nil, fmt.Errorf("master key derivation failed: %w", err)
+	}
+	kek, err := keys.DeriveKEK(mk)
+	mk.Destroy()
+	if err != nil {
+		return nil, fmt.Errorf("kek derivation failed: %w", err)
+	}
+	defer kek.Destroy()
+
+	// 3) Generate and wrap the Vault Key
+	vaultKey, err := keys.GenerateVaultKey(rng)
+	if err != nil {
+		return nil, fmt.Errorf("vault key generation failed: %w", err)
+	}
+	defer vaultKey.Destroy()
+	wrapped, err := keys.WrapVaultKey(vaultKey, kek, vaultID, initialKeyEpoch, rng)
+	if err != nil {
+		return nil, fmt.Errorf("vault key wrap failed: %w", err)
+	}
+
+	// 4) Build the initial header
+	now := time.Now().Unix()
+	header := &VaultHeader{
+		Magic:   HeaderMagic,
+		Version: HeaderVersion,
+		KDF: KDFParams{
+			Algo:        kdfName,
+			Salt:        salt,
+			Memory:      params.Memory,
+			Iterations:  params.Iterations,
+			Parallelism: params.Parallelism,
+		},
+		Crypto:          CryptoParams{Cipher: cipherName},
+		VaultID:         vaultID,
+		KeyEpoch:        initialKeyEpoch,
+		VaultVersion:    initialVaultVersion,
+		CreatedAt:       now,
+		LastModified:    now,
+		WrappedVaultKey: wrapped,
+		Padding:         padding,
+	}
+	headerAAD, err := header.CannonicalBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	// 5) Initialise an empty SQLite payload
+	dbBytes, err := newSQLiteBytes()
+	if err != nil {
+		return nil, err
+	}
+
+	// 6) Encrypt payload under the header AAD
+	payload := &DecryptedPayload{
+		VaultMetadata: VaultMetadata{
+			VaultID:      vaultID,
+			VaultVersion: initialVaultVersion,
+			KeyEpoch:     initialKeyEpoch,
+			DeviceID:     opts.Device.ID,
+			CreatedBy:    opts.Device.Label,
+			LastWriter:   opts.Device.Label,
+			Integrity: IntegrityBlock{
+				PayloadHash: mustHash(dbBytes),
+			},
+		},
+		SQLite: SQLitePayload{
+			SchemaVersion: db.SchemaVersion,
+			DBBytes:       dbBytes,
+		},
+	}
+	envelope, err := EncryptPayload(payload, vaultKey, headerAAD, header.Padding, rng)
+	if err != nil {
+		return nil, fmt.Errorf("payload encryption failed: %w", err)
+	}
+
+	// 7) Atomic write
+	if err := WriteFile(path, header, envelope); err != nil {
+		return nil, err
+	}
+
+	return header, nil
+}
+
+// newSQLiteBytes builds an empty database from schema.sql and returns
+// its image.
+func newSQLiteBytes() ([]byte, error) {
+	conn, err := db.Open(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	return db.Serialize(conn)
+}
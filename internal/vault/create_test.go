@@ -0,0 +1,57 @@
+package vault
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	yerrors "yap/internal/errors"
+)
+
+func TestCreate_ProducesOpenableVault(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.yap")
+	password := []byte("correct horse battery staple")
+
+	header, err := Create(path, password, CreateOptions{Device: testDevice})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.KeyEpoch != 1 || header.VaultVersion != 1 {
+		t.Fatalf("unexpected initial counters: epoch=%d version=%d",
+			header.KeyEpoch, header.VaultVersion)
+	}
+
+	ov, err := openFile(path, password, OpenContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ov.Header.VaultID != header.VaultID {
+		t.Fatal("vault_id changed across create/open")
+	}
+	if ov.Payload.VaultMetadata.CreatedBy != testDevice.Label {
+		t.Fatalf("unexpected created_by: %q", ov.Payload.VaultMetadata.CreatedBy)
+	}
+}
+
+func TestCreate_WrongPasswordFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.yap")
+
+	if _, err := Create(path, []byte("right"), CreateOptions{Device: testDevice}); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := openFile(path, []byte("wrong"), OpenContext{})
+	if !errors.Is(err, yerrors.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed, got %v", err)
+	}
+}
+
+func TestCreate_RefusesOverwrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "vault.yap")
+
+	if _, err := Create(path, []byte("pw"), CreateOptions{Device: testDevice}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Create(path, []byte("pw"), CreateOptions{Device: testDevice}); err == nil {
+		t.Fatal("expected create to refuse an existing vault file")
+	}
+}
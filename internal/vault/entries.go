@@ -0,0 +1,282 @@
+package vault
+
+import (
+	"database/sql"
+	"math"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	"yap/internal/util"
+)
+
+// Entry CRUD on an open vault.
+// The vault key never leaves the Vault; every mutation marks it DIRTY
+// and becomes durable only after Commit.
+
+// CreateEntry stores a new entry and returns its id.
+// An empty entry.ID is replaced with a fresh UUID.
+func (v *Vault) CreateEntry(entry db.Entry, rng crypto.RNG) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return "", err
+	}
+
+	if entry.ID == "" {
+		id, err := util.NewUUID(rng)
+		if err != nil {
+			return "", err
+		}
+		entry.ID = id
+	}
+
+	if err := db.CreateEntry(v.db, v.vaultID, v.vaultKey, entry, rng); err != nil {
+		return "", err
+	}
+	v.markDirty()
+
+	return entry.ID, nil
+}
+
+// ImportEntry stores an entry taken from another copy of the vault with
+// its timestamps and password history, for merges.
+func (v *Vault) ImportEntry(entry db.Entry, history []db.PasswordVersion, rng crypto.RNG) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.ImportEntry(v.db, v.vaultID, v.vaultKey, entry, history, rng); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+func (v *Vault) GetEntry(entryID string) (*db.Entry, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+	return db.GetEntry(v.db, v.vaultID, v.vaultKey, entryID)
+}
+
+func (v *Vault) UpdateEntry(entry db.Entry, rng crypto.RNG) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.UpdateEntry(v.db, v.vaultID, v.vaultKey, entry, rng); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// ApplyEntry rewrites an entry keeping its UpdatedAt, for merges.
+// history, the entry's password history in the other copy, is merged
+// into this one's.
+func (v *Vault) ApplyEntry(entry db.Entry, history []db.PasswordVersion, rng crypto.RNG) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.ApplyEntry(v.db, v.vaultID, v.vaultKey, entry, history, rng); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// DeleteEntry moves an entry to the trash.
+func (v *Vault) DeleteEntry(entryID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.DeleteEntry(v.db, entryID); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+func (v *Vault) ListEntryIDs() ([]string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+	return db.ListEntryIDs(v.db)
+}
+
+// ListEntries decrypts every entry not in the trash, most recently
+// updated first.
+func (v *Vault) ListEntries() ([]db.Entry, error) {
+	return v.listEntries(db.ListEntryIDs)
+}
+
+// ListTrash decrypts the trashed entries, most recently deleted first.
+func (v *Vault) ListTrash() ([]db.Entry, error) {
+	return v.listEntries(db.ListTrashIDs)
+}
+
+// ListAllEntries decrypts every entry, trashed ones included, for sync.
+func (v *Vault) ListAllEntries() ([]db.Entry, error) {
+	return v.listEntries(db.ListAllEntryIDs)
+}
+
+func (v *Vault) listEntries(list func(*sql.DB) ([]string, error)) ([]db.Entry, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+
+	ids, err := list(v.db)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]db.Entry, 0, len(ids))
+	for _, id := range ids {
+		e, err := db.GetEntry(v.db, v.vaultID, v.vaultKey, id)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, nil
+}
+
+// PasswordHistory returns the old passwords of an entry, newest first.
+func (v *Vault) PasswordHistory(entryID string) ([]db.PasswordVersion, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+	return db.PasswordHistory(v.db, v.vaultID, v.vaultKey, entryID)
+}
+
+// HistoryLimit returns how many old passwords each entry keeps.
+func (v *Vault) HistoryLimit() (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return 0, err
+	}
+	return db.GetHistoryLimit(v.db)
+}
+
+// SetHistoryLimit changes the password history retention of the vault.
+func (v *Vault) SetHistoryLimit(limit int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.SetHistoryLimit(v.db, limit); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// RestoreEntry takes an entry out of the trash.
+func (v *Vault) RestoreEntry(entryID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.RestoreEntry(v.db, entryID); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// PurgeEntry deletes an entry for good.
+func (v *Vault) PurgeEntry(entryID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.PurgeEntry(v.db, entryID); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// EmptyTrash purges every trashed entry and returns how many there were.
+func (v *Vault) EmptyTrash() (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return 0, err
+	}
+	n, err := db.PurgeTrash(v.db, math.MaxInt64)
+	if err != nil {
+		return 0, err
+	}
+	if n > 0 {
+		v.markDirty()
+	}
+
+	return n, nil
+}
+
+// TrashRetention returns after how many days commits purge trashed
+// entries, 0 for never.
+func (v *Vault) TrashRetention() (int, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return 0, err
+	}
+	return db.GetTrashRetention(v.db)
+}
+
+// SetTrashRetention changes the trash retention of the vault.
+func (v *Vault) SetTrashRetention(days int) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.SetTrashRetention(v.db, days); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
@@ -0,0 +1,234 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/state"
+)
+
+var (
+	testPassword = []byte("correct horse battery staple")
+	testDevice   = state.Device{ID: "device-1", Label: "test-device"}
+)
+
+// newTestVault creates a vault in a temp dir and returns its path.
+func newTestVault(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "vault.yap")
+	if _, err := Create(path, testPassword, CreateOptions{Device: testDevice}); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func openTestVault(t *testing.T, path string) *Vault {
+	t.Helper()
+
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { v.Close() })
+	return v
+}
+
+func TestOpen_ReturnsOpenVault(t *testing.T) {
+	v := openTestVault(t, newTestVault(t))
+
+	if v.State() != VaultOpen {
+		t.Fatalf("expected OPEN, got %s", v.State())
+	}
+	if v.VaultVersion() != 1 || v.KeyEpoch() != 1 {
+		t.Fatal("unexpected initial counters")
+	}
+}
+
+func TestVault_EntryCRUD(t *testing.T) {
+	v := openTestVault(t, newTestVault(t))
+	rng := crypto.SecureRNG{}
+
+	id, err := v.CreateEntry(db.Entry{
+		Title:    "github",
+		Username: "octocat",
+		Password: "hunter2",
+	}, rng)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v.State() != VaultDirty {
+		t.Fatalf("expected DIRTY after create, got %s", v.State())
+	}
+
+	e, err := v.GetEntry(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Password != "hunter2" {
+		t.Fatalf("unexpected password: %q", e.Password)
+	}
+
+	e.Password = "hunter3"
+	if err := v.UpdateEntry(*e, rng); err != nil {
+		t.Fatal(err)
+	}
+	e, err = v.GetEntry(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Password != "hunter3" {
+		t.Fatal("update not applied")
+	}
+
+	ids, err := v.ListEntryIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 1 || ids[0] != id {
+		t.Fatalf("unexpected ids: %v", ids)
+	}
+
+	if err := v.DeleteEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if e, err := v.GetEntry(id); err != nil || e.DeletedAt == 0 {
+		t.Fatalf("expected a trashed entry, got %+v, %v", e, err)
+	}
+	if ids, err := v.ListEntryIDs(); err != nil || len(ids) != 0 {
+		t.Fatalf("trashed entry still listed: %v, %v", ids, err)
+	}
+
+	if err := v.PurgeEntry(id); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.GetEntry(id); !errors.Is(err, yerrors.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestVault_ClosedRejectsOperations(t *testing.T) {
+	v, err := Open(newTestVault(t), testPassword, OpenContext{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := v.ListEntryIDs(); err == nil {
+		t.Fatal("expected closed vault to reject reads")
+	}
+}
+
+func TestOpen_TrustedStateRejectsRollback(t *testing.T) {
+	path := newTestVault(t)
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	old, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.CreateEntry(db.Entry{Title: "t", Password: "p"}, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	rec, err := store.Load(v.ID())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.LastSeenVaultVersion != 2 {
+		t.Fatalf("expected last seen version 2, got %d", rec.LastSeenVaultVersion)
+	}
+
+	// Simulate the remote handing back the older vault
+	if err := os.WriteFile(path, old, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, testPassword, OpenContext{State: store}); !errors.Is(err, yerrors.ErrRollbackDetected) {
+		t.Fatalf("expected ErrRollbackDetected, got %v", err)
+	}
+}
+
+func TestVault_NoPlaintextOnDisk(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+
+	path := newTestVault(t)
+	v := openTestVault(t, path)
+	if _, err := v.CreateEntry(db.Entry{Title: "github", Password: "hunter2"}, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if files, _ := os.ReadDir(tmp); len(files) != 0 {
+		t.Fatalf("open vault left %d file(s) in TMPDIR", len(files))
+	}
+	if files, _ := os.ReadDir(filepath.Dir(path)); len(files) != 1 {
+		t.Fatalf("expected only the vault file next to the vault, got %d", len(files))
+	}
+}
+
+func TestVault_CloseDestroysVaultKey(t *testing.T) {
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+	v, err := Open(newTestVault(t), testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := v.vaultKey
+	if key.Len() != 32 {
+		t.Fatal("vault key missing while open")
+	}
+
+	if err := v.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if key.Bytes() != nil {
+		t.Fatal("vault key still readable after Close")
+	}
+}
+
+// The payload records the database schema, and vaults from a newer
+// schema are refused before their database is loaded.
+func TestVault_RefusesNewerSchema(t *testing.T) {
+	path := newTestVault(t)
+	v := openTestVault(t, path)
+	if v.StoredSchemaVersion() != db.SchemaVersion {
+		t.Fatalf("stored schema %d, want %d", v.StoredSchemaVersion(), db.SchemaVersion)
+	}
+
+	if err := db.SetMeta(v.db, "schema_version", strconv.Itoa(db.SchemaVersion+1)); err != nil {
+		t.Fatal(err)
+	}
+	v.mu.Lock()
+	v.markDirty()
+	v.mu.Unlock()
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	if v.StoredSchemaVersion() != db.SchemaVersion+1 {
+		t.Fatal("commit did not record the schema version")
+	}
+
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+	if _, err := Open(path, testPassword, OpenContext{State: store}); !errors.Is(err, yerrors.ErrInvalidVault) {
+		t.Fatalf("expected ErrInvalidVault, got %v", err)
+	}
+}
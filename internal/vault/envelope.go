@@ -14,9 +14,12 @@ type EncryptedEnvelope struct {
 
 // DecryptedPayload is the plaintext CBOR payload after decryption.
 type DecryptedPayload struct {
-	VaultMetadata   VaultMetadata   `cbor:"vault_metadata"`
-	WrappedVaultKey WrappedVaultKey `cbor:"wrapped_vault_key"`
-	SQLite          SQLitePayload   `cbor:"sqlite"`
+	VaultMetadata VaultMetadata `cbor:"vault_metadata"`
+	SQLite        SQLitePayload `cbor:"sqlite"`
+
+	// Padding is zero bytes filling the plaintext up to the header's
+	// padding policy. Absent on unpadded vaults.
+	Padding []byte `cbor:"padding,omitempty"`
 }
 
 type VaultMetadata struct {
@@ -24,9 +27,9 @@ type VaultMetadata struct {
 	VaultVersion uint64 `cbor:"vault_version"`
 	KeyEpoch     uint64 `cbor:"key_epoch"`
 
-	DeviceID   string `cbor:"device_id"`
-	CreatedBy  string `cbor:"created_by"`
-	LastWriter string `cbor:"last_writer"`
+	DeviceID   string `cbor:"device_id"`   // ID of the last writing device
+	CreatedBy  string `cbor:"created_by"`  // label of the creating device
+	LastWriter string `cbor:"last_writer"` // label of the last writing device
  
 	Integrity IntegrityBlock `cbor:"integrity"`
 }
@@ -35,32 +38,27 @@ type IntegrityBlock struct {
 	PayloadHash []byte `cbor:"payload_hash"` // BLAKE2b-256
 }
 
-type WrappedVaultKey struct {
-	Algo       string `cbor:"algo"`        // "hkdf"
-	WrappedKey []byte `cbor:"wrapped_key"` // ciphertext (+ tag)
-	Nonce      []byte `cbor:"nonce"`       // 24 bytes
-	KeyEpoch   uint64 `cbor:"key_epoch"`
-}
-
 type SQLitePayload struct {
 	SchemaVersion uint32 `cbor:"schema_version"`
 	DBBytes       []byte `cbor:"db_bytes"`
 }
 
-// EncryptPayload encrypts a decrypted payload using the Vault Key and header AAD.
+// EncryptPayload encrypts a decrypted payload using the Vault Key and header AAD,
+// padded according to padding (nil for none).
 func EncryptPayload(
 	payload *DecryptedPayload,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 	headerAAD []byte,
+	padding *PaddingParams,
 	rng crypto.RNG,
 ) ([]byte, error) {
 
-	if len(vaultKey) != crypto.XChaChaKeySize {
+	if vaultKey.Len() != crypto.XChaChaKeySize {
 		return nil, fmt.Errorf("invalid vault key length")
 	}
 
-	// 1. Canonical CBOR encode inner payload
-	plaintext, err := encoding.MarshalCanonical(payload)
+	// 1. Canonical CBOR encode inner payload, padded
+	plaintext, err := marshalPadded(payload, padding)
 	if err != nil {
 		return nil, fmt.Errorf("payload cbor encode failed: %w", err)
 	}
@@ -73,7 +71,7 @@ func EncryptPayload(
 
 	// 3. Encrypt
 	ciphertext, err := crypto.Encrypt(
-		vaultKey,
+		vaultKey.Bytes(),
 		nonce,
 		plaintext,
 		headerAAD,
@@ -93,14 +91,16 @@ func EncryptPayload(
 }
 
 
-// DecryptPayload decrypts an encrypted envelope using the Vault Key and header AAD.
+// DecryptPayload decrypts an encrypted envelope using the Vault Key and header AAD,
+// and checks its padding against the header policy (nil for none).
 func DecryptPayload(
 	envelopeBytes []byte,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 	headerAAD []byte,
+	padding *PaddingParams,
 ) (*DecryptedPayload, error) {
 
-	if len(vaultKey) != crypto.XChaChaKeySize {
+	if vaultKey.Len() != crypto.XChaChaKeySize {
 		return nil, fmt.Errorf("invalid vault key length")
 	}
 
@@ -119,7 +119,7 @@ func DecryptPayload(
 
 	// 2. Decrypt
 	plaintext, err := crypto.Decrypt(
-		vaultKey,
+		vaultKey.Bytes(),
 		env.Nonce,
 		env.Ciphertext,
 		headerAAD,
@@ -135,5 +135,10 @@ func DecryptPayload(
 		return nil, fmt.Errorf("payload decode failed: %w", err)
 	}
 
+	// 4. Check padding
+	if err := checkPadding(&payload, len(plaintext), padding); err != nil {
+		return nil, err
+	}
+
 	return &payload, nil
 }
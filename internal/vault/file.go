@@ -0,0 +1,127 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	yerrors "yap/internal/errors"
+	"yap/internal/util"
+)
+
+/*
+* On-disk container (all integers big-endian)
+*
+* +---------------------------+
+* | magic "YAPV"     4 bytes  |
+* | format version   1 byte   |
+* | header length    4 bytes  |
+* +---------------------------+
+* | VaultHeader (canonical CBOR, plaintext, AAD)
+* +---------------------------+
+* | EncryptedEnvelope (canonical CBOR)
+* +---------------------------+
+* */
+
+const (
+	FileMagic         = "YAPV"
+	FileFormatVersion = 1
+
+	filePreambleSize = len(FileMagic) + 1 + 4
+	maxHeaderSize    = 64 * 1024
+)
+
+// VaultFile is a parsed vault container.
+type VaultFile struct {
+	Header        *VaultHeader
+	HeaderBytes   []byte // exact canonical bytes read from disk
+	EnvelopeBytes []byte
+}
+
+// EncodeFile serializes a header and encrypted envelope into a container.
+func EncodeFile(header *VaultHeader, envelopeBytes []byte) ([]byte, error) {
+	headerBytes, err := header.CannonicalBytes()
+	if err != nil {
+		return nil, err
+	}
+	if len(headerBytes) > maxHeaderSize {
+		return nil, fmt.Errorf("vault header too large")
+	}
+	if len(envelopeBytes) == 0 {
+		return nil, fmt.Errorf("empty envelope")
+	}
+
+	buf := make([]byte, 0, filePreambleSize+len(headerBytes)+len(envelopeBytes))
+	buf = append(buf, FileMagic...)
+	buf = append(buf, FileFormatVersion)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(headerBytes)))
+	buf = append(buf, headerBytes...)
+	buf = append(buf, envelopeBytes...)
+
+	return buf, nil
+}
+
+// DecodeFile parses and validates a container.
+// The header must be valid and canonically encoded.
+func DecodeFile(data []byte) (*VaultFile, error) {
+	if len(data) < filePreambleSize {
+		return nil, fmt.Errorf("%w: vault file truncated", yerrors.ErrInvalidVault)
+	}
+	if string(data[:len(FileMagic)]) != FileMagic {
+		return nil, fmt.Errorf("%w: not a yap vault file", yerrors.ErrInvalidVault)
+	}
+	if v := data[len(FileMagic)]; v != FileFormatVersion {
+		return nil, fmt.Errorf("%w: unsupported vault file version: %d", yerrors.ErrInvalidVault, v)
+	}
+
+	n := binary.BigEndian.Uint32(data[len(FileMagic)+1 : filePreambleSize])
+	if n == 0 || n > maxHeaderSize {
+		return nil, fmt.Errorf("%w: invalid header length", yerrors.ErrInvalidVault)
+	}
+	rest := data[filePreambleSize:]
+	if uint64(n) >= uint64(len(rest)) {
+		return nil, fmt.Errorf("%w: vault file truncated", yerrors.ErrInvalidVault)
+	}
+
+	headerBytes := rest[:n]
+	envelopeBytes := rest[n:]
+
+	header, err := DecodeVaultHeader(headerBytes)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", yerrors.ErrInvalidVault, err)
+	}
+
+	// The header doubles as AAD; a non-canonical encoding would make
+	// the AAD ambiguous across devices.
+	canonical, err := header.CannonicalBytes()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(canonical, headerBytes) {
+		return nil, fmt.Errorf("%w: header is not canonical", yerrors.ErrInvalidVault)
+	}
+
+	return &VaultFile{
+		Header:        header,
+		HeaderBytes:   headerBytes,
+		EnvelopeBytes: envelopeBytes,
+	}, nil
+}
+
+// ReadFile reads and parses the vault container at path.
+func ReadFile(path string) (*VaultFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return DecodeFile(data)
+}
+
+// WriteFile atomically writes a header and envelope as a container to path.
+func WriteFile(path string, header *VaultHeader, envelopeBytes []byte) error {
+	data, err := EncodeFile(header, envelopeBytes)
+	if err != nil {
+		return err
+	}
+	return util.AtomicWriteFile(path, data)
+}
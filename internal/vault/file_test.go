@@ -0,0 +1,149 @@
+package vault
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/state"
+)
+
+func testHeader() *VaultHeader {
+	return &VaultHeader{
+		Magic:   HeaderMagic,
+		Version: HeaderVersion,
+		KDF: KDFParams{
+			Algo:        "argon2id",
+			Salt:        bytes.Repeat([]byte{1}, 16),
+			Memory:      128 * 1024,
+			Iterations:  3,
+			Parallelism: 4,
+		},
+		Crypto:          CryptoParams{Cipher: "xchacha20-poly1305"},
+		VaultID:         "vault-1",
+		KeyEpoch:        1,
+		VaultVersion:    1,
+		CreatedAt:       1,
+		LastModified:    1,
+		WrappedVaultKey: []byte{0xa0},
+	}
+}
+
+func TestEncodeDecodeFile_RoundTrip(t *testing.T) {
+	h := testHeader()
+	envelope := []byte("envelope-bytes")
+
+	data, err := EncodeFile(h, envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	vf, err := DecodeFile(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vf.Header.VaultID != h.VaultID {
+		t.Fatal("header mismatch after round trip")
+	}
+	if !bytes.Equal(vf.EnvelopeBytes, envelope) {
+		t.Fatal("envelope mismatch after round trip")
+	}
+}
+
+func TestDecodeFile_RejectsMalformed(t *testing.T) {
+	valid, err := EncodeFile(testHeader(), []byte("env"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	badMagic := bytes.Clone(valid)
+	badMagic[0] = 'X'
+
+	badVersion := bytes.Clone(valid)
+	badVersion[len(FileMagic)] = FileFormatVersion + 1
+
+	cases := map[string][]byte{
+		"empty":       nil,
+		"bad magic":   badMagic,
+		"bad version": badVersion,
+		"no envelope": valid[:len(valid)-3],
+		"truncated":   valid[:filePreambleSize+2],
+	}
+	for name, data := range cases {
+		if _, err := DecodeFile(data); !errors.Is(err, yerrors.ErrInvalidVault) {
+			t.Fatalf("%s: expected ErrInvalidVault, got %v", name, err)
+		}
+	}
+}
+
+func TestCommit_PersistsHeader(t *testing.T) {
+	path := newTestVault(t)
+	v := openTestVault(t, path)
+
+	v.markDirty()
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+
+	vf, err := ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vf.Header.VaultVersion != 2 {
+		t.Fatalf("expected vault_version 2 on disk, got %d", vf.Header.VaultVersion)
+	}
+}
+
+func TestCommit_StampsDeviceAndReopens(t *testing.T) {
+	path := newTestVault(t)
+	v := openTestVault(t, path)
+
+	if _, err := v.CreateEntry(db.Entry{Title: "t", Password: "p"}, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	reopened := openTestVault(t, path)
+	meta := reopened.Metadata()
+	if meta.CreatedBy != testDevice.Label {
+		t.Fatalf("created_by not preserved: %q", meta.CreatedBy)
+	}
+	if meta.DeviceID == testDevice.ID || meta.DeviceID == "" {
+		t.Fatalf("device_id should be the committing device, got %q", meta.DeviceID)
+	}
+	if meta.LastWriter == "" {
+		t.Fatal("last_writer not stamped")
+	}
+}
+
+// Verify enforces trusted state but leaves saving it to the caller, so
+// a vault that never replaces the local file cannot move the counters.
+func TestVerify_ChecksStateWithoutSaving(t *testing.T) {
+	path := newTestVault(t)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	header, err := Verify(data, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Load(header.VaultID); !errors.Is(err, yerrors.ErrNotFound) {
+		t.Fatalf("verify saved state: %v", err)
+	}
+
+	if err := store.Save(header.VaultID, header.VaultVersion+1, header.KeyEpoch); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Verify(data, testPassword, OpenContext{State: store}); !errors.Is(err, yerrors.ErrRollbackDetected) {
+		t.Fatalf("expected ErrRollbackDetected, got %v", err)
+	}
+}
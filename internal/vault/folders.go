@@ -0,0 +1,196 @@
+package vault
+
+import (
+	"sort"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	"yap/internal/util"
+)
+
+// Folder CRUD on an open vault. Like entries, every mutation marks the
+// vault DIRTY and becomes durable only after Commit.
+
+// CreateFolder stores a new folder and returns its id.
+// An empty folder.ID is replaced with a fresh UUID.
+func (v *Vault) CreateFolder(folder db.Folder, rng crypto.RNG) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return "", err
+	}
+
+	if folder.ID == "" {
+		id, err := util.NewUUID(rng)
+		if err != nil {
+			return "", err
+		}
+		folder.ID = id
+	}
+
+	if err := db.CreateFolder(v.db, v.vaultID, v.vaultKey, folder, rng); err != nil {
+		return "", err
+	}
+	v.markDirty()
+
+	return folder.ID, nil
+}
+
+func (v *Vault) GetFolder(folderID string) (*db.Folder, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+	return db.GetFolder(v.db, v.vaultID, v.vaultKey, folderID)
+}
+
+// ListFolders decrypts every folder, ordered by id.
+func (v *Vault) ListFolders() ([]db.Folder, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+	return db.ListFolders(v.db, v.vaultID, v.vaultKey)
+}
+
+func (v *Vault) RenameFolder(folderID, name string, rng crypto.RNG) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.RenameFolder(v.db, v.vaultID, v.vaultKey, folderID, name, rng); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// MoveFolder re-parents a folder; "" is the root.
+func (v *Vault) MoveFolder(folderID, parentID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.MoveFolder(v.db, v.vaultID, v.vaultKey, folderID, parentID); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// DeleteFolder removes an empty folder.
+func (v *Vault) DeleteFolder(folderID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.DeleteFolder(v.db, folderID); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// MoveEntry puts an entry in a folder; "" is the root.
+func (v *Vault) MoveEntry(entryID, folderID string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if err := db.MoveEntry(v.db, entryID, folderID); err != nil {
+		return err
+	}
+	v.markDirty()
+
+	return nil
+}
+
+// ApplyFolders creates, renames and moves folders so that every folder
+// of want exists as given. want is ordered parents first, like a merge
+// result. Folders missing from want are left to PruneFolders, which
+// runs once no entry is filed under them anymore.
+func (v *Vault) ApplyFolders(want []db.Folder, rng crypto.RNG) error {
+	ours, err := v.ListFolders()
+	if err != nil {
+		return err
+	}
+	have := make(map[string]db.Folder, len(ours))
+	for _, f := range ours {
+		have[f.ID] = f
+	}
+
+	for _, f := range want {
+		cur, ok := have[f.ID]
+		if !ok {
+			if _, err := v.CreateFolder(f, rng); err != nil {
+				return err
+			}
+			continue
+		}
+		if cur.Name != f.Name {
+			if err := v.RenameFolder(f.ID, f.Name, rng); err != nil {
+				return err
+			}
+		}
+		if cur.ParentID != f.ParentID {
+			if err := v.MoveFolder(f.ID, f.ParentID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// PruneFolders deletes the folders missing from keep, deepest first.
+// They must be empty by then.
+func (v *Vault) PruneFolders(keep []db.Folder) error {
+	ours, err := v.ListFolders()
+	if err != nil {
+		return err
+	}
+	parents := make(map[string]string, len(ours))
+	for _, f := range ours {
+		parents[f.ID] = f.ParentID
+	}
+	kept := make(map[string]bool, len(keep))
+	for _, f := range keep {
+		kept[f.ID] = true
+	}
+
+	depth := func(id string) int {
+		n := 0
+		for p := parents[id]; p != ""; p = parents[p] {
+			n++
+		}
+		return n
+	}
+	var drop []string
+	for _, f := range ours {
+		if !kept[f.ID] {
+			drop = append(drop, f.ID)
+		}
+	}
+	sort.SliceStable(drop, func(i, j int) bool { return depth(drop[i]) > depth(drop[j]) })
+
+	for _, id := range drop {
+		if err := v.DeleteFolder(id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
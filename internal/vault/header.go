@@ -25,6 +25,15 @@ type VaultHeader struct {
 	VaultVersion uint64      `cbor:"vault_version"`
 	CreatedAt    int64       `cbor:"created_at"`
 	LastModified int64       `cbor:"last_modified"`
+
+	// WrappedVaultKey is the canonical keys.WrappedVaultKey, encrypted
+	// under the KEK. It lives in the header so it can be unwrapped before
+	// the payload is decrypted.
+	WrappedVaultKey []byte `cbor:"wrapped_vault_key"`
+
+	// Padding is the payload padding policy. nil on vaults created before
+	// padding existed, which stay unpadded.
+	Padding *PaddingParams `cbor:"padding,omitempty"`
 }
 
 type KDFParams struct {
@@ -58,6 +67,12 @@ func (h *VaultHeader) Validate() error {
 		return fmt.Errorf("invalid crypto params: %w", err)
 	}
 
+	if h.Padding != nil {
+		if err := h.Padding.Validate(); err != nil {
+			return fmt.Errorf("invalid padding params: %w", err)
+		}
+	}
+
 	if h.VaultID == "" {
 		return fmt.Errorf("vault_id must not be empty")
 	}
@@ -70,6 +85,10 @@ func (h *VaultHeader) Validate() error {
 		return fmt.Errorf("vault_version must be >= 1")
 	}
 
+	if len(h.WrappedVaultKey) == 0 {
+		return fmt.Errorf("wrapped_vault_key must not be empty")
+	}
+
 	if h.CreatedAt <= 0 {
 		return fmt.Errorf("created_at must be set")
 	}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 
 	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
 )
 
 
@@ -54,7 +56,7 @@ func ValidateMetadata(
 	}
 
 	if meta.VaultVersion < ctx.LastSeenVaultVersion {
-		return fmt.Errorf("vault_version rollback detected")
+		return fmt.Errorf("%w: vault_version rollback detected", yerrors.ErrRollbackDetected)
 	}
 
 	// ---- Key epoch (crypto downgrade protection) ----
@@ -63,7 +65,7 @@ func ValidateMetadata(
 	}
 
 	if meta.KeyEpoch < ctx.LastSeenKeyEpoch {
-		return fmt.Errorf("key_epoch downgrade detected")
+		return fmt.Errorf("%w: key_epoch downgrade detected", yerrors.ErrRollbackDetected)
 	}
 
 	// ---- Device metadata sanity ----
@@ -77,6 +79,13 @@ func ValidateMetadata(
 		return fmt.Errorf("last_writer must not be empty")
 	}
 
+	// ---- Schema version ----
+	// Older databases are migrated on load; newer ones cannot be
+	if payload.SQLite.SchemaVersion > db.SchemaVersion {
+		return fmt.Errorf("%w: schema version %d is newer than this yap supports (%d); upgrade yap",
+			yerrors.ErrInvalidVault, payload.SQLite.SchemaVersion, db.SchemaVersion)
+	}
+
 	// ---- Integrity hash ----
 	if err := validatePayloadHash(payload); err != nil {
 		return err
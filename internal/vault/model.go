@@ -3,9 +3,10 @@ package vault
 import (
 	"database/sql"
 	"fmt"
-	"os"
 	"sync"
+	"yap/internal/crypto"
 	"yap/internal/db"
+	"yap/internal/state"
 )
 
 type VaultState int
@@ -18,6 +19,23 @@ const (
 	VaultClean
 )
 
+func (s VaultState) String() string {
+	switch s {
+	case VaultClosed:
+		return "CLOSED"
+	case VaultOpening:
+		return "OPENING"
+	case VaultOpen:
+		return "OPEN"
+	case VaultDirty:
+		return "DIRTY"
+	case VaultClean:
+		return "CLEAN"
+	default:
+		return fmt.Sprintf("VaultState(%d)", int(s))
+	}
+}
+
 var allowedTransitions = map[VaultState][]VaultState{
 	VaultClosed:  {VaultOpening},
 	VaultOpening: {VaultOpen, VaultClosed},
@@ -26,27 +44,31 @@ var allowedTransitions = map[VaultState][]VaultState{
 	VaultClean:   {VaultDirty, VaultClosed},
 }
 
-
 type Vault struct {
 	mu sync.Mutex
 
 	state VaultState
 
 	header   *VaultHeader
-	vaultKey WrappedVaultKey
+	vaultKey *crypto.Secret // owned; destroyed by Close
 
 	vaultID      string
 	vaultVersion uint64
 	keyEpoch     uint64
 
-	db      *sql.DB
-	dbPath  string
-	dbBytes []byte // decrypted SQLite bytes
+	path    string        // vault container on disk
+	trusted *state.Store  // trusted local state, may be nil
+	device  *state.Device // identity stamped on commit, may be nil
+	meta    VaultMetadata // metadata of the last open/commit
+
+	db           *sql.DB // in memory, never backed by a file
+	dbBytes      []byte  // decrypted SQLite bytes
+	storedSchema uint32  // schema version of the last open/commit payload
 }
 
-func (v *Vault) ensureState(expected VaultState) (error) {
-	if (v.state != expected) {
-		return  fmt.Errorf("invalid vault state: %v", v.state)
+func (v *Vault) ensureState(expected VaultState) error {
+	if v.state != expected {
+		return fmt.Errorf("invalid vault state: %v", v.state)
 	}
 	return nil
 }
@@ -54,33 +76,24 @@ func (v *Vault) ensureState(expected VaultState) (error) {
 func newOpenVault(
 	header *VaultHeader,
 	payload *DecryptedPayload,
-	vaultKey []byte,
+	vaultKey *crypto.Secret,
 ) (*Vault, error) {
-	tmpFile, err := os.CreateTemp("", "yap-vault-*.db")
+	dbConn, err := db.Open(payload.SQLite.DBBytes)
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := tmpFile.Write(payload.SQLite.DBBytes); err != nil {
-		return nil, err
-	}
-	tmpFile.Close()
-
-	dbConn, err := db.Init(tmpFile.Name())
-	if err != nil {
-		return nil, err
-	}
- 
 	vault := &Vault{
 		state:        VaultOpening,
 		header:       header,
-		vaultKey:     payload.WrappedVaultKey,
+		vaultKey:     vaultKey,
 		vaultID:      header.VaultID,
 		vaultVersion: header.VaultVersion,
 		keyEpoch:     header.KeyEpoch,
 		db:           dbConn,
-		dbPath:       tmpFile.Name(),
 		dbBytes:      payload.SQLite.DBBytes,
+		storedSchema: payload.SQLite.SchemaVersion,
+		meta:         payload.VaultMetadata,
 	}
 	if err := vault.transitionTo(VaultOpen); err != nil {
 		return nil, err
@@ -90,9 +103,71 @@ func newOpenVault(
 }
 
 func (v *Vault) markDirty() {
+	if v.state == VaultDirty {
+		return
+	}
 	v.transitionTo(VaultDirty)
 }
 
+// requireUsable rejects operations on a vault that is not open.
+func (v *Vault) requireUsable() error {
+	switch v.state {
+	case VaultOpen, VaultDirty, VaultClean:
+		return nil
+	default:
+		return fmt.Errorf("vault is not open (current: %s)", v.state)
+	}
+}
+
+func (v *Vault) ID() string {
+	return v.vaultID
+}
+
+func (v *Vault) Path() string {
+	return v.path
+}
+
+func (v *Vault) VaultVersion() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.vaultVersion
+}
+
+func (v *Vault) KeyEpoch() uint64 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.keyEpoch
+}
+
+// StoredSchemaVersion is the schema version of the vault file. It is
+// older than db.SchemaVersion until a vault migrated on open is committed.
+func (v *Vault) StoredSchemaVersion() uint32 {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.storedSchema
+}
+
+func (v *Vault) State() VaultState {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.state
+}
+
+// Metadata returns the authenticated metadata of the last open or commit,
+// including which device last wrote the vault.
+func (v *Vault) Metadata() VaultMetadata {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.meta
+}
+
+// Header returns a copy of the current plaintext header.
+func (v *Vault) Header() VaultHeader {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return *v.header
+}
+
 func (v *Vault) CanCommit() bool {
 	return v.state == VaultDirty
 }
@@ -104,9 +179,8 @@ func (v *Vault) Close() error {
 	if v.db != nil {
 		v.db.Close()
 	}
-	if v.dbPath != "" {
-		os.Remove(v.dbPath)
-	}
+	v.vaultKey.Destroy()
+	crypto.Wipe(v.dbBytes)
 
 	if err := v.transitionTo(VaultClosed); err != nil {
 		return err
@@ -142,4 +216,3 @@ func (v *Vault) transitionTo(next VaultState) error {
 		next,
 	)
 }
-
@@ -1,10 +1,12 @@
 package vault
 
 import (
+	"errors"
 	"fmt"
 	"yap/internal/crypto"
-	"yap/internal/encoding"
+	yerrors "yap/internal/errors"
 	"yap/internal/keys"
+	"yap/internal/state"
 )
 
 // trusted local state used for rollback protection
@@ -12,13 +14,29 @@ type OpenContext struct {
 	ExpectedVaultID      string
 	LastSeenVaultVersion uint64
 	LastSeenKeyEpoch     uint64
+
+	// State, when set, is consulted before open and updated after every
+	// successful open and commit. Its counters are merged with the above,
+	// and its device identity is stamped on every commit.
+	State *state.Store
+}
+
+// withRecord tightens ctx with a trusted local state record.
+func (ctx OpenContext) withRecord(rec *state.Record) OpenContext {
+	if ctx.ExpectedVaultID == "" {
+		ctx.ExpectedVaultID = rec.VaultID
+	}
+	ctx.LastSeenVaultVersion = max(ctx.LastSeenVaultVersion, rec.LastSeenVaultVersion)
+	ctx.LastSeenKeyEpoch = max(ctx.LastSeenKeyEpoch, rec.LastSeenKeyEpoch)
+	return ctx
 }
 
-// represents an open vault
+// represents an open vault. VaultKey is owned by the caller, who must
+// Destroy it or hand it to a Vault.
 type OpenVault struct {
 	Header       *VaultHeader
 	Payload      *DecryptedPayload
-	VaultKey     []byte
+	VaultKey     *crypto.Secret
 	VaultVersion uint64
 	KeyEpoch     uint64
 }
@@ -35,68 +53,47 @@ func OpenVaultFile(
 ) (*OpenVault, error) {
 	header, err := DecodeVaultHeader(headerBytes)
 	if err != nil {
-		return nil, fmt.Errorf("invalid vault header: %w", err)
+		return nil, fmt.Errorf("%w: %w", yerrors.ErrInvalidVault, err)
 	}
 	if ctx.ExpectedVaultID != "" && header.VaultID != ctx.ExpectedVaultID {
-		return nil, fmt.Errorf("vault_id mismatch with local state")
+		return nil, fmt.Errorf("%w: vault_id mismatch with local state", yerrors.ErrInvalidVault)
 	}
 	if header.VaultVersion < ctx.LastSeenVaultVersion {
-		return nil, fmt.Errorf("vault_version rollback detected")
+		return nil, fmt.Errorf("%w: vault_version rollback detected", yerrors.ErrRollbackDetected)
 	}
 	if header.KeyEpoch < ctx.LastSeenKeyEpoch {
-		return nil, fmt.Errorf("key_epoch downgrade detected")
+		return nil, fmt.Errorf("%w: key_epoch downgrade detected", yerrors.ErrRollbackDetected)
 	}
 
-	mk, err := keys.DeriveMasterKey(password, header.KDF.Salt, crypto.Argon2Params{
-		Memory:      header.KDF.Memory,
-		Iterations:  header.KDF.Iterations,
-		Parallelism: header.KDF.Parallelism,
-		KeyLength:   32,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("master key derivation failed: %w", err)
-	}
-
-	kek, err := keys.DeriveKEK(mk)
+	kek, err := deriveKEK(password, header.KDF)
 	if err != nil {
-		return nil, fmt.Errorf("kek derivation failed: %w", err)
+		return nil, err
 	}
+	defer kek.Destroy()
 
 	headerAAD, err := header.CannonicalBytes()
 	if err != nil {
 		return nil, err
 	}
 
-	payLoad, err := DecryptPayload(envelopeBytes, nil, headerAAD)
-	if err == nil {
-		return nil, fmt.Errorf("unexpected payload decryption without vault key")
-	}
-
-	var env EncryptedEnvelope
-	if err := encoding.UnmarshalStrict(envelopeBytes, &env); err != nil {
-		return nil, fmt.Errorf("invalid envelope nonce")
-	}
-
-	wrappedVKBytes, err := encoding.MarshalCanonical(payLoad.WrappedVaultKey)
-	if err != nil {
-		return nil, fmt.Errorf("wrapped vault key encode failed: %w", err)
-	}
-
+	// The wrapped vault key is authenticated twice: by its own AEAD tag
+	// and again as part of the header AAD when the payload is decrypted.
 	vaultKey, err := keys.UnwrapVaultKey(
-		wrappedVKBytes,
+		header.WrappedVaultKey,
 		kek,
 		header.VaultID,
 		header.KeyEpoch,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("vault key unwrap failed")
+		return nil, fmt.Errorf("%w: vault key unwrap failed", yerrors.ErrAuthFailed)
 	}
 
-	payLoad, err = DecryptPayload(
-		envelopeBytes, vaultKey, headerAAD,
+	payLoad, err := DecryptPayload(
+		envelopeBytes, vaultKey, headerAAD, header.Padding,
 	)
 	if err != nil {
-		return nil, fmt.Errorf("payload decryption failed")
+		vaultKey.Destroy()
+		return nil, fmt.Errorf("%w: payload decryption failed", yerrors.ErrCorruptData)
 	}
 
 	if err := ValidateMetadata(header, payLoad, MetadataValidationContext{
@@ -104,6 +101,7 @@ func OpenVaultFile(
 		LastSeenVaultVersion: ctx.LastSeenVaultVersion,
 		LastSeenKeyEpoch:     ctx.LastSeenKeyEpoch,
 	}); err != nil {
+		vaultKey.Destroy()
 		return nil, err
 	}
 
@@ -115,3 +113,130 @@ func OpenVaultFile(
 		KeyEpoch:     header.KeyEpoch,
 	}, nil
 }
+
+// deriveKEK runs the password through the header's KDF parameters. The
+// master key is destroyed once the KEK is derived; the caller must
+// Destroy the KEK.
+func deriveKEK(password []byte, kdf KDFParams) (*crypto.Secret, error) {
+	mk, err := keys.DeriveMasterKey(password, kdf.Salt, crypto.Argon2Params{
+		Memory:      kdf.Memory,
+		Iterations:  kdf.Iterations,
+		Parallelism: kdf.Parallelism,
+		KeyLength:   32,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("master key derivation failed: %w", err)
+	}
+	defer mk.Destroy()
+
+	kek, err := keys.DeriveKEK(mk)
+	if err != nil {
+		return nil, fmt.Errorf("kek derivation failed: %w", err)
+	}
+	return kek, nil
+}
+
+// openFile reads the container at path and runs the full open pipeline.
+func openFile(
+	path string,
+	password []byte,
+	ctx OpenContext,
+) (*OpenVault, error) {
+	vf, err := ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return openContainer(vf, password, ctx)
+}
+
+// openContainer opens a decoded container, enforcing and then updating
+// trusted local state.
+func openContainer(
+	vf *VaultFile,
+	password []byte,
+	ctx OpenContext,
+) (*OpenVault, error) {
+	ov, err := checkContainer(vf, password, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if ctx.State != nil {
+		if err := ctx.State.Save(ov.Header.VaultID, ov.VaultVersion, ov.KeyEpoch); err != nil {
+			ov.VaultKey.Destroy()
+			return nil, fmt.Errorf("local state update failed: %w", err)
+		}
+	}
+
+	return ov, nil
+}
+
+// checkContainer opens a decoded container against trusted local state
+// without updating it.
+func checkContainer(
+	vf *VaultFile,
+	password []byte,
+	ctx OpenContext,
+) (*OpenVault, error) {
+	if ctx.State != nil {
+		rec, err := ctx.State.Load(vf.Header.VaultID)
+		if err == nil {
+			ctx = ctx.withRecord(rec)
+		} else if !errors.Is(err, yerrors.ErrNotFound) {
+			return nil, err
+		}
+	}
+
+	return OpenVaultFile(vf.HeaderBytes, vf.EnvelopeBytes, password, ctx)
+}
+
+// Verify runs the full open pipeline on an in-memory container without
+// loading SQLite. Used to check vaults received over sync before they
+// replace the local file. Trusted state is checked but not updated; the
+// caller saves it once the vault is in place.
+func Verify(
+	data []byte,
+	password []byte,
+	ctx OpenContext,
+) (*VaultHeader, error) {
+	vf, err := DecodeFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	ov, err := checkContainer(vf, password, ctx)
+	if err != nil {
+		return nil, err
+	}
+	ov.VaultKey.Destroy()
+	return ov.Header, nil
+}
+
+// Open opens the vault container at path and returns a stateful vault
+// in the OPEN state. The caller must Close it.
+func Open(
+	path string,
+	password []byte,
+	ctx OpenContext,
+) (*Vault, error) {
+	ov, err := openFile(path, password, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := newOpenVault(ov.Header, ov.Payload, ov.VaultKey)
+	if err != nil {
+		ov.VaultKey.Destroy()
+		return nil, fmt.Errorf("sqlite load failed: %w", err)
+	}
+	v.path = path
+
+	if ctx.State != nil {
+		if err := v.AttachState(ctx.State); err != nil {
+			v.Close()
+			return nil, err
+		}
+	}
+
+	return v, nil
+}
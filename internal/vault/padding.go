@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"fmt"
+	"math/bits"
+	"yap/internal/encoding"
+)
+
+/*
+* Payload padding
+*
+* The payload plaintext is padded up to a bucket boundary so the
+* ciphertext size only changes when the vault crosses a bucket:
+*
+* 	pow2    next power of two, at least Size bytes
+* 	bucket  next multiple of Size bytes
+*
+* The padding is a run of zero bytes in DecryptedPayload.Padding, so it
+* is authenticated with everything else. The policy lives in the header
+* (and therefore in the AAD); vaults without one are not padded.
+* */
+
+const (
+	PaddingNone   = "none"
+	PaddingPow2   = "pow2"
+	PaddingBucket = "bucket"
+
+	minPaddingSize = 4 << 10
+	maxPaddingSize = 1 << 30
+
+	// cbor key "padding" as a text string: 1 byte head + 7 bytes
+	paddingKeySize = 8
+)
+
+type PaddingParams struct {
+	Scheme string `cbor:"scheme"`
+	Size   uint32 `cbor:"size"`
+}
+
+// DefaultPadding is used for new vaults.
+func DefaultPadding() PaddingParams {
+	return PaddingParams{Scheme: PaddingPow2, Size: 64 << 10}
+}
+
+func (p PaddingParams) Validate() error {
+	switch p.Scheme {
+	case PaddingNone:
+		if p.Size != 0 {
+			return fmt.Errorf("padding size must be 0 without padding")
+		}
+		return nil
+	case PaddingPow2:
+		if bits.OnesCount32(p.Size) != 1 {
+			return fmt.Errorf("pow2 padding size must be a power of two")
+		}
+	case PaddingBucket:
+	default:
+		return fmt.Errorf("unsupported padding scheme: %s", p.Scheme)
+	}
+
+	if p.Size < minPaddingSize || p.Size > maxPaddingSize {
+		return fmt.Errorf("padding size must be %d–%d bytes", minPaddingSize, maxPaddingSize)
+	}
+	return nil
+}
+
+// enabled reports whether p pads at all. A nil policy does not.
+func (p *PaddingParams) enabled() bool {
+	return p != nil && p.Scheme != PaddingNone
+}
+
+// bucket returns the smallest padded size >= n.
+func (p *PaddingParams) bucket(n uint64) uint64 {
+	size := uint64(p.Size)
+	if p.Scheme == PaddingPow2 {
+		if n <= size {
+			return size
+		}
+		return 1 << bits.Len64(n-1)
+	}
+	return (n + size - 1) / size * size
+}
+
+// isBucket reports whether n is a padded size.
+func (p *PaddingParams) isBucket(n uint64) bool {
+	return n > 0 && p.bucket(n) == n
+}
+
+// marshalPadded encodes payload with enough padding to fill a bucket.
+func marshalPadded(payload *DecryptedPayload, p *PaddingParams) ([]byte, error) {
+	unpadded := *payload
+	unpadded.Padding = nil
+
+	plain, err := encoding.MarshalCanonical(&unpadded)
+	if err != nil || !p.enabled() {
+		return plain, err
+	}
+
+	// The padding field costs its key, a byte string head and the bytes.
+	// Head sizes jump at 24/256/65536, so a few totals are unreachable;
+	// those move to the next bucket.
+	base := uint64(len(plain)) + paddingKeySize
+	target := p.bucket(base + 1)
+	for {
+		if n, ok := padLength(target - base); ok {
+			unpadded.Padding = make([]byte, n)
+			break
+		}
+		target = p.bucket(target + 1)
+	}
+
+	padded, err := encoding.MarshalCanonical(&unpadded)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(padded)) != target {
+		return nil, fmt.Errorf("padding produced %d bytes, want %d", len(padded), target)
+	}
+	return padded, nil
+}
+
+// padLength finds n such that a byte string of n bytes encodes to exactly
+// total bytes.
+func padLength(total uint64) (uint64, bool) {
+	for _, head := range []uint64{1, 2, 3, 5, 9} {
+		if total >= head+1 && byteStringHead(total-head) == head {
+			return total - head, true
+		}
+	}
+	return 0, false
+}
+
+func byteStringHead(n uint64) uint64 {
+	switch {
+	case n < 24:
+		return 1
+	case n < 1<<8:
+		return 2
+	case n < 1<<16:
+		return 3
+	case n < 1<<32:
+		return 5
+	default:
+		return 9
+	}
+}
+
+// checkPadding validates a decrypted payload against the header policy.
+func checkPadding(payload *DecryptedPayload, plaintextLen int, p *PaddingParams) error {
+	if !p.enabled() {
+		if len(payload.Padding) != 0 {
+			return fmt.Errorf("unexpected payload padding")
+		}
+		return nil
+	}
+
+	if len(payload.Padding) == 0 || !p.isBucket(uint64(plaintextLen)) {
+		return fmt.Errorf("payload size does not match padding policy")
+	}
+	var acc byte
+	for _, b := range payload.Padding {
+		acc |= b
+	}
+	if acc != 0 {
+		return fmt.Errorf("payload padding is not zero")
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package vault
+
+import (
+	"bytes"
+	"testing"
+	"yap/internal/crypto"
+	"yap/internal/encoding"
+)
+
+func paddingTestPayload(dbSize int) *DecryptedPayload {
+	return &DecryptedPayload{
+		VaultMetadata: VaultMetadata{VaultID: "id", VaultVersion: 1, KeyEpoch: 1},
+		SQLite:        SQLitePayload{SchemaVersion: 1, DBBytes: bytes.Repeat([]byte{1}, dbSize)},
+	}
+}
+
+func TestMarshalPadded_FillsBuckets(t *testing.T) {
+	policies := []PaddingParams{
+		DefaultPadding(),
+		{Scheme: PaddingBucket, Size: minPaddingSize},
+	}
+	for _, p := range policies {
+		// Every size around the first bucket edges, where the padding
+		// byte string head changes width
+		for size := 3800; size < 4200; size++ {
+			plain, err := marshalPadded(paddingTestPayload(size), &p)
+			if err != nil {
+				t.Fatalf("%s size %d: %v", p.Scheme, size, err)
+			}
+			if !p.isBucket(uint64(len(plain))) {
+				t.Fatalf("%s size %d: %d bytes is not a bucket", p.Scheme, size, len(plain))
+			}
+
+			var decoded DecryptedPayload
+			if err := encoding.UnmarshalStrict(plain, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if err := checkPadding(&decoded, len(plain), &p); err != nil {
+				t.Fatalf("%s size %d: %v", p.Scheme, size, err)
+			}
+		}
+	}
+}
+
+func TestEncryptPayload_SizeOnlyChangesAcrossBuckets(t *testing.T) {
+	key, err := crypto.NewSecretFrom(bytes.Repeat([]byte{7}, crypto.XChaChaKeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer key.Destroy()
+	aad := []byte("aad")
+	p := DefaultPadding()
+
+	small, err := EncryptPayload(paddingTestPayload(100), key, aad, &p, crypto.SecureRNG{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	larger, err := EncryptPayload(paddingTestPayload(30000), key, aad, &p, crypto.SecureRNG{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(small) != len(larger) {
+		t.Fatalf("sizes in one bucket differ: %d vs %d", len(small), len(larger))
+	}
+	grown, err := EncryptPayload(paddingTestPayload(70000), key, aad, &p, crypto.SecureRNG{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grown) <= len(small) {
+		t.Fatal("crossing a bucket did not grow the ciphertext")
+	}
+
+	if _, err := DecryptPayload(small, key, aad, &p); err != nil {
+		t.Fatal(err)
+	}
+	// The padding must match the policy recorded in the header
+	if _, err := DecryptPayload(small, key, aad, nil); err == nil {
+		t.Fatal("padded payload accepted by an unpadded header")
+	}
+	unpadded, err := EncryptPayload(paddingTestPayload(100), key, aad, nil, crypto.SecureRNG{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecryptPayload(unpadded, key, aad, &p); err == nil {
+		t.Fatal("unpadded payload accepted by a padded header")
+	}
+}
+
+func TestPaddingParams_Validate(t *testing.T) {
+	for _, p := range []PaddingParams{
+		{Scheme: "zeros", Size: 1 << 16},
+		{Scheme: PaddingPow2, Size: 100000},
+		{Scheme: PaddingBucket, Size: 10},
+		{Scheme: PaddingNone, Size: 4096},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("%+v: expected validation error", p)
+		}
+	}
+}
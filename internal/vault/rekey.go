@@ -0,0 +1,328 @@
+package vault
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	"yap/internal/encoding"
+	yerrors "yap/internal/errors"
+	"yap/internal/keys"
+	"yap/internal/util"
+)
+
+/*
+* Full rekey
+*
+* Password rotation keeps the Vault Key; rekey replaces it. Every
+* entry_key and folder_key is re-encrypted under a fresh Vault Key (and
+* optionally every entry and folder key is rotated too), then the header
+* is committed at epoch+1.
+*
+* Crash safety
+* The vault file is only replaced by the final atomic commit. Progress is
+* kept in a journal next to it (<vault>.rekey):
+*
+* 	the new Vault Key, wrapped under the current KEK at epoch+1
+* 	a checkpoint of the partially rekeyed SQLite, encrypted under it
+*
+* Rerunning rekey with the same password resumes from the checkpoint.
+* Entries already moved are recognised because their entry_key opens
+* under the new key. A journal that no longer matches the vault (it was
+* committed in between) is discarded.
+* */
+
+const (
+	rekeyJournalVersion = 1
+	rekeyJournalSuffix  = ".rekey"
+	rekeyAADPrefix      = "pmgr:rekey-checkpoint"
+
+	defaultRekeyBatch = 100
+)
+
+type RekeyOptions struct {
+	// RotateEntryKeys also replaces every per-entry and per-folder key
+	// and re-encrypts each field under it.
+	RotateEntryKeys bool
+
+	// BatchSize is the number of entries between checkpoints.
+	BatchSize int
+
+	// Progress is called after every entry. Returning an error stops the
+	// rekey; the journal is kept so it can be resumed.
+	Progress func(done, total int) error
+}
+
+type RekeyResult struct {
+	Total   int  // entries in the vault
+	Rekeyed int  // entries moved by this run
+	Resumed bool // an earlier interrupted run was continued
+}
+
+type rekeyJournal struct {
+	V               uint8  `cbor:"v"`
+	VaultID         string `cbor:"vault_id"`
+	FromVersion     uint64 `cbor:"from_version"`
+	FromEpoch       uint64 `cbor:"from_epoch"`
+	RotateEntryKeys bool   `cbor:"rotate_entry_keys"`
+	WrappedKey      []byte `cbor:"wrapped_key"`
+	Nonce           []byte `cbor:"nonce"`
+	Checkpoint      []byte `cbor:"checkpoint"`
+}
+
+// RekeyJournalPath returns where the rekey journal for vaultPath is kept.
+func RekeyJournalPath(vaultPath string) string {
+	return vaultPath + rekeyJournalSuffix
+}
+
+/*
+* Rekey Steps
+* 1) Re-derive the KEK from the password and check it unwraps the current key
+* 2) Resume the journal, or generate a new Vault Key and start one
+* 3) Move entries in batches, checkpointing into the journal, then folders
+* 4) Commit at epoch+1 and drop the journal
+*
+* On error the vault must be closed; its working copy may be partially
+* rekeyed. The journal and vault file are always consistent.
+* */
+func (v *Vault) Rekey(
+	outputPath string,
+	password []byte,
+	opts RekeyOptions,
+	rng crypto.RNG,
+) (*RekeyResult, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return nil, err
+	}
+	if v.state == VaultDirty {
+		return nil, fmt.Errorf("vault has uncommitted changes")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultRekeyBatch
+	}
+
+	// 1) Re-derive the KEK
+	kek, err := deriveKEK(password, v.header.KDF)
+	if err != nil {
+		return nil, err
+	}
+	defer kek.Destroy()
+
+	current, err := keys.UnwrapVaultKey(v.header.WrappedVaultKey, kek, v.vaultID, v.keyEpoch)
+	matches := err == nil && current.Equal(v.vaultKey)
+	current.Destroy()
+	if !matches {
+		return nil, fmt.Errorf("%w: password does not unlock this vault", yerrors.ErrAuthFailed)
+	}
+	newEpoch := v.keyEpoch + 1
+
+	// 2) Resume or start the journal
+	journalPath := RekeyJournalPath(outputPath)
+	result := &RekeyResult{}
+
+	journal, newKey, err := v.resumeRekey(journalPath, kek, newEpoch, opts)
+	if err != nil {
+		return nil, err
+	}
+	if journal != nil {
+		result.Resumed = true
+	} else {
+		newKey, err = keys.GenerateVaultKey(rng)
+		if err != nil {
+			return nil, err
+		}
+		wrapped, err := keys.WrapVaultKey(newKey, kek, v.vaultID, newEpoch, rng)
+		if err != nil {
+			newKey.Destroy()
+			return nil, err
+		}
+		journal = &rekeyJournal{
+			V:               rekeyJournalVersion,
+			VaultID:         v.vaultID,
+			FromVersion:     v.vaultVersion,
+			FromEpoch:       v.keyEpoch,
+			RotateEntryKeys: opts.RotateEntryKeys,
+			WrappedKey:      wrapped,
+		}
+		if err := writeRekeyJournal(journalPath, journal); err != nil {
+			newKey.Destroy()
+			return nil, err
+		}
+	}
+
+	// newKey is ours until it replaces the Vault Key in step 4
+	adopted := false
+	defer func() {
+		if !adopted {
+			newKey.Destroy()
+		}
+	}()
+
+	// 3) Move entries in batches, trashed ones included
+	ids, err := db.ListAllEntryIDs(v.db)
+	if err != nil {
+		return nil, err
+	}
+	result.Total = len(ids)
+
+	for i, id := range ids {
+		moved, err := db.RekeyEntry(v.db, v.vaultID, v.vaultKey, newKey, id, opts.RotateEntryKeys, rng)
+		if err != nil {
+			return nil, err
+		}
+		if moved {
+			result.Rekeyed++
+		}
+
+		if (i+1)%opts.BatchSize == 0 {
+			if err := v.checkpointRekey(journalPath, journal, newKey, newEpoch, rng); err != nil {
+				return nil, err
+			}
+		}
+		if opts.Progress != nil {
+			if err := opts.Progress(i+1, len(ids)); err != nil {
+				if cerr := v.checkpointRekey(journalPath, journal, newKey, newEpoch, rng); cerr != nil {
+					return nil, cerr
+				}
+				return nil, err
+			}
+		}
+	}
+
+	// Folder keys are wrapped like entry keys; there are few of them, so
+	// they are moved after the entries without their own checkpoints
+	folderIDs, err := db.ListFolderIDs(v.db)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range folderIDs {
+		if _, err := db.RekeyFolder(v.db, v.vaultID, v.vaultKey, newKey, id, opts.RotateEntryKeys, rng); err != nil {
+			return nil, err
+		}
+	}
+	if err := v.checkpointRekey(journalPath, journal, newKey, newEpoch, rng); err != nil {
+		return nil, err
+	}
+
+	// 4) Commit at the new epoch
+	header := *v.header
+	header.KeyEpoch = newEpoch
+	header.WrappedVaultKey = journal.WrappedKey
+
+	v.header = &header
+	v.vaultKey.Destroy()
+	v.vaultKey = newKey
+	v.keyEpoch = newEpoch
+	adopted = true
+	v.markDirty()
+
+	if err := v.commit(outputPath, rng); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("vault rekeyed but journal removal failed: %w", err)
+	}
+
+	return result, nil
+}
+
+// resumeRekey loads a journal matching the vault and restores its
+// checkpoint. It returns a nil journal when there is nothing to resume.
+func (v *Vault) resumeRekey(
+	journalPath string,
+	kek *crypto.Secret,
+	newEpoch uint64,
+	opts RekeyOptions,
+) (*rekeyJournal, *crypto.Secret, error) {
+	data, err := os.ReadFile(journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var j rekeyJournal
+	if err := encoding.UnmarshalStrict(data, &j); err != nil || j.V != rekeyJournalVersion {
+		return nil, nil, fmt.Errorf("%w: unreadable rekey journal %s", yerrors.ErrCorruptData, journalPath)
+	}
+
+	// The vault moved on since the journal was written: start over
+	if j.VaultID != v.vaultID || j.FromVersion != v.vaultVersion ||
+		j.FromEpoch != v.keyEpoch || j.RotateEntryKeys != opts.RotateEntryKeys {
+		return nil, nil, nil
+	}
+
+	newKey, err := keys.UnwrapVaultKey(j.WrappedKey, kek, v.vaultID, newEpoch)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: rekey journal key unwrap failed", yerrors.ErrCorruptData)
+	}
+
+	if len(j.Checkpoint) > 0 {
+		aad := rekeyAAD(v.vaultID, j.FromVersion, newEpoch)
+		dbBytes, err := crypto.Decrypt(newKey.Bytes(), j.Nonce, j.Checkpoint, aad)
+		if err != nil {
+			newKey.Destroy()
+			return nil, nil, fmt.Errorf("%w: rekey checkpoint decryption failed", yerrors.ErrCorruptData)
+		}
+		err = v.replaceDB(dbBytes)
+		crypto.Wipe(dbBytes)
+		if err != nil {
+			newKey.Destroy()
+			return nil, nil, fmt.Errorf("rekey checkpoint load failed: %w", err)
+		}
+	}
+
+	return &j, newKey, nil
+}
+
+// checkpointRekey stores the partially rekeyed database in the journal.
+func (v *Vault) checkpointRekey(
+	journalPath string,
+	j *rekeyJournal,
+	newKey *crypto.Secret,
+	newEpoch uint64,
+	rng crypto.RNG,
+) error {
+	dbBytes, err := v.snapshotDB()
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, crypto.XChaChaNonceSize)
+	if _, err := rng.Read(nonce); err != nil {
+		return err
+	}
+	ct, err := crypto.Encrypt(newKey.Bytes(), nonce, dbBytes, rekeyAAD(v.vaultID, j.FromVersion, newEpoch))
+	crypto.Wipe(dbBytes)
+	if err != nil {
+		return err
+	}
+
+	j.Nonce = nonce
+	j.Checkpoint = ct
+	return writeRekeyJournal(journalPath, j)
+}
+
+func writeRekeyJournal(path string, j *rekeyJournal) error {
+	data, err := encoding.MarshalCanonical(j)
+	if err != nil {
+		return err
+	}
+	return util.AtomicWriteFile(path, data)
+}
+
+// AAD = "pmgr:rekey-checkpoint" || vault_id || from_version || key_epoch
+func rekeyAAD(vaultID string, fromVersion, newEpoch uint64) []byte {
+	aad := make([]byte, 0, len(rekeyAADPrefix)+len(vaultID)+16)
+	aad = append(aad, rekeyAADPrefix...)
+	aad = append(aad, vaultID...)
+	aad = binary.BigEndian.AppendUint64(aad, fromVersion)
+	aad = binary.BigEndian.AppendUint64(aad, newEpoch)
+	return aad
+}
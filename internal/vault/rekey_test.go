@@ -0,0 +1,212 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/state"
+)
+
+// newRekeyVault returns a committed vault with n entries.
+func newRekeyVault(t *testing.T, n int) (string, *state.Store) {
+	t.Helper()
+
+	path := newTestVault(t)
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+
+	for i := range n {
+		e := db.Entry{Title: fmt.Sprintf("entry-%d", i), Password: fmt.Sprintf("secret-%d", i)}
+		if _, err := v.CreateEntry(e, crypto.SecureRNG{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	return path, store
+}
+
+func checkEntries(t *testing.T, v *Vault, n int) {
+	t.Helper()
+
+	entries, err := v.ListEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != n {
+		t.Fatalf("expected %d entries, got %d", n, len(entries))
+	}
+	for _, e := range entries {
+		var i int
+		if _, err := fmt.Sscanf(e.Title, "entry-%d", &i); err != nil || e.Password != fmt.Sprintf("secret-%d", i) {
+			t.Fatalf("entry corrupted: %+v", e)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	path, store := newRekeyVault(t, 5)
+
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldWrapped := v.Header().WrappedVaultKey
+
+	res, err := v.Rekey(path, testPassword, RekeyOptions{RotateEntryKeys: true}, crypto.SecureRNG{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+	if res.Total != 5 || res.Rekeyed != 5 || res.Resumed {
+		t.Fatalf("unexpected result %+v", res)
+	}
+	if _, err := os.Stat(RekeyJournalPath(path)); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("journal must be removed after commit, got %v", err)
+	}
+
+	v, err = Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.KeyEpoch() != 2 || string(v.Header().WrappedVaultKey) == string(oldWrapped) {
+		t.Fatal("rekey must bump the epoch and replace the wrapped key")
+	}
+	checkEntries(t, v, 5)
+}
+
+// A rekeyed copy may replace one on the old key, never the reverse.
+func TestSupersede_KeyEpochs(t *testing.T) {
+	path, store := newRekeyVault(t, 1)
+
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	old := v.Header()
+	if _, err := v.Rekey(path, testPassword, RekeyOptions{}, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := v.Supersede(old); err != nil {
+		t.Fatalf("superseding a copy on the old key: %v", err)
+	}
+	newer := v.Header()
+	newer.KeyEpoch++
+	if err := v.Supersede(newer); !errors.Is(err, yerrors.ErrInvalidVault) {
+		t.Fatalf("expected ErrInvalidVault for a copy on a newer key, got %v", err)
+	}
+}
+
+// Trashed entries can still be restored after a rekey.
+func TestRekey_TrashedEntries(t *testing.T) {
+	path, store := newRekeyVault(t, 3)
+
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := v.ListEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := v.DeleteEntry(entries[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	res, err := v.Rekey(path, testPassword, RekeyOptions{RotateEntryKeys: true}, crypto.SecureRNG{})
+	v.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Total != 3 {
+		t.Fatalf("trashed entry not rekeyed: %+v", res)
+	}
+
+	v, err = Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	checkEntries(t, v, 2)
+	trash, err := v.ListTrash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trash) != 1 || trash[0].Password != entries[0].Password {
+		t.Fatalf("unexpected trash %+v", trash)
+	}
+}
+
+func TestRekey_ResumesAfterInterruption(t *testing.T) {
+	path, store := newRekeyVault(t, 5)
+	before, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Interrupt after three entries
+	errCrash := errors.New("simulated crash")
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = v.Rekey(path, testPassword, RekeyOptions{
+		BatchSize: 2,
+		Progress: func(done, total int) error {
+			if done == 3 {
+				return errCrash
+			}
+			return nil
+		},
+	}, crypto.SecureRNG{})
+	v.Close()
+	if !errors.Is(err, errCrash) {
+		t.Fatalf("expected interruption, got %v", err)
+	}
+
+	// The vault itself is untouched until the final commit
+	after, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(before) != string(after) {
+		t.Fatal("interrupted rekey modified the vault file")
+	}
+
+	v, err = Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := v.Rekey(path, testPassword, RekeyOptions{BatchSize: 2}, crypto.SecureRNG{})
+	v.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Resumed || res.Rekeyed != 2 {
+		t.Fatalf("expected a resumed run moving 2 entries, got %+v", res)
+	}
+
+	v, err = Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.KeyEpoch() != 2 {
+		t.Fatalf("unexpected key epoch %d", v.KeyEpoch())
+	}
+	checkEntries(t, v, 5)
+}
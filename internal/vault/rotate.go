@@ -0,0 +1,86 @@
+package vault
+
+import (
+	"fmt"
+	"yap/internal/crypto"
+	"yap/internal/keys"
+)
+
+/*
+* Password rotation
+*
+* The Vault Key is unchanged; only its wrapping is. A fresh salt (and
+* optionally new Argon2id parameters) gives a new KEK, the Vault Key is
+* re-wrapped under it and KeyEpoch is bumped, so copies wrapped under
+* the old password are refused by devices that saw the rotation.
+*
+* 1) Derive master key + KEK from the new password and a fresh salt
+* 2) Re-wrap the Vault Key under the new KEK at epoch+1
+* 3) Swap in the new header and commit atomically
+* 4) Roll back the in-memory header if nothing was written
+* */
+func (v *Vault) RotatePassword(
+	outputPath string,
+	newPassword []byte,
+	params crypto.Argon2Params,
+	rng crypto.RNG,
+) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if params == (crypto.Argon2Params{}) {
+		params = keys.DefaultArgon2Params()
+	}
+
+	// 1) Derive master key + KEK from a fresh salt
+	salt, err := keys.GenerateSalt(rng, saltSize)
+	if err != nil {
+		return fmt.Errorf("salt generation failed: %w", err)
+	}
+	mk, err := keys.DeriveMasterKey(newPassword, salt, params)
+	if err != nil {
+		return err
+	}
+	kek, err := keys.DeriveKEK(mk)
+	mk.Destroy()
+	if err != nil {
+		return fmt.Errorf("kek derivation failed: %w", err)
+	}
+	defer kek.Destroy()
+
+	// 2) Re-wrap the Vault Key at the next epoch
+	wrapped, newEpoch, err := keys.RotateVaultKey(v.vaultKey, kek, v.vaultID, v.keyEpoch, rng)
+	if err != nil {
+		return fmt.Errorf("vault key re-wrap failed: %w", err)
+	}
+
+	// 3) Swap in the new header and commit
+	oldHeader, oldEpoch, oldState := v.header, v.keyEpoch, v.state
+
+	header := *v.header
+	header.KDF = KDFParams{
+		Algo:        kdfName,
+		Salt:        salt,
+		Memory:      params.Memory,
+		Iterations:  params.Iterations,
+		Parallelism: params.Parallelism,
+	}
+	header.KeyEpoch = newEpoch
+	header.WrappedVaultKey = wrapped
+
+	v.header = &header
+	v.keyEpoch = newEpoch
+	v.markDirty()
+
+	if err := v.commit(outputPath, rng); err != nil {
+		// 4) Restore unless the container was already written
+		if v.state == VaultDirty {
+			v.header, v.keyEpoch, v.state = oldHeader, oldEpoch, oldState
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package vault
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"yap/internal/crypto"
+	"yap/internal/db"
+	yerrors "yap/internal/errors"
+	"yap/internal/state"
+)
+
+func TestRotatePassword(t *testing.T) {
+	path := newTestVault(t)
+	store := state.NewStore(t.TempDir(), crypto.SecureRNG{})
+
+	v, err := Open(path, testPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := v.CreateEntry(db.Entry{Title: "kept", Password: "p"}, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := v.Commit(path, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	oldCopy, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	oldSalt := v.Header().KDF.Salt
+
+	newPassword := []byte("a whole new password")
+	if err := v.RotatePassword(path, newPassword, crypto.Argon2Params{}, crypto.SecureRNG{}); err != nil {
+		t.Fatal(err)
+	}
+	v.Close()
+
+	// Old password no longer unlocks
+	if _, err := Open(path, testPassword, OpenContext{}); !errors.Is(err, yerrors.ErrAuthFailed) {
+		t.Fatalf("expected ErrAuthFailed with old password, got %v", err)
+	}
+
+	v, err = Open(path, newPassword, OpenContext{State: store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer v.Close()
+	if v.KeyEpoch() != 2 || v.VaultVersion() != 3 {
+		t.Fatalf("unexpected epoch %d version %d", v.KeyEpoch(), v.VaultVersion())
+	}
+	if string(v.Header().KDF.Salt) == string(oldSalt) {
+		t.Fatal("salt must change on rotation")
+	}
+	if ids, err := v.ListEntryIDs(); err != nil || len(ids) != 1 {
+		t.Fatalf("entries lost across rotation: %v %v", ids, err)
+	}
+
+	// A copy under the old password is a key epoch downgrade
+	if err := os.WriteFile(path, oldCopy, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Open(path, testPassword, OpenContext{State: store}); !errors.Is(err, yerrors.ErrRollbackDetected) {
+		t.Fatalf("expected ErrRollbackDetected for old copy, got %v", err)
+	}
+}
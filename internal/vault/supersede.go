@@ -0,0 +1,45 @@
+package vault
+
+import (
+	"fmt"
+	yerrors "yap/internal/errors"
+	"yap/internal/state"
+)
+
+// AttachState binds trusted local state and its device identity to the
+// vault so that commits are stamped and recorded.
+func (v *Vault) AttachState(store *state.Store) error {
+	device, err := store.Device()
+	if err != nil {
+		return fmt.Errorf("device identity load failed: %w", err)
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.trusted = store
+	v.device = device
+	return nil
+}
+
+// Supersede prepares the vault to replace other, a diverged copy of the
+// same vault. The next commit gets a version greater than both. other
+// may be on an older key, never a newer one: that would undo its rekey.
+func (v *Vault) Supersede(other VaultHeader) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if err := v.requireUsable(); err != nil {
+		return err
+	}
+	if other.VaultID != v.vaultID {
+		return fmt.Errorf("%w: cannot supersede a different vault", yerrors.ErrInvalidVault)
+	}
+	if other.KeyEpoch > v.keyEpoch {
+		return fmt.Errorf("%w: the copy being replaced is on a newer key (epoch %d, this copy %d); keep that copy instead",
+			yerrors.ErrInvalidVault, other.KeyEpoch, v.keyEpoch)
+	}
+
+	v.vaultVersion = max(v.vaultVersion, other.VaultVersion)
+	v.markDirty()
+	return nil
+}